@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/notes-bin/ibed/internal/auth"
+)
+
+// runCommand 执行命令行子命令，返回 false 表示不是子命令，继续启动服务
+func runCommand(ctx context.Context, authService *auth.Auth, args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case "create-admin":
+		return true, createAdmin(ctx, authService, args[1:])
+	case "rotate-keys":
+		return true, authService.Keys().Rotate(ctx, true)
+	}
+	return false, nil
+}
+
+// createAdmin 创建管理员或将已有用户提升为管理员，未指定 -password 时从标准输入读取
+func createAdmin(ctx context.Context, authService *auth.Auth, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := fs.String("username", "", "管理员用户名")
+	password := fs.String("password", "", "管理员密码（为空时从标准输入读取）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password: %w", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	user, err := authService.CreateAdmin(ctx, *username, *password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Admin %q ready (id %s)\n", user.Username, user.ID)
+	return nil
+}
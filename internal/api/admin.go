@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// AdminStats 返回全站统计：用户、图片和字节总数，每日上传数和访问数，上传者排行和按 MIME 类型的存储占用
+func (h *Handler) AdminStats(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 || days > redis.MaxStatsDays {
+		days = 30
+	}
+	top, _ := strconv.Atoi(r.URL.Query().Get("top"))
+	if top <= 0 || top > 100 {
+		top = 10
+	}
+	stats, err := h.redis.AdminStats(r.Context(), days, top)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load stats")
+		return
+	}
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// RebuildAdminStats 按实际数据重新计算统计计数器和用户索引，用于修正偏差
+func (h *Handler) RebuildAdminStats(w http.ResponseWriter, r *http.Request) {
+	if err := h.redis.RebuildAdminStats(r.Context()); err != nil {
+		if errors.Is(err, redis.ErrStatsBusy) {
+			respondError(w, http.StatusConflict, "Data changed during rebuild, try again later")
+			return
+		}
+		slog.Error("Failed to rebuild admin stats", "error", err)
+		respondError(w, http.StatusInternalServerError, "Failed to rebuild stats")
+		return
+	}
+	stats, err := h.redis.AdminStats(r.Context(), 30, 10)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load stats")
+		return
+	}
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// adminUser 管理后台用户列表中的一项，附带存储用量
+type adminUser struct {
+	model.User
+	Usage *model.Usage `json:"usage,omitempty"`
+}
+
+// AdminListUsers 按用户名顺序分页列出用户。q 为用户名前缀，包含 @ 时按邮箱精确查找；
+// role 和 status 过滤角色和账户状态；next_cursor 不为空时作为 cursor 参数获取下一页
+func (h *Handler) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	role := model.Role(query.Get("role"))
+	status := model.UserStatus(query.Get("status"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	match := func(user *model.User) bool {
+		return (role == "" || user.Role == role) && (status == "" || user.Status == status)
+	}
+
+	var users []*model.User
+	var next string
+	if strings.Contains(q, "@") {
+		user, err := h.userByEmail(r, q)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to list users")
+			return
+		}
+		users = []*model.User{}
+		if user != nil && match(user) {
+			users = append(users, user)
+		}
+	} else {
+		cursor, err := base64.RawURLEncoding.DecodeString(query.Get("cursor"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		users, next, err = h.redis.SearchUsers(r.Context(), q, string(cursor), limit, match)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to list users")
+			return
+		}
+	}
+
+	items := make([]adminUser, 0, len(users))
+	for _, user := range users {
+		item := adminUser{User: user.Sanitized()}
+		if usage, err := h.redis.GetUsage(r.Context(), user.ID, h.defaultQuota()); err == nil {
+			item.Usage = usage
+		}
+		items = append(items, item)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"users":       items,
+		"next_cursor": base64.RawURLEncoding.EncodeToString([]byte(next)),
+	})
+}
+
+// userByEmail 通过邮箱索引查找用户，不存在时返回 nil
+func (h *Handler) userByEmail(r *http.Request, email string) (*model.User, error) {
+	id, err := h.redis.Get(r.Context(), redis.EmailKey(email)).Result()
+	if err == goredis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.redis.GetUser(r.Context(), id)
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// maxBulkImages 单次批量操作最多处理的图片数
+const maxBulkImages = 500
+
+// 批量操作的动作
+const (
+	bulkDelete     = "delete"      // 删除图片
+	bulkSetPrivate = "set_private" // 设置是否私有
+	bulkTransfer   = "transfer"    // 转给其他用户
+	bulkRetag      = "retag"       // 替换标签
+)
+
+// 批量操作单张图片的结果
+const (
+	bulkChanged   = "changed"   // 已修改，dry_run 时表示将会修改
+	bulkUnchanged = "unchanged" // 已是目标状态，无需修改
+	bulkNotFound  = "not_found" // 图片不存在
+	bulkFailed    = "failed"    // 不能执行或执行失败
+)
+
+// errOrgTransfer 组织图片不能转给个人用户
+var errOrgTransfer = errors.New("org image cannot be transferred")
+
+// bulkChange 一个字段的修改前后值
+type bulkChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// bulkResult 批量操作中单张图片的结果
+type bulkResult struct {
+	ID      string                `json:"id"`
+	Status  string                `json:"status"`
+	Changes map[string]bulkChange `json:"changes,omitempty"`
+	Error   string                `json:"error,omitempty"`
+}
+
+// imageFilter 从查询参数读取管理后台图片列表的过滤条件，since 和 until 为 RFC 3339 时间
+func imageFilter(r *http.Request) (model.ImageFilter, error) {
+	q := r.URL.Query()
+	f := model.ImageFilter{UserID: q.Get("owner"), OrgID: q.Get("org_id")}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.t = t
+		}
+	}
+	for _, p := range []struct {
+		name string
+		n    *int64
+	}{{"min_size", &f.MinSize}, {"max_size", &f.MaxSize}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.n = n
+		}
+	}
+	for _, p := range []struct {
+		name string
+		b    **bool
+	}{{"private", &f.Private}, {"reported", &f.Reported}} {
+		if v := q.Get(p.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.b = &b
+		}
+	}
+	return f, nil
+}
+
+// AdminListImages 按上传时间从新到旧列出全部图片（包括私有、隐藏和待审核的图片），
+// next_cursor 不为空时作为 cursor 参数获取下一页
+func (h *Handler) AdminListImages(w http.ResponseWriter, r *http.Request) {
+	f, err := imageFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid filter: "+err.Error())
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	images, next, err := h.redis.ListImages(r.Context(), f, r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, redis.ErrInvalidImageCursor) {
+		respondError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list images")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"images": images, "next_cursor": next})
+}
+
+// AdminBulkImages 对多张图片执行同一操作并逐张返回结果；dry_run 为 true 时只返回将会产生的修改
+func (h *Handler) AdminBulkImages(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs       []string `json:"ids"`
+		Action    string   `json:"action"`
+		IsPrivate *bool    `json:"is_private"` // set_private 的目标状态
+		UserID    string   `json:"user_id"`    // transfer 的接收用户 ID
+		Tags      []string `json:"tags"`       // retag 的新标签，为空表示清除全部标签
+		DryRun    bool     `json:"dry_run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if len(req.IDs) > maxBulkImages {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d images per request", maxBulkImages))
+		return
+	}
+	switch req.Action {
+	case bulkDelete:
+	case bulkSetPrivate:
+		if req.IsPrivate == nil {
+			respondError(w, http.StatusBadRequest, "is_private required")
+			return
+		}
+	case bulkTransfer:
+		target, err := h.redis.GetUser(r.Context(), req.UserID)
+		if err != nil || target == nil || target.Status == model.StatusDeleting {
+			respondError(w, http.StatusBadRequest, "Transfer target not found")
+			return
+		}
+	case bulkRetag:
+		req.Tags = normalizeTags(req.Tags)
+	default:
+		respondError(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+
+	results := []bulkResult{}
+	summary := map[string]int{bulkChanged: 0, bulkUnchanged: 0, bulkNotFound: 0, bulkFailed: 0}
+	seen := map[string]bool{}
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		result := bulkResult{ID: id}
+		img, err := h.redis.GetImage(r.Context(), id)
+		switch {
+		case err != nil:
+			result.Status, result.Error = bulkFailed, "Failed to load image"
+		case img == nil:
+			result.Status = bulkNotFound
+		default:
+			result.Changes, err = h.bulkApply(r, img, req.Action, req.IsPrivate, req.UserID, req.Tags, req.DryRun)
+			switch {
+			case err == goredis.Nil:
+				result.Status, result.Changes = bulkNotFound, nil
+			case errors.Is(err, errOrgTransfer):
+				result.Status, result.Changes, result.Error = bulkFailed, nil, "Org image cannot be transferred"
+			case err != nil:
+				slog.Error("Bulk image action failed", "action", req.Action, "image_id", id, "error", err)
+				result.Status, result.Changes, result.Error = bulkFailed, nil, "Failed to apply action"
+			case len(result.Changes) == 0:
+				result.Status = bulkUnchanged
+			default:
+				result.Status = bulkChanged
+			}
+		}
+		summary[result.Status]++
+		results = append(results, result)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"action":  req.Action,
+		"dry_run": req.DryRun,
+		"summary": summary,
+		"results": results,
+	})
+}
+
+// bulkApply 计算单张图片将会产生的修改，dryRun 为 false 时执行修改并写入审计日志；没有修改时返回空
+func (h *Handler) bulkApply(r *http.Request, img *model.Image, action string, isPrivate *bool, userID string, tags []string, dryRun bool) (map[string]bulkChange, error) {
+	ctx := r.Context()
+	switch action {
+	case bulkDelete:
+		if !dryRun {
+			if err := h.removeImage(ctx, img); err != nil {
+				return nil, err
+			}
+			h.recordImageDelete(r, img, true)
+		}
+		return map[string]bulkChange{"deleted": {From: false, To: true}}, nil
+
+	case bulkSetPrivate:
+		if img.IsPrivate == *isPrivate {
+			return nil, nil
+		}
+		changes := map[string]bulkChange{"is_private": {From: img.IsPrivate, To: *isPrivate}}
+		if !dryRun {
+			img.IsPrivate = *isPrivate
+			if err := h.redis.UpdateImage(ctx, img); err != nil {
+				return nil, err
+			}
+			h.audit.Record(ctx, model.AuditEvent{Action: model.AuditImageUpdate, Target: img.ID,
+				Details: map[string]string{"is_private": strconv.FormatBool(img.IsPrivate)}})
+		}
+		return changes, nil
+
+	case bulkTransfer:
+		if img.OrgID != "" {
+			return nil, errOrgTransfer
+		}
+		if img.UserID == userID {
+			return nil, nil
+		}
+		oldUserID := img.UserID
+		changes := map[string]bulkChange{"user_id": {From: oldUserID, To: userID}}
+		if !dryRun {
+			// 归属和用量在同一个脚本中转移，管理员转移不受接收方配额限制
+			if err := h.redis.TransferImage(ctx, img, userID); err != nil {
+				return nil, err
+			}
+			h.audit.Record(ctx, model.AuditEvent{Action: model.AuditImageTransfer, Target: img.ID,
+				Details: map[string]string{"from": oldUserID, "to": userID}})
+		}
+		return changes, nil
+
+	case bulkRetag:
+		oldTags := normalizeTags(img.Tags)
+		if strings.Join(oldTags, ",") == strings.Join(tags, ",") {
+			return nil, nil
+		}
+		changes := map[string]bulkChange{"tags": {From: oldTags, To: tags}}
+		if !dryRun {
+			if err := h.redis.SetImageTags(ctx, img, tags); err != nil {
+				return nil, err
+			}
+			h.audit.Record(ctx, model.AuditEvent{Action: model.AuditImageUpdate, Target: img.ID,
+				Details: map[string]string{"tags": strings.Join(tags, ",")}})
+		}
+		return changes, nil
+	}
+	return nil, nil
+}
+
+// normalizeTags 去掉标签首尾空白、空标签和重复标签并排序
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestAdminBulkImagesDryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		want    map[string]string // 图片 -> 状态，"missing" 表示不存在的图片
+		changes map[string]interface{}
+	}{
+		{"delete", map[string]interface{}{"action": "delete"},
+			map[string]string{"public": "changed", "missing": "not_found"}, map[string]interface{}{"deleted": map[string]interface{}{"from": false, "to": true}}},
+		{"set private", map[string]interface{}{"action": "set_private", "is_private": true},
+			map[string]string{"public": "changed", "private": "unchanged"}, map[string]interface{}{"is_private": map[string]interface{}{"from": false, "to": true}}},
+		{"transfer", map[string]interface{}{"action": "transfer"},
+			map[string]string{"public": "changed", "missing": "not_found"}, nil},
+		{"retag", map[string]interface{}{"action": "retag", "tags": []string{" b", "a", "a"}},
+			map[string]string{"public": "changed"}, map[string]interface{}{"tags": map[string]interface{}{"from": []interface{}{}, "to": []interface{}{"a", "b"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			ctx := context.Background()
+			admin, _ := s.admin("root")
+			owner := s.login("alice")
+			s.login("bob")
+			bob, _ := s.redis.GetUserByUsername(ctx, "bob")
+			ids := map[string]string{"public": s.upload(owner, 1, false), "private": s.upload(owner, 2, true), "missing": "no-such-image"}
+			before := map[string]interface{}{}
+			for name, id := range ids {
+				img, _ := s.redis.GetImage(ctx, id)
+				before[name] = img
+			}
+
+			body := map[string]interface{}{"dry_run": true, "user_id": bob.ID}
+			for k, v := range tt.body {
+				body[k] = v
+			}
+			var reqIDs []string
+			for name := range tt.want {
+				reqIDs = append(reqIDs, ids[name])
+			}
+			body["ids"] = reqIDs
+			code, resp := s.do("POST", "/admin/images/bulk", admin, body)
+			if code != http.StatusOK {
+				t.Fatalf("status %d %v", code, resp)
+			}
+			if resp["dry_run"] != true {
+				t.Errorf("dry_run = %v", resp["dry_run"])
+			}
+			for _, r := range resp["results"].([]interface{}) {
+				result := r.(map[string]interface{})
+				for name, id := range ids {
+					if result["id"] != id {
+						continue
+					}
+					if result["status"] != tt.want[name] {
+						t.Errorf("%s: status %v, want %s", name, result["status"], tt.want[name])
+					}
+					if name == "public" && tt.changes != nil && !reflect.DeepEqual(result["changes"], tt.changes) {
+						t.Errorf("%s: changes %v, want %v", name, result["changes"], tt.changes)
+					}
+				}
+			}
+
+			// 预演不修改任何数据
+			for name, id := range ids {
+				img, _ := s.redis.GetImage(ctx, id)
+				if !reflect.DeepEqual(img, before[name]) {
+					t.Errorf("%s modified by dry run: %+v", name, img)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminBulkTransferMovesUsage(t *testing.T) {
+	s := newTestServer(t, nil)
+	ctx := context.Background()
+	admin, _ := s.admin("root")
+	owner := s.login("alice")
+	s.login("bob")
+	alice, _ := s.redis.GetUserByUsername(ctx, "alice")
+	bob, _ := s.redis.GetUserByUsername(ctx, "bob")
+	id := s.upload(owner, 1, false)
+	img, _ := s.redis.GetImage(ctx, id)
+
+	code, resp := s.do("POST", "/admin/images/bulk", admin, map[string]interface{}{
+		"ids": []string{id}, "action": "transfer", "user_id": bob.ID})
+	if code != http.StatusOK || resp["summary"].(map[string]interface{})["changed"] != float64(1) {
+		t.Fatalf("transfer: %d %v", code, resp)
+	}
+	tests := []struct {
+		userID       string
+		bytes, count int64
+	}{
+		{alice.ID, 0, 0},
+		{bob.ID, img.Size, 1},
+	}
+	for _, tt := range tests {
+		usage, err := s.redis.GetUsage(ctx, tt.userID, model.Quota{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage.Bytes != tt.bytes || usage.Images != tt.count {
+			t.Errorf("user %s usage %d bytes / %d images, want %d / %d", tt.userID, usage.Bytes, usage.Images, tt.bytes, tt.count)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// albumAccess 返回当前用户能否查看和修改相册。
+// 个人相册由创建者管理；组织相册由编辑者和所有者管理，成员均可查看；公开相册所有登录用户可查看。
+func (h *Handler) albumAccess(r *http.Request, album *model.Album) (view, edit bool, err error) {
+	if album.OrgID != "" {
+		role, err := h.orgRole(r, album.OrgID)
+		if err != nil {
+			return false, false, err
+		}
+		edit = role.AtLeast(model.OrgEditor)
+		view = role != ""
+	} else {
+		edit = album.UserID == r.Context().Value("user_id").(string)
+		view = edit
+	}
+	return view || !album.IsPrivate || can(r, model.PermViewPrivate), edit, nil
+}
+
+// loadAlbum 读取路径中的相册并检查权限，需要修改权限时 edit 为 true。
+// 无权查看返回 404，无权修改返回 403，失败时已写入响应并返回 nil。
+func (h *Handler) loadAlbum(w http.ResponseWriter, r *http.Request, edit bool) *model.Album {
+	album, err := h.redis.GetAlbum(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load album")
+		return nil
+	}
+	if album == nil {
+		respondError(w, http.StatusNotFound, "Album not found")
+		return nil
+	}
+	canView, canEdit, err := h.albumAccess(r, album)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load album")
+		return nil
+	}
+	if !canView {
+		respondError(w, http.StatusNotFound, "Album not found")
+		return nil
+	}
+	if edit && !canEdit {
+		respondError(w, http.StatusForbidden, "Permission denied")
+		return nil
+	}
+	return album
+}
+
+// CreateAlbum 创建个人相册，指定 org_id 时创建组织相册（需要编辑者或所有者）
+func (h *Handler) CreateAlbum(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		OrgID       string `json:"org_id"`
+		IsPrivate   bool   `json:"is_private"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if req.OrgID != "" {
+		role, err := h.orgRole(r, req.OrgID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to load organization")
+			return
+		}
+		if !role.AtLeast(model.OrgEditor) {
+			respondError(w, http.StatusForbidden, "Not an editor of the organization")
+			return
+		}
+	}
+
+	album := &model.Album{
+		ID:          uuid.NewString(),
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		UserID:      r.Context().Value("user_id").(string),
+		OrgID:       req.OrgID,
+		IsPrivate:   req.IsPrivate,
+		CreatedAt:   time.Now(),
+	}
+	if err := h.redis.SaveAlbum(r.Context(), album); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create album")
+		return
+	}
+	respondJSON(w, http.StatusOK, album)
+}
+
+// ListAlbums 返回当前用户的个人相册
+func (h *Handler) ListAlbums(w http.ResponseWriter, r *http.Request) {
+	albums, err := h.redis.UserAlbums(r.Context(), r.Context().Value("user_id").(string))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list albums")
+		return
+	}
+	respondJSON(w, http.StatusOK, albums)
+}
+
+// GetAlbum 返回相册及其中当前用户可见的图片，已删除的图片顺带移出相册
+func (h *Handler) GetAlbum(w http.ResponseWriter, r *http.Request) {
+	album := h.loadAlbum(w, r, false)
+	if album == nil {
+		return
+	}
+	ids, err := h.redis.AlbumImageIDs(r.Context(), album.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load album")
+		return
+	}
+
+	orgs := h.currentOrgs(r)
+	images := []*model.Image{}
+	var missing []string
+	for _, id := range ids {
+		img, err := h.redis.GetImage(r.Context(), id)
+		if err != nil {
+			continue
+		}
+		if img == nil {
+			missing = append(missing, id)
+			continue
+		}
+		if !h.imageVisible(r, img, orgs) {
+			continue
+		}
+		images = append(images, img)
+	}
+	h.redis.RemoveAlbumImages(r.Context(), album.ID, missing...)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"album":  album,
+		"images": images,
+	})
+}
+
+// DeleteAlbum 删除相册，相册中的图片保留
+func (h *Handler) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
+	album := h.loadAlbum(w, r, true)
+	if album == nil {
+		return
+	}
+	if err := h.redis.DeleteAlbum(r.Context(), album); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete album")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Album deleted"})
+}
+
+// AddAlbumImages 将图片加入相册；组织相册只能加入该组织的图片，个人相册只能加入创建者的个人图片
+func (h *Handler) AddAlbumImages(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ImageIDs []string `json:"image_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	album := h.loadAlbum(w, r, true)
+	if album == nil {
+		return
+	}
+
+	added := []string{}
+	for _, id := range req.ImageIDs {
+		img, err := h.redis.GetImage(r.Context(), id)
+		if err != nil || img == nil || img.OrgID != album.OrgID {
+			continue
+		}
+		if album.OrgID == "" && img.UserID != album.UserID {
+			continue
+		}
+		added = append(added, id)
+	}
+	if err := h.redis.AddAlbumImages(r.Context(), album.ID, added); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to add images")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string][]string{"added": added})
+}
+
+// RemoveAlbumImage 将图片移出相册
+func (h *Handler) RemoveAlbumImage(w http.ResponseWriter, r *http.Request) {
+	album := h.loadAlbum(w, r, true)
+	if album == nil {
+		return
+	}
+	if err := h.redis.RemoveAlbumImages(r.Context(), album.ID, chi.URLParam(r, "image_id")); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to remove image")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Image removed"})
+}
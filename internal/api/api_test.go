@@ -0,0 +1,134 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/auth"
+	"github.com/notes-bin/ibed/internal/cache"
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/mail"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+	"github.com/notes-bin/ibed/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testPNG 最小的 PNG 文件头，足以通过 MIME 检测
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89")
+
+type testServer struct {
+	t     *testing.T
+	srv   *httptest.Server
+	redis *redis.Client
+	auth  *auth.Auth
+	mr    *miniredis.Miniredis
+}
+
+// newTestServer 使用 miniredis 和临时目录启动完整的路由，configure 可以在填充默认值前修改配置
+func newTestServer(t *testing.T, configure func(*config.Config)) *testServer {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := redis.NewClient(mr.Addr(), "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	st, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Port: "0", JWTSecret: "test-secret", DefaultRole: "uploader", RegistrationMode: "open", MaxUploadSize: 1 << 20}
+	if configure != nil {
+		configure(cfg)
+	}
+	cfg.SetDefaults()
+	a := auth.NewAuth(cfg, rc, mail.New(cfg.SMTP))
+	if err := a.Keys().Rotate(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(SetupRouter(cfg, rc, a, st, cache.NewImageCache(10, 1<<20), nil, nil))
+	t.Cleanup(srv.Close)
+	return &testServer{t: t, srv: srv, redis: rc, auth: a, mr: mr}
+}
+
+// do 发送请求，body 不为 nil 时编码为 JSON，header 为成对的请求头名称和值
+func (s *testServer) do(method, path, token string, body interface{}, header ...string) (int, map[string]interface{}) {
+	s.t.Helper()
+	var rd io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		rd = bytes.NewReader(data)
+	}
+	req, _ := http.NewRequest(method, s.srv.URL+path, rd)
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+// login 注册（已存在时忽略）并登录，返回令牌
+func (s *testServer) login(username string) string {
+	s.t.Helper()
+	s.do("POST", "/register", "", map[string]string{"username": username, "password": "password"})
+	code, resp := s.do("POST", "/login", "", map[string]string{"username": username, "password": "password"})
+	if code != http.StatusOK {
+		s.t.Fatalf("login %s: %d %v", username, code, resp)
+	}
+	return resp["token"].(string)
+}
+
+// admin 创建管理员并返回令牌和用户
+func (s *testServer) admin(username string) (string, *model.User) {
+	s.t.Helper()
+	s.login(username)
+	user, _ := s.redis.GetUserByUsername(context.Background(), username)
+	user.Role = model.RoleAdmin
+	s.redis.SaveUser(context.Background(), user)
+	return s.login(username), user
+}
+
+// upload 上传一张图片，extra 用于生成不同内容的图片，返回图片 ID
+func (s *testServer) upload(token string, extra byte, private bool) string {
+	s.t.Helper()
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	fw, _ := mw.CreateFormFile("image", "a.png")
+	fw.Write(append(append([]byte{}, testPNG...), extra))
+	if private {
+		mw.WriteField("is_private", "true")
+	}
+	mw.Close()
+	req, _ := http.NewRequest("POST", s.srv.URL+"/upload", buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct{ URL string }
+	json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("upload: %d", resp.StatusCode)
+	}
+	return out.URL[len("/image/"):]
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/audit"
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// auditFilter 从查询参数读取审计日志的过滤条件，since 和 until 为 RFC 3339 时间
+func auditFilter(r *http.Request) (model.AuditFilter, error) {
+	q := r.URL.Query()
+	f := model.AuditFilter{
+		ActorID:   q.Get("actor_id"),
+		Actor:     q.Get("actor"),
+		Action:    q.Get("action"),
+		Target:    q.Get("target"),
+		Outcome:   q.Get("outcome"),
+		IP:        q.Get("ip"),
+		RequestID: q.Get("request_id"),
+	}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.t = t
+		}
+	}
+	return f, nil
+}
+
+// ListAuditEvents 按时间从新到旧查询审计日志，next_cursor 不为空时作为 cursor 参数获取下一页
+func (h *Handler) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	f, err := auditFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid filter: "+err.Error())
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	events, next, err := h.audit.Query(r.Context(), f, r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, audit.ErrInvalidCursor) {
+		respondError(w, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to query audit log")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"events": events, "next_cursor": next})
+}
+
+// ExportAuditEvents 按时间从旧到新以 JSON Lines 格式导出满足条件的审计日志
+func (h *Handler) ExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	f, err := auditFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid filter: "+err.Error())
+		return
+	}
+	name := fmt.Sprintf("ibed-audit-%s.jsonl", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "private, no-store")
+	// 响应已开始写出，导出中途失败只能记录日志并截断
+	if err := h.audit.Export(r.Context(), f, w); err != nil {
+		slog.Error("Failed to export audit log", "error", err)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/notes-bin/ibed/internal/auth"
+)
+
+// SetEmail 设置或修改邮箱，并发送验证邮件
+func (h *Handler) SetEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	switch err := h.auth.SetEmail(r.Context(), userID, req.Email); err {
+	case nil:
+		respondJSON(w, http.StatusOK, map[string]string{"message": "Verification email sent"})
+	case auth.ErrInvalidEmail:
+		respondError(w, http.StatusBadRequest, "Invalid email address")
+	case auth.ErrEmailTaken:
+		respondError(w, http.StatusConflict, "Email already in use")
+	default:
+		slog.Error("Failed to set email", "user_id", userID, "error", err)
+		respondError(w, http.StatusInternalServerError, "Failed to set email")
+	}
+}
+
+// ResendVerification 重新发送验证邮件
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.Email == "" {
+		respondError(w, http.StatusBadRequest, "No email address set")
+		return
+	}
+	if user.EmailVerified {
+		respondError(w, http.StatusBadRequest, "Email already verified")
+		return
+	}
+	if err := h.auth.SendVerification(r.Context(), user); err != nil {
+		slog.Error("Failed to send verification mail", "user_id", userID, "error", err)
+		respondError(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Verification email sent"})
+}
+
+// VerifyEmail 处理邮件中的验证链接
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondError(w, http.StatusBadRequest, "Missing token")
+		return
+	}
+	if err := h.auth.VerifyEmail(r.Context(), token); err != nil {
+		switch err {
+		case auth.ErrInvalidToken:
+			respondError(w, http.StatusBadRequest, "Invalid or expired token")
+		case auth.ErrEmailTaken:
+			respondError(w, http.StatusConflict, "Email already in use")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to verify email")
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+// ForgotPassword 发送重置密码邮件，无论邮箱是否存在响应都相同
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := h.auth.ForgotPassword(r.Context(), req.Email); err != nil {
+		slog.Error("Failed to process password reset request", "error", err)
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "If the email is registered and verified, a reset link has been sent"})
+}
+
+// ResetPasswordWithToken 使用邮件中的令牌重置密码
+func (h *Handler) ResetPasswordWithToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.NewPassword == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := h.auth.ResetPasswordWithToken(r.Context(), req.Token, req.NewPassword); err != nil {
+		if err == auth.ErrInvalidToken {
+			respondError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Password reset"})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/jobs"
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type exportView struct {
+	*model.Job
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// StartExport 发起数据导出，同一用户同时只能有一个导出任务
+func (h *Handler) StartExport(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	job := &model.Job{
+		ID:        uuid.NewString(),
+		Type:      model.JobExport,
+		Status:    model.JobPending,
+		UserID:    userID,
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	current, ok, err := h.redis.StartExport(r.Context(), userID, job.ID, time.Duration(h.config.Export.TTL)*time.Second)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to start export")
+		return
+	}
+	if !ok {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "Export already in progress", "job_id": current})
+		return
+	}
+	if err := h.redis.EnqueueJob(r.Context(), job); err != nil {
+		h.redis.FinishExport(r.Context(), userID, job.ID)
+		respondError(w, http.StatusInternalServerError, "Failed to start export")
+		return
+	}
+	respondJSON(w, http.StatusAccepted, exportView{Job: job})
+}
+
+// GetExport 查询导出进度，完成后返回有时效的下载地址
+func (h *Handler) GetExport(w http.ResponseWriter, r *http.Request) {
+	job, err := h.redis.GetJob(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get export")
+		return
+	}
+	if job == nil || job.Type != model.JobExport || job.UserID != r.Context().Value("user_id").(string) {
+		respondError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	view := exportView{Job: job}
+	if job.Status == model.JobDone && time.Now().Before(job.ExpiresAt) {
+		view.DownloadURL = fmt.Sprintf("%s/exports/%s", h.config.PublicURL, job.Result)
+	}
+	view.Result = ""
+	respondJSON(w, http.StatusOK, view)
+}
+
+// DownloadExport 通过下载令牌获取导出的压缩包，链接即凭证，过期后失效
+func (h *Handler) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	jobID, err := h.redis.GetExportJobID(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get export")
+		return
+	}
+	if jobID == "" {
+		respondError(w, http.StatusNotFound, "Export not found or expired")
+		return
+	}
+	f, err := os.Open(jobs.ExportPath(h.config.Export.Dir, jobID))
+	if err != nil {
+		// 令牌仍有效但文件不在，通常是 export.dir 没有在各实例之间共享
+		slog.Warn("Export file missing for a valid download token", "job_id", jobID, "dir", h.config.Export.Dir, "error", err)
+		respondError(w, http.StatusNotFound, "Export not found or expired")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to read export")
+		return
+	}
+	name := fmt.Sprintf("ibed-export-%s.zip", info.ModTime().Format("20060102"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
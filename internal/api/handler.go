@@ -1,11 +1,15 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
@@ -15,88 +19,235 @@ import (
 	"strings"
 	"time"
 
+	"github.com/notes-bin/ibed/internal/audit"
 	"github.com/notes-bin/ibed/internal/auth"
+	"github.com/notes-bin/ibed/internal/cache"
+	"github.com/notes-bin/ibed/internal/clamd"
 	"github.com/notes-bin/ibed/internal/config"
 	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/moderation"
+	"github.com/notes-bin/ibed/internal/oidc"
+	"github.com/notes-bin/ibed/internal/ratelimit"
 	"github.com/notes-bin/ibed/internal/redis"
 	"github.com/notes-bin/ibed/internal/storage"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 type Handler struct {
-	config  *config.Config
-	auth    *auth.Auth
-	redis   *redis.Client
-	storage *storage.Storage
+	config   *config.Config
+	auth     *auth.Auth
+	audit    *audit.Logger
+	redis    *redis.Client
+	storage  *storage.Storage
+	hot      *cache.ImageCache
+	limiter  *ratelimit.Limiter
+	oidc     *oidc.Provider
+	screener *moderation.Pipeline
+	scanner  *clamd.Scanner
 }
 
-func NewHandler(config *config.Config, auth *auth.Auth, redis *redis.Client, storage *storage.Storage) *Handler {
-	return &Handler{config: config, auth: auth, redis: redis, storage: storage}
+func NewHandler(config *config.Config, auth *auth.Auth, redis *redis.Client, storage *storage.Storage, hot *cache.ImageCache, limiter *ratelimit.Limiter) *Handler {
+	return &Handler{config: config, auth: auth, audit: auth.Audit(), redis: redis, storage: storage, hot: hot, limiter: limiter}
 }
 
-func SetupRouter(config *config.Config, redis *redis.Client) http.Handler {
+func SetupRouter(config *config.Config, redis *redis.Client, authService *auth.Auth, storageService *storage.Storage, hot *cache.ImageCache, screener *moderation.Pipeline, scanner *clamd.Scanner) http.Handler {
+	h := NewHandler(config, authService, redis, storageService, hot, ratelimit.NewLimiter(redis))
+	h.screener = screener
+	h.scanner = scanner
+
 	r := chi.NewRouter()
+	if config.TrustProxy {
+		r.Use(middleware.RealIP)
+	}
+	r.Use(h.RequestIDMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(RateLimitMiddleware(config.RateLimit.Requests, config.RateLimit.Duration))
-
-	authService := auth.NewAuth(config.JWTSecret, redis)
-	storageService, err := storage.NewStorage(config.UploadDir)
-	if err != nil {
-		slog.Error("Failed to initialize storage", "error", err)
-		os.Exit(1)
-	}
-	h := NewHandler(config, authService, redis, storageService)
+	// 没有单独类别的路由使用默认配额；需要认证的路由在认证之后限流，按登录用户区分调用方
+	defaultLimit := h.RateLimitMiddleware(RouteDefault)
 
 	// 公共路由
-	r.Post("/register", h.Register)
-	r.Post("/login", h.Login)
-
-	// 需要认证的路由
+	r.With(defaultLimit).Post("/register", h.Register)
+	r.With(h.RateLimitMiddleware(RouteLogin)).Post("/setup", h.Setup)
+	r.With(h.RateLimitMiddleware(RouteLogin)).Post("/login", h.Login)
+	r.With(h.RateLimitMiddleware(RouteLogin)).Post("/login/2fa", h.LoginTwoFactor)
+	if config.OIDC.Enabled {
+		h.oidc = oidc.NewProvider(config.OIDC)
+		r.With(h.RateLimitMiddleware(RouteLogin)).Get("/oidc/login", h.OIDCLogin)
+		r.With(h.RateLimitMiddleware(RouteLogin)).Get("/oidc/callback", h.OIDCCallback)
+	}
+	r.With(defaultLimit).Get("/.well-known/jwks.json", h.JWKS)
+	r.With(defaultLimit).Get("/verify-email", h.VerifyEmail)
+	r.With(defaultLimit).Get("/exports/{token}", h.DownloadExport)
+	r.With(h.RateLimitMiddleware(RouteLogin)).Post("/password/forgot", h.ForgotPassword)
+	r.With(h.RateLimitMiddleware(RouteLogin)).Post("/password/reset", h.ResetPasswordWithToken)
+
+	// 上传路由，使用 upload 类别的配额
 	r.Group(func(r chi.Router) {
-		r.Use(h.AuthMiddleware)
+		r.Use(h.AuthMiddleware, h.RequirePermission(model.PermUpload), h.RateLimitMiddleware(RouteUpload))
 		r.Post("/upload", h.UploadImage)
 		r.Post("/batch-upload", h.BatchUploadImages)
-		r.Delete("/image/{id}", h.DeleteImage)
-		r.Post("/batch-delete", h.BatchDeleteImages)
+	})
+
+	// 需要认证的路由
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware, defaultLimit)
+		r.With(h.RequireWritable).Delete("/image/{id}", h.DeleteImage)
+		r.With(h.RequireWritable).Post("/batch-delete", h.BatchDeleteImages)
 		r.Post("/change-password", h.ChangePassword)
+		r.Post("/me/email", h.SetEmail)
+		r.Post("/me/email/resend", h.ResendVerification)
+		r.Get("/me/sessions", h.ListSessions)
+		r.Post("/me/export", h.StartExport)
+		r.Get("/me/export/{id}", h.GetExport)
+		r.Delete("/me/sessions", h.RevokeAllSessions)
+		r.Delete("/me/sessions/{id}", h.RevokeSession)
 		r.Delete("/user", h.DeleteUser)
+		r.Get("/jobs/{id}", h.GetJob)
 		r.Post("/refresh-token", h.RefreshToken)
 		r.Get("/search", h.SearchImages)
+		r.Get("/image/{id}/stats", h.ImageStats)
+		r.Get("/me/usage", h.GetUsage)
+		r.Post("/2fa/enroll", h.EnrollTwoFactor)
+		r.Post("/2fa/activate", h.ActivateTwoFactor)
+		r.Post("/2fa/disable", h.DisableTwoFactor)
+		r.Post("/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+		r.Get("/roles", h.ListRoles)
+		r.Get("/orgs", h.ListOrgs)
+		r.Get("/orgs/{id}", h.GetOrg)
+		r.Get("/orgs/{id}/images", h.ListOrgImages)
+		r.Get("/orgs/{id}/albums", h.ListOrgAlbums)
+		r.Get("/orgs/{id}/usage", h.GetOrgUsage)
+		r.Get("/albums", h.ListAlbums)
+		r.Get("/albums/{id}", h.GetAlbum)
+
+		// 组织和相册的修改，只读账户不能操作
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequireWritable)
+			r.Post("/orgs", h.CreateOrg)
+			r.Delete("/orgs/{id}", h.DeleteOrg)
+			r.Put("/orgs/{id}/members/{user_id}", h.SetOrgMember)
+			r.Delete("/orgs/{id}/members/{user_id}", h.RemoveOrgMember)
+			r.Post("/albums", h.CreateAlbum)
+			r.Delete("/albums/{id}", h.DeleteAlbum)
+			r.Post("/albums/{id}/images", h.AddAlbumImages)
+			r.Delete("/albums/{id}/images/{image_id}", h.RemoveAlbumImage)
+		})
 
-		// 管理员路由
+		// 用户管理路由
 		r.Group(func(r chi.Router) {
-			r.Use(h.AdminMiddleware)
+			r.Use(h.RequirePermission(model.PermManageUsers))
 			r.Get("/users", h.ListUsers)
+			r.Get("/admin/users", h.AdminListUsers)
+			r.Get("/admin/images", h.AdminListImages)
+			r.Post("/admin/images/bulk", h.AdminBulkImages)
 			r.Post("/reset-password", h.ResetPassword)
 			r.Post("/change-username", h.ChangeUsername)
+			r.Post("/unlock-login", h.UnlockLogin)
+			r.Get("/users/{id}/quota", h.GetUserQuota)
+			r.Put("/users/{id}/quota", h.SetUserQuota)
+			r.Delete("/users/{id}/quota", h.ResetUserQuota)
+			r.Put("/users/{id}/role", h.SetUserRole)
+			r.Put("/users/{id}/status", h.SetUserStatus)
+			r.Put("/orgs/{id}/quota", h.SetOrgQuota)
+			r.Delete("/orgs/{id}/quota", h.ResetOrgQuota)
+			r.Get("/invites", h.ListInvites)
+			r.Post("/invites", h.CreateInvite)
+			r.Delete("/invites/{code}", h.DeleteInvite)
+			r.Get("/pending-users", h.ListPendingUsers)
+			r.Post("/users/{id}/approve", h.ApproveUser)
+			r.Post("/users/{id}/reject", h.RejectUser)
+			r.Post("/jobs/{id}/retry", h.RetryJob)
+		})
+
+		// 举报审核路由
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequirePermission(model.PermDeleteAny))
+			r.Get("/moderation/queue", h.ModerationQueue)
+			r.Get("/moderation/pending", h.PendingImages)
+			r.Get("/moderation/images/{id}/reports", h.ImageReports)
+			r.Post("/moderation/images/{id}", h.ModerateImage)
+		})
+
+		// 系统管理路由
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequirePermission(model.PermManageSystem))
+			r.Get("/cache/stats", h.CacheStats)
+			r.Get("/audit", h.ListAuditEvents)
+			r.Get("/audit/export", h.ExportAuditEvents)
+			r.Get("/admin/stats", h.AdminStats)
+			r.Post("/admin/stats/rebuild", h.RebuildAdminStats)
 		})
 	})
 
-	// 图片访问（支持公有和私有）
-	r.Get("/image/{id}", h.GetImage)
+	// 排行榜
+	r.With(defaultLimit).Get("/top", h.TopImages)
+
+	// 图片访问（支持公有和私有），私有图片需要携带令牌
+	r.With(h.OptionalAuthMiddleware, h.RateLimitMiddleware(RouteImage)).Get("/image/{id}", h.GetImage)
+
+	// 举报图片，登录可选
+	r.With(h.OptionalAuthMiddleware, h.RateLimitMiddleware(RouteReport)).Post("/image/{id}/report", h.ReportImage)
 
 	return r
 }
 
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req struct {
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	user, err := h.auth.Register(r.Context(), req.Username, req.Password, req.InviteCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRegistrationClosed):
+			respondError(w, http.StatusForbidden, "Registration disabled")
+		case errors.Is(err, auth.ErrInviteRequired), errors.Is(err, redis.ErrInviteInvalid):
+			respondError(w, http.StatusForbidden, "Valid invite code required")
+		case errors.Is(err, auth.ErrUsernameTaken):
+			respondError(w, http.StatusConflict, "Username already exists")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to register")
+		}
+		return
+	}
+	message := "User registered"
+	if user.Status == model.StatusPending {
+		message = "Registration pending approval"
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": message, "user_id": user.ID, "status": string(user.Status)})
+}
+
+// Setup 使用启动时打印的一次性令牌创建首个管理员
+func (h *Handler) Setup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Username == "" || req.Password == "" {
 		respondError(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	user, err := h.auth.Register(r.Context(), req.Username, req.Password)
+	user, err := h.auth.CompleteSetup(r.Context(), req.Token, req.Username, req.Password)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to register")
+		if errors.Is(err, auth.ErrInvalidSetupToken) {
+			respondError(w, http.StatusForbidden, "Invalid or expired setup token")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to create admin")
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"message": "User registered", "user_id": user.ID})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Admin created", "user_id": user.ID})
 }
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
@@ -114,65 +265,136 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	if expiresIn == 0 {
 		expiresIn = 24 * time.Hour
 	}
-	token, err := h.auth.Login(r.Context(), req.Username, req.Password, expiresIn)
+	result, err := h.auth.Login(r.Context(), req.Username, req.Password, clientInfo(r), expiresIn)
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, "Invalid credentials")
+		if respondRestricted(w, err) {
+			return
+		}
+		var locked *auth.LockedError
+		switch {
+		case errors.As(err, &locked):
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(locked.RetryAfter)))
+			respondError(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			respondError(w, http.StatusUnauthorized, "Invalid credentials")
+		case errors.Is(err, auth.ErrAccountPending):
+			respondError(w, http.StatusForbidden, "Account pending approval")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to login")
+		}
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"token": token})
+	respondJSON(w, http.StatusOK, result)
 }
 
 func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	var req struct {
+		OldPassword string `json:"old_password"`
 		NewPassword string `json:"new_password"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewPassword == "" {
 		respondError(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
 	userID := r.Context().Value("user_id").(string)
-	user, err := h.redis.GetUser(r.Context(), userID)
-	if err != nil || user == nil {
-		respondError(w, http.StatusInternalServerError, "User not found")
-		return
-	}
-	user.Password = h.auth.HashPassword(req.NewPassword)
-	if err := h.redis.SaveUser(r.Context(), user); err != nil {
+	if err := h.auth.ChangePassword(r.Context(), userID, req.OldPassword, req.NewPassword); err != nil {
+		if err == auth.ErrInvalidCredentials {
+			respondError(w, http.StatusUnauthorized, "Current password is incorrect")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to update password")
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Password changed"})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Password changed, please log in again"})
 }
 
+// DeleteUser 注销账户：账户立即停用，图片和其他数据由后台任务删除或转移，返回任务 ID 用于查询进度
 func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(string)
-	isAdmin := r.Context().Value("is_admin").(bool)
+	callerID := r.Context().Value("user_id").(string)
+	userID := callerID
+	images := model.ImagesDelete
+	var transferTo string
 
-	// 管理员删除其他用户
-	if isAdmin {
+	// 管理员删除其他用户，可以选择把图片转给其他用户
+	if can(r, model.PermManageUsers) {
 		var req struct {
 			TargetUserID string `json:"target_user_id"`
+			Images       string `json:"images"`      // delete（默认）或 transfer
+			TransferTo   string `json:"transfer_to"` // images=transfer 时接收图片的用户 ID
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			respondError(w, http.StatusBadRequest, "Invalid request")
 			return
 		}
 		userID = req.TargetUserID
+		switch req.Images {
+		case "", model.ImagesDelete:
+		case model.ImagesTransfer:
+			if req.TransferTo == "" || req.TransferTo == userID {
+				respondError(w, http.StatusBadRequest, "Invalid transfer target")
+				return
+			}
+			target, err := h.redis.GetUser(r.Context(), req.TransferTo)
+			if err != nil || target == nil || target.Status == model.StatusDeleting {
+				respondError(w, http.StatusBadRequest, "Transfer target not found")
+				return
+			}
+			images, transferTo = model.ImagesTransfer, req.TransferTo
+		default:
+			respondError(w, http.StatusBadRequest, "Invalid images option")
+			return
+		}
 	}
 
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete user")
+		return
+	}
+	if user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
 	// 检查是否是管理员账户
-	if user, err := h.redis.GetUser(r.Context(), userID); err == nil && user != nil && user.IsAdmin {
+	if user.Role == model.RoleAdmin {
 		respondError(w, http.StatusForbidden, "Cannot delete admin user")
 		return
 	}
+	if user.Status == model.StatusDeleting {
+		respondError(w, http.StatusConflict, "User deletion already in progress")
+		return
+	}
 
-	// 删除用户相关数据
-	if err := h.redis.Del(r.Context(), fmt.Sprintf("user:%s", userID)).Err(); err != nil {
+	// 先停用账户并撤销会话，再由后台任务清理数据
+	user.Status = model.StatusDeleting
+	if err := h.redis.SaveUser(r.Context(), user); err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to delete user")
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"message": "User deleted"})
+	h.auth.RevokeAllSessions(r.Context(), userID)
+
+	now := time.Now()
+	job := &model.Job{
+		ID:         uuid.NewString(),
+		Type:       model.JobDeleteUser,
+		Status:     model.JobPending,
+		UserID:     userID,
+		Images:     images,
+		TransferTo: transferTo,
+		CreatedBy:  callerID,
+		CreatedAt:  now,
+	}
+	if err := h.redis.EnqueueJob(r.Context(), job); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to schedule user deletion")
+		return
+	}
+	details := map[string]string{"username": user.Username, "images": images, "job_id": job.ID}
+	if transferTo != "" {
+		details["transfer_to"] = transferTo
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditUserDelete, Target: userID, Details: details})
+	respondJSON(w, http.StatusAccepted, map[string]string{"message": "User deletion scheduled", "job_id": job.ID})
 }
 
 func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
@@ -184,14 +406,23 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Context().Value("user_id").(string)
-	username := r.Context().Value("username").(string)
-	isAdmin := r.Context().Value("is_admin").(bool)
+	claims := auth.TokenClaims{
+		UserID:    r.Context().Value("user_id").(string),
+		MFA:       r.Context().Value("mfa").(bool),
+		SessionID: r.Context().Value("session_id").(string),
+	}
 	expiresIn := time.Duration(req.ExpiresIn) * time.Second
 	if expiresIn == 0 {
 		expiresIn = 24 * time.Hour
 	}
-	token, err := h.auth.GenerateToken(userID, username, isAdmin, expiresIn)
+	token, err := h.auth.RefreshToken(r.Context(), claims, expiresIn)
+	if err == auth.ErrSessionRevoked {
+		respondError(w, http.StatusUnauthorized, "Session revoked")
+		return
+	}
+	if respondRestricted(w, err) {
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to refresh token")
 		return
@@ -200,19 +431,15 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	keys, err := h.redis.Keys(r.Context(), "user:*").Result()
+	users := []model.User{}
+	err := h.redis.ScanUsers(r.Context(), func(user *model.User) bool {
+		users = append(users, user.Sanitized())
+		return true
+	})
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to list users")
 		return
 	}
-	users := []model.User{}
-	for _, key := range keys {
-		user, err := h.redis.GetUser(r.Context(), key[5:]) // 去掉 "user:" 前缀
-		if err != nil || user == nil {
-			continue
-		}
-		users = append(users, *user)
-	}
 	respondJSON(w, http.StatusOK, users)
 }
 
@@ -231,34 +458,62 @@ func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusNotFound, "User not found")
 		return
 	}
-	user.Password = h.auth.HashPassword(req.NewPassword)
-	if err := h.redis.SaveUser(r.Context(), user); err != nil {
+	if err := h.auth.SetPassword(r.Context(), user, req.NewPassword); err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to reset password")
 		return
 	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditPasswordReset, Target: user.ID,
+		Details: map[string]string{"username": user.Username}})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Password reset"})
 }
 
+func (h *Handler) UnlockLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Username == "" && req.IP == "") {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := h.auth.Unlock(r.Context(), req.Username, req.IP); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to unlock")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Login unlocked"})
+}
+
 func (h *Handler) ChangeUsername(w http.ResponseWriter, r *http.Request) {
 	var req struct {
+		UserID      string `json:"user_id"` // 为空时修改自己的用户名
 		NewUsername string `json:"new_username"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewUsername == "" {
 		respondError(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
 
-	userID := r.Context().Value("user_id").(string)
+	userID := req.UserID
+	if userID == "" {
+		userID = r.Context().Value("user_id").(string)
+	}
 	user, err := h.redis.GetUser(r.Context(), userID)
 	if err != nil || user == nil {
 		respondError(w, http.StatusNotFound, "User not found")
 		return
 	}
-	user.Username = req.NewUsername
-	if err := h.redis.SaveUser(r.Context(), user); err != nil {
+	oldUsername := user.Username
+	if err := h.redis.RenameUser(r.Context(), user, req.NewUsername); err != nil {
+		if errors.Is(err, auth.ErrUsernameTaken) {
+			respondError(w, http.StatusConflict, "Username already exists")
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to change username")
 		return
 	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditUsernameChange, Target: user.ID,
+		Details: map[string]string{"from": oldUsername, "to": req.NewUsername}})
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Username changed"})
 }
 
@@ -271,80 +526,59 @@ func (h *Handler) UploadImage(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// 计算 MD5
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to process file")
+	orgID := r.FormValue("org_id")
+	usage := h.uploadUsage(w, r, orgID)
+	if usage == nil {
 		return
 	}
-	file.Seek(0, 0)
-	md5Sum := hex.EncodeToString(hash.Sum(nil))
 
-	// 检查是否已存在
-	if img, err := h.redis.GetImage(r.Context(), md5Sum); err == nil && img != nil {
-		respondJSON(w, http.StatusOK, map[string]string{"url": fmt.Sprintf("/image/%s", md5Sum)})
-		return
+	img := &model.Image{
+		UserID:      r.Context().Value("user_id").(string),
+		OrgID:       orgID,
+		Description: r.FormValue("description"),
+		Tags:        strings.Split(r.FormValue("tags"), ","),
+		IsPrivate:   r.FormValue("is_private") == "true",
 	}
-
-	// 验证 MIME 类型
-	mimeType, err := detectMIME(file)
-	if err != nil || !isImageMIME(mimeType) {
-		respondError(w, http.StatusBadRequest, "Unsupported file type")
+	if err := h.storeImage(r.Context(), file, header, img, usage.Quota); err != nil {
+		respondUploadError(w, err)
 		return
 	}
 
-	// 创建临时文件
-	tempFile, err := os.CreateTemp("", "upload-*")
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create temp file")
-		return
+	resp := map[string]string{"url": fmt.Sprintf("/image/%s", img.ID)}
+	if img.Review != "" {
+		resp["review"] = string(img.Review)
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
-
-	// 复制文件内容到临时文件
-	file.Seek(0, 0)
-	if _, err := io.Copy(tempFile, file); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to save temp file")
-		return
+	if img.Scan != "" {
+		resp["scan"] = string(img.Scan)
 	}
-	tempFile.Seek(0, 0)
+	respondJSON(w, http.StatusOK, resp)
+}
 
-	// 保存文件
-	filename := md5Sum + filepath.Ext(header.Filename)
-	path := h.storage.GetFilePath(filename)
-	if err := h.storage.SaveFile(tempFile, path); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to save file")
+func (h *Handler) BatchUploadImages(w http.ResponseWriter, r *http.Request) {
+	r.ParseMultipartForm(h.config.MaxUploadSize)
+	if r.MultipartForm == nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
 		return
 	}
+	files := r.MultipartForm.File["images"]
+	urls := []string{}
 
-	// 保存元数据
+	// 先整体检查配额，避免批量上传到一半才失败
 	userID := r.Context().Value("user_id").(string)
-	isPrivate := r.FormValue("is_private") == "true"
-	tags := strings.Split(r.FormValue("tags"), ",")
-	img := &model.Image{
-		ID:          md5Sum,
-		UserID:      userID,
-		Filename:    filename,
-		Description: r.FormValue("description"),
-		Tags:        tags,
-		IsPrivate:   isPrivate,
-		CreatedAt:   time.Now(),
+	orgID := r.FormValue("org_id")
+	usage := h.uploadUsage(w, r, orgID)
+	if usage == nil {
+		return
 	}
-	if err := h.redis.SaveImage(r.Context(), img); err != nil {
-		h.storage.DeleteFile(path)
-		respondError(w, http.StatusInternalServerError, "Failed to save metadata")
+	var total int64
+	for _, fileHeader := range files {
+		total += fileHeader.Size
+	}
+	if exceedsQuota(usage, total, int64(len(files))) {
+		respondError(w, http.StatusRequestEntityTooLarge, "Storage quota exceeded")
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"url": fmt.Sprintf("/image/%s", md5Sum)})
-}
-
-func (h *Handler) BatchUploadImages(w http.ResponseWriter, r *http.Request) {
-	r.ParseMultipartForm(h.config.MaxUploadSize)
-	files := r.MultipartForm.File["images"]
-	urls := []string{}
-
 	for _, fileHeader := range files {
 		file, err := fileHeader.Open()
 		if err != nil {
@@ -353,59 +587,134 @@ func (h *Handler) BatchUploadImages(w http.ResponseWriter, r *http.Request) {
 		}
 		defer file.Close()
 
-		// 计算 MD5
-		hash := md5.New()
-		if _, err := io.Copy(hash, file); err != nil {
-			respondError(w, http.StatusInternalServerError, "Failed to process file")
-			return
-		}
-		file.Seek(0, 0)
-		md5Sum := hex.EncodeToString(hash.Sum(nil))
-
-		// 检查是否已存在
-		if img, err := h.redis.GetImage(r.Context(), md5Sum); err == nil && img != nil {
-			urls = append(urls, fmt.Sprintf("/image/%s", md5Sum))
-			continue
-		}
-
-		// 验证 MIME 类型
-		mimeType, err := detectMIME(file)
-		if err != nil || !isImageMIME(mimeType) {
-			respondError(w, http.StatusBadRequest, "Unsupported file type")
-			return
-		}
-
-		// 保存文件
-		filename := md5Sum + filepath.Ext(fileHeader.Filename)
-		path := h.storage.GetFilePath(filename)
-		if err := h.storage.SaveFile(file, path); err != nil {
-			respondError(w, http.StatusInternalServerError, "Failed to save file")
-			return
-		}
-
-		// 保存元数据
-		userID := r.Context().Value("user_id").(string)
-		isPrivate := r.FormValue("is_private") == "true"
 		img := &model.Image{
-			ID:          md5Sum,
 			UserID:      userID,
-			Filename:    filename,
+			OrgID:       orgID,
 			Description: r.FormValue("description"),
 			Tags:        r.Form["tags"],
-			IsPrivate:   isPrivate,
-			CreatedAt:   time.Now(),
+			IsPrivate:   r.FormValue("is_private") == "true",
 		}
-		if err := h.redis.SaveImage(r.Context(), img); err != nil {
-			h.storage.DeleteFile(path)
-			respondError(w, http.StatusInternalServerError, "Failed to save metadata")
+		if err := h.storeImage(r.Context(), file, fileHeader, img, usage.Quota); err != nil {
+			respondUploadError(w, err)
 			return
 		}
-		urls = append(urls, fmt.Sprintf("/image/%s", md5Sum))
+		urls = append(urls, fmt.Sprintf("/image/%s", img.ID))
 	}
 
 	respondJSON(w, http.StatusOK, map[string][]string{"urls": urls})
 }
 
+// uploadError 上传失败时返回给客户端的状态码和信息
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+func respondUploadError(w http.ResponseWriter, err error) {
+	if ue, ok := err.(*uploadError); ok {
+		respondError(w, ue.status, ue.message)
+		return
+	}
+	respondError(w, http.StatusInternalServerError, "Failed to upload image")
+}
+
+// storeImage 校验并保存单个上传文件，补全 img 的 ID、文件名、大小等字段。
+// 同内容图片已存在时直接返回，不重复保存也不占用配额。
+func (h *Handler) storeImage(ctx context.Context, file multipart.File, header *multipart.FileHeader, img *model.Image, quota model.Quota) error {
+	if h.config.MaxUploadSize > 0 && header.Size > h.config.MaxUploadSize {
+		return &uploadError{http.StatusRequestEntityTooLarge, "File too large"}
+	}
+
+	// 计算 MD5
+	hash := md5.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return &uploadError{http.StatusInternalServerError, "Failed to process file"}
+	}
+	file.Seek(0, 0)
+	img.ID = hex.EncodeToString(hash.Sum(nil))
+
+	// 检查是否已存在
+	if existing, err := h.redis.GetImage(ctx, img.ID); err == nil && existing != nil {
+		return nil
+	}
+
+	// 验证 MIME 类型
+	mimeType, err := detectMIME(file)
+	if err != nil || !isImageMIME(mimeType) {
+		return &uploadError{http.StatusBadRequest, "Unsupported file type"}
+	}
+
+	// 占用配额
+	if err := h.reserveQuota(ctx, img, header.Size, quota); err != nil {
+		if err == redis.ErrQuotaExceeded {
+			return &uploadError{http.StatusRequestEntityTooLarge, "Storage quota exceeded"}
+		}
+		return &uploadError{http.StatusInternalServerError, "Failed to reserve quota"}
+	}
+	saved := false
+	defer func() {
+		if !saved {
+			h.releaseQuota(ctx, img, header.Size)
+		}
+	}()
+
+	// 创建临时文件
+	tempFile, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return &uploadError{http.StatusInternalServerError, "Failed to create temp file"}
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	// 复制文件内容到临时文件
+	file.Seek(0, 0)
+	if _, err := io.Copy(tempFile, file); err != nil {
+		return &uploadError{http.StatusInternalServerError, "Failed to save temp file"}
+	}
+	tempFile.Seek(0, 0)
+
+	img.Filename = img.ID + filepath.Ext(header.Filename)
+	img.Size = header.Size
+	img.MimeType = mimeType
+	img.CreatedAt = time.Now()
+
+	// 病毒扫描，感染文件被隔离并拒绝上传
+	if h.scanner != nil && h.scanner.Enabled() {
+		scan, err := h.scanner.Check(ctx, tempFile.Name(), img)
+		var infected *clamd.InfectedError
+		switch {
+		case errors.As(err, &infected):
+			return &uploadError{http.StatusUnprocessableEntity, "Malware detected: " + infected.Signature}
+		case err != nil:
+			return &uploadError{http.StatusServiceUnavailable, "Virus scanner unavailable"}
+		}
+		img.Scan = scan
+	}
+
+	// 发布前审核，未通过或需人工审核的图片仍然保存，但只有上传者和审核人员可见
+	if h.screener != nil && h.screener.Enabled() {
+		img.Review, img.ReviewReason = h.screener.Screen(ctx, tempFile.Name(), img)
+	}
+
+	// 保存文件
+	path := h.storage.GetFilePath(img.Filename)
+	if err := h.storage.SaveFile(tempFile, path); err != nil {
+		return &uploadError{http.StatusInternalServerError, "Failed to save file"}
+	}
+
+	// 保存元数据
+	if err := h.redis.SaveImage(ctx, img); err != nil {
+		h.storage.DeleteFile(path)
+		return &uploadError{http.StatusInternalServerError, "Failed to save metadata"}
+	}
+	saved = true
+	return nil
+}
+
 func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
 	imageID := chi.URLParam(r, "id")
 	img, err := h.redis.GetImage(r.Context(), imageID)
@@ -414,22 +723,32 @@ func (h *Handler) GetImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if img.IsPrivate {
-		userID := r.Context().Value("user_id")
-		if userID == nil || userID.(string) != img.UserID {
-			respondError(w, http.StatusForbidden, "Private image")
-			return
-		}
+	orgs := h.currentOrgs(r)
+	if img.IsPrivate && !canViewPrivate(r, img, orgs) {
+		respondError(w, http.StatusForbidden, "Private image")
+		return
+	}
+	if !h.imageVisible(r, img, orgs) {
+		respondError(w, http.StatusNotFound, "Image not found")
+		return
 	}
 
-	// 增加访问计数
-	if err := h.redis.IncrementView(r.Context(), imageID); err != nil {
-		slog.Error("Failed to increment view", "image_id", imageID, "error", err)
+	// 优先从 Top10 缓存读取，未命中再读文件系统
+	sw := &servedWriter{ResponseWriter: w}
+	if cached, ok := h.hot.Get(imageID); ok {
+		http.ServeContent(sw, r, cached.Filename, cached.ModTime, bytes.NewReader(cached.Data))
+	} else {
+		http.ServeFile(sw, r, h.storage.GetFilePath(img.Filename))
+	}
+	if !sw.served() || r.Method == http.MethodHead {
+		return
 	}
 
-	// 从 Top10 缓存或文件系统读取
-	path := h.storage.GetFilePath(img.Filename)
-	http.ServeFile(w, r, path)
+	// 返回内容后再计数，带宽按实际写出的字节统计
+	if err := h.redis.IncrementView(r.Context(), imageID, h.config.Leaderboard.RetentionDays); err != nil {
+		slog.Error("Failed to increment view", "image_id", imageID, "error", err)
+	}
+	h.recordView(r, imageID, sw.bytes)
 }
 
 func (h *Handler) DeleteImage(w http.ResponseWriter, r *http.Request) {
@@ -440,22 +759,16 @@ func (h *Handler) DeleteImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Context().Value("user_id").(string)
-	isAdmin := r.Context().Value("is_admin").(bool)
-	if img.UserID != userID && !isAdmin {
+	if !canDeleteImage(r, img, h.currentOrgs(r)) {
 		respondError(w, http.StatusForbidden, "Unauthorized")
 		return
 	}
 
-	// 删除文件和元数据
-	path := h.storage.GetFilePath(img.Filename)
-	if err := h.storage.DeleteFile(path); err != nil {
-		slog.Error("Failed to delete file", "path", path, "error", err)
-	}
-	if err := h.redis.Del(r.Context(), fmt.Sprintf("image:%s", imageID)).Err(); err != nil {
-		slog.Error("Failed to delete metadata", "image_id", imageID, "error", err)
+	if err := h.removeImage(r.Context(), img); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete image")
+		return
 	}
-
+	h.recordImageDelete(r, img, false)
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Image deleted"})
 }
 
@@ -468,30 +781,56 @@ func (h *Handler) BatchDeleteImages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Context().Value("user_id").(string)
-	isAdmin := r.Context().Value("is_admin").(bool)
-
+	orgs := h.currentOrgs(r)
 	for _, imageID := range req.IDs {
 		img, err := h.redis.GetImage(r.Context(), imageID)
 		if err != nil || img == nil {
 			continue
 		}
-		if img.UserID != userID && !isAdmin {
+		if !canDeleteImage(r, img, orgs) {
 			continue
 		}
 
-		path := h.storage.GetFilePath(img.Filename)
-		if err := h.storage.DeleteFile(path); err != nil {
-			slog.Error("Failed to delete file", "path", path, "error", err)
-		}
-		if err := h.redis.Del(r.Context(), fmt.Sprintf("image:%s", imageID)).Err(); err != nil {
-			slog.Error("Failed to delete metadata", "image_id", imageID, "error", err)
+		if err := h.removeImage(r.Context(), img); err != nil {
+			continue
 		}
+		h.recordImageDelete(r, img, true)
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Images deleted"})
 }
 
+func (h *Handler) recordImageDelete(r *http.Request, img *model.Image, batch bool) {
+	details := map[string]string{"owner": img.UserID, "filename": img.Filename}
+	if img.OrgID != "" {
+		details["org_id"] = img.OrgID
+	}
+	if batch {
+		details["batch"] = "true"
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditImageDelete, Target: img.ID, Details: details})
+}
+
+// removeImage 删除图片文件、元数据及其热点缓存并归还配额；文件删除失败时保留元数据，可以重试
+func (h *Handler) removeImage(ctx context.Context, img *model.Image) error {
+	h.hot.Delete(img.ID)
+	path := h.storage.GetFilePath(img.Filename)
+	if err := h.storage.DeleteFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("Failed to delete file", "path", path, "error", err)
+		return err
+	}
+	if err := h.redis.DeleteImage(ctx, img); err != nil {
+		slog.Error("Failed to delete metadata", "image_id", img.ID, "error", err)
+		return err
+	}
+	h.releaseQuota(ctx, img, img.Size)
+	return nil
+}
+
+func (h *Handler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.hot.Stats())
+}
+
 func (h *Handler) SearchImages(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
@@ -506,11 +845,10 @@ func (h *Handler) SearchImages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.Context().Value("user_id")
-	isAdmin := r.Context().Value("is_admin")
+	orgs := h.currentOrgs(r)
 	filtered := []*model.Image{}
 	for _, img := range images {
-		if img.IsPrivate && (userID == nil || (img.UserID != userID.(string) && !isAdmin.(bool))) {
+		if !h.imageVisible(r, img, orgs) {
 			continue
 		}
 		filtered = append(filtered, img)
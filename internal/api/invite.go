@@ -0,0 +1,129 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.redis.ListInvites(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list invites")
+		return
+	}
+	respondJSON(w, http.StatusOK, invites)
+}
+
+// CreateInvite 生成邀请码，可限制使用次数和有效期，并指定注册后的角色和配额
+func (h *Handler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MaxUses   int64        `json:"max_uses"`
+		ExpiresIn int64        `json:"expires_in"` // 秒，0 表示不过期
+		Role      model.Role   `json:"role"`
+		Quota     *model.Quota `json:"quota"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MaxUses < 0 || req.ExpiresIn < 0 {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if req.Role != "" && !req.Role.Valid() {
+		respondError(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create invite")
+		return
+	}
+	invite := &model.Invite{
+		Code:      strings.ToLower(base32.StdEncoding.EncodeToString(buf)),
+		MaxUses:   req.MaxUses,
+		Role:      req.Role,
+		Quota:     req.Quota,
+		CreatedBy: r.Context().Value("user_id").(string),
+		CreatedAt: time.Now(),
+	}
+	if req.ExpiresIn > 0 {
+		invite.ExpiresAt = invite.CreatedAt.Add(time.Duration(req.ExpiresIn) * time.Second)
+	}
+	if err := h.redis.SaveInvite(r.Context(), invite); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create invite")
+		return
+	}
+	respondJSON(w, http.StatusOK, invite)
+}
+
+func (h *Handler) DeleteInvite(w http.ResponseWriter, r *http.Request) {
+	if err := h.redis.DeleteInvite(r.Context(), chi.URLParam(r, "code")); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete invite")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Invite deleted"})
+}
+
+// ListPendingUsers 返回等待审核的用户
+func (h *Handler) ListPendingUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.redis.ListPendingUsers(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list pending users")
+		return
+	}
+	result := []model.User{}
+	for _, user := range users {
+		result = append(result, user.Sanitized())
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (h *Handler) ApproveUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.Status != model.StatusPending {
+		respondError(w, http.StatusConflict, "User is not pending approval")
+		return
+	}
+	user.Status = model.StatusActive
+	if err := h.redis.SaveUser(r.Context(), user); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to approve user")
+		return
+	}
+	h.redis.RemovePendingUser(r.Context(), userID)
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditUserApprove, Target: userID,
+		Details: map[string]string{"username": user.Username}})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "User approved"})
+}
+
+// RejectUser 拒绝注册申请并删除该账户
+func (h *Handler) RejectUser(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.Status != model.StatusPending {
+		respondError(w, http.StatusConflict, "User is not pending approval")
+		return
+	}
+	// 待审核用户还不能上传图片，直接清除用户数据并释放用户名
+	if err := h.redis.PurgeUser(r.Context(), userID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to reject user")
+		return
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditUserReject, Target: userID,
+		Details: map[string]string{"username": user.Username}})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "User rejected"})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetJob 查询后台任务进度，只有任务创建者和用户管理员可以查看
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.redis.GetJob(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get job")
+		return
+	}
+	if job == nil || (job.CreatedBy != r.Context().Value("user_id").(string) && !can(r, model.PermManageUsers)) {
+		respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	// 下载令牌只通过 /me/export/{id} 返回给本人
+	job.Result = ""
+	respondJSON(w, http.StatusOK, job)
+}
+
+// RetryJob 重新执行失败的任务，已处理的部分不会重复处理
+func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.redis.GetJob(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get job")
+		return
+	}
+	if job == nil {
+		respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	if job.Status != model.JobFailed {
+		respondError(w, http.StatusConflict, "Only failed jobs can be retried")
+		return
+	}
+	job.Status = model.JobPending
+	if err := h.redis.EnqueueJob(r.Context(), job); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to retry job")
+		return
+	}
+	respondJSON(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"net/http"
+)
+
+// JWKS 公开当前及尚未过期的签名公钥，供其他服务校验 ibed 签发的令牌
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, map[string]interface{}{"keys": h.auth.Keys().JWKS()})
+}
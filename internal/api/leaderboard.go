@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/redis"
+)
+
+const maxTopLimit = 100
+
+type topImage struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Score       float64  `json:"score"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+// TopImages 返回指定时间窗口内的公开热门图片
+func (h *Handler) TopImages(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	key, err := redis.LeaderboardKey(window, time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid window")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > maxTopLimit {
+		limit = maxTopLimit
+	}
+
+	// 分批读取榜单并跳过私有或已删除的图片，最多扫描 limit 的 5 倍
+	result := []topImage{}
+	batch := int64(limit * 2)
+	for start := int64(0); len(result) < limit && start < int64(limit*5); start += batch {
+		entries, err := h.redis.ZRevRangeWithScores(r.Context(), key, start, start+batch-1).Result()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to load leaderboard")
+			return
+		}
+		for _, entry := range entries {
+			id := entry.Member.(string)
+			img, err := h.redis.GetImage(r.Context(), id)
+			if err != nil || img == nil || img.IsPrivate || img.Hidden || !img.Published() || h.imageHidden(r, img) {
+				continue
+			}
+			result = append(result, topImage{
+				ID:          id,
+				URL:         fmt.Sprintf("/image/%s", id),
+				Score:       entry.Score,
+				Description: img.Description,
+				Tags:        img.Tags,
+			})
+			if len(result) == limit {
+				break
+			}
+		}
+		if int64(len(entries)) < batch {
+			break
+		}
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
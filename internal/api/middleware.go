@@ -2,54 +2,170 @@ package api
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/time/rate"
+	"github.com/notes-bin/ibed/internal/auth"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/ratelimit"
+
+	"github.com/google/uuid"
 )
 
+// RequestIDMiddleware 为每个请求分配请求 ID，写入响应头 X-Request-ID，并与客户端 IP 一起写入请求上下文供审计使用；
+// 开启 trust_proxy 时沿用代理传入的 X-Request-ID
+func (h *Handler) RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !h.config.TrustProxy || id == "" || len(id) > 64 {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), "request_id", id)
+		ctx = context.WithValue(ctx, "client_ip", clientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		if r.Header.Get("Authorization") == "" {
 			respondError(w, http.StatusUnauthorized, "Missing token")
 			return
 		}
-
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(h.config.JWTSecret), nil
-		})
-		if err != nil || !token.Valid {
-			respondError(w, http.StatusUnauthorized, "Invalid token")
-			return
+		if r, ok := h.authenticate(w, r); ok {
+			next.ServeHTTP(w, r)
 		}
-
-		ctx := context.WithValue(r.Context(), "user_id", claims["user_id"].(string))
-		ctx = context.WithValue(ctx, "username", claims["username"].(string))
-		ctx = context.WithValue(ctx, "is_admin", claims["is_admin"].(bool))
-		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (h *Handler) AdminMiddleware(next http.Handler) http.Handler {
+// OptionalAuthMiddleware 带有效令牌时按 AuthMiddleware 校验并写入用户信息；
+// 不带令牌、令牌无效或过期、会话已撤销时按匿名访问处理
+func (h *Handler) OptionalAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		isAdmin := r.Context().Value("is_admin").(bool)
-		if !isAdmin {
-			respondError(w, http.StatusForbidden, "Admin access required")
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
-		next.ServeHTTP(w, r)
+		claims, err := h.auth.ParseToken(r.Context(), strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r, ok := h.authenticateClaims(w, r, claims, true); ok {
+			next.ServeHTTP(w, r)
+		}
 	})
 }
 
-func RateLimitMiddleware(limit int, duration int) func(http.Handler) http.Handler {
-	limiter := rate.NewLimiter(rate.Limit(float64(limit)/float64(duration)), limit)
+// authenticate 校验令牌和会话，并将用户信息写入请求上下文；失败时已写入响应并返回 false
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	tokenStr := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims, err := h.auth.ParseToken(r.Context(), tokenStr)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Invalid token")
+		return nil, false
+	}
+	return h.authenticateClaims(w, r, claims, false)
+}
+
+// authenticateClaims 校验已解析令牌的会话并写入用户信息；optional 为 true 时会话已撤销按匿名请求原样返回
+func (h *Handler) authenticateClaims(w http.ResponseWriter, r *http.Request, claims *auth.TokenClaims, optional bool) (*http.Request, bool) {
+	status, err := h.auth.ValidateSession(r.Context(), claims, clientIP(r))
+	if err != nil {
+		if err == auth.ErrSessionRevoked && optional {
+			return r, true
+		}
+		if err == auth.ErrSessionRevoked {
+			respondError(w, http.StatusUnauthorized, "Session revoked")
+			return nil, false
+		}
+		if respondRestricted(w, err) {
+			return nil, false
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to validate session")
+		return nil, false
+	}
+
+	ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "username", claims.Username)
+	ctx = context.WithValue(ctx, "role", claims.Role)
+	ctx = context.WithValue(ctx, "mfa", claims.MFA)
+	ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+	ctx = context.WithValue(ctx, "status", status)
+	return r.WithContext(ctx), true
+}
+
+// RequirePermission 要求当前用户的角色拥有指定权限，只读账户不能使用任何需要权限的功能
+func (h *Handler) RequirePermission(perm model.Permission) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if err := limiter.Wait(r.Context()); err != nil {
+			role := currentRole(r)
+			if !role.Can(perm) {
+				h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditAccessDenied, Target: r.URL.Path, Outcome: model.AuditDenied,
+					Details: map[string]string{"method": r.Method, "permission": string(perm)}})
+				respondError(w, http.StatusForbidden, "Permission denied")
+				return
+			}
+			if currentStatus(r) == model.StatusReadOnly {
+				respondError(w, http.StatusForbidden, "Account is read-only")
+				return
+			}
+			if role == model.RoleAdmin && h.config.TwoFactor.RequireAdmin && !r.Context().Value("mfa").(bool) {
+				respondError(w, http.StatusForbidden, "Two-factor authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// currentRole 返回当前请求用户的角色，未登录时为空
+func currentRole(r *http.Request) model.Role {
+	role, _ := r.Context().Value("role").(model.Role)
+	return role
+}
+
+// can 判断当前请求用户是否拥有指定权限
+func can(r *http.Request, perm model.Permission) bool {
+	return currentRole(r).Can(perm)
+}
+
+// 限流的路由类别，各类别使用独立的配额
+const (
+	RouteDefault = "default"
+	RouteLogin   = "login"
+	RouteUpload  = "upload"
+	RouteImage   = "image"
+	RouteReport  = "report"
+)
+
+// RateLimitMiddleware 按登录用户或客户端 IP 分别限流，超出时直接拒绝而不是排队等待；
+// 需要按用户限流的路由应在认证中间件之后使用
+func (h *Handler) RateLimitMiddleware(class string) func(http.Handler) http.Handler {
+	rule := h.config.RateLimit.Rule(class)
+	rate := ratelimit.Rate{Limit: rule.Requests, Period: time.Duration(rule.Duration) * time.Second}
+	return func(next http.Handler) http.Handler {
+		if rate.Limit <= 0 || rate.Period <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := h.limiter.Allow(r.Context(), class+":"+rateLimitKey(r), rate)
+			if err != nil {
+				// Redis 不可用时放行，避免限流故障导致整站不可用
+				slog.Error("Rate limiter unavailable", "class", class, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
 				respondError(w, http.StatusTooManyRequests, "Rate limit exceeded")
 				return
 			}
@@ -57,3 +173,16 @@ func RateLimitMiddleware(limit int, duration int) func(http.Handler) http.Handle
 		})
 	}
 }
+
+// rateLimitKey 按认证后的登录用户区分调用方，未登录时按客户端 IP；
+// 不使用请求头中未经验证的值（如 X-API-Key，本服务没有 API Key 认证），避免客户端每次换一个值绕过限流
+func rateLimitKey(r *http.Request) string {
+	if userID, ok := r.Context().Value("user_id").(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + clientIP(r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
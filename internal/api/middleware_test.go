@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOptionalAuthStaleToken(t *testing.T) {
+	s := newTestServer(t, nil)
+	owner := s.login("alice")
+	public := s.upload(owner, 1, false)
+	private := s.upload(owner, 2, true)
+
+	// 用另一个会话撤销全部其他会话，revoked 成为已撤销会话的令牌
+	revoked := s.login("bob")
+	other := s.login("bob")
+	if code, resp := s.do("DELETE", "/me/sessions", other, nil); code != http.StatusOK {
+		t.Fatalf("revoke sessions: %d %v", code, resp)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		id    string
+		want  int
+	}{
+		{"valid token, private image", owner, private, http.StatusOK},
+		{"malformed token, public image", "not-a-token", public, http.StatusOK},
+		{"malformed token, private image", "not-a-token", private, http.StatusForbidden},
+		{"revoked session, public image", revoked, public, http.StatusOK},
+		{"revoked session, private image", revoked, private, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := s.do("GET", "/image/"+tt.id, tt.token, nil); code != tt.want {
+				t.Errorf("status %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/auth"
+	"github.com/notes-bin/ibed/internal/oidc"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+type oidcState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// OIDCLogin 生成 state、nonce 和 PKCE 参数后跳转到身份提供方
+func (h *Handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+
+	data, _ := json.Marshal(oidcState{Nonce: nonce, Verifier: verifier})
+	if err := h.redis.Set(r.Context(), "oidc:state:"+state, data, oidcStateTTL).Err(); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+	target, err := h.oidc.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		slog.Error("OIDC discovery failed", "error", err)
+		respondError(w, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback 校验回调并签发 ibed 令牌
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		respondError(w, http.StatusUnauthorized, "Login failed: "+e)
+		return
+	}
+	data, err := h.redis.GetDel(r.Context(), "oidc:state:"+q.Get("state")).Bytes()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid or expired state")
+		return
+	}
+	var st oidcState
+	if err := json.Unmarshal(data, &st); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid or expired state")
+		return
+	}
+
+	identity, err := h.oidc.Exchange(r.Context(), q.Get("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		slog.Error("OIDC exchange failed", "error", err)
+		respondError(w, http.StatusUnauthorized, "Login failed")
+		return
+	}
+	result, err := h.auth.LoginExternal(r.Context(), identity, clientInfo(r), time.Duration(h.config.OIDC.TokenTTL)*time.Second)
+	if respondRestricted(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, auth.ErrRegistrationClosed):
+		respondError(w, http.StatusForbidden, "Registration disabled")
+		return
+	case errors.Is(err, auth.ErrAccountPending):
+		respondError(w, http.StatusForbidden, "Account pending approval")
+		return
+	}
+	if err != nil {
+		slog.Error("OIDC login failed", "error", err)
+		respondError(w, http.StatusInternalServerError, "Login failed")
+		return
+	}
+
+	if redirect := h.config.OIDC.PostLoginRedirect; redirect != "" {
+		http.Redirect(w, r, redirect+"#token="+url.QueryEscape(result.Token), http.StatusFound)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// orgRole 返回当前用户在组织中的角色；拥有 manage_users 权限的管理员对已存在的组织视为所有者
+func (h *Handler) orgRole(r *http.Request, orgID string) (model.OrgRole, error) {
+	if can(r, model.PermManageUsers) {
+		org, err := h.redis.GetOrg(r.Context(), orgID)
+		if err != nil || org == nil {
+			return "", err
+		}
+		return model.OrgOwner, nil
+	}
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID == "" {
+		return "", nil
+	}
+	return h.redis.OrgRole(r.Context(), orgID, userID)
+}
+
+// currentOrgs 返回当前用户加入的组织及角色，未登录时为空
+func (h *Handler) currentOrgs(r *http.Request) map[string]model.OrgRole {
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID == "" {
+		return map[string]model.OrgRole{}
+	}
+	orgs, err := h.redis.UserOrgs(r.Context(), userID)
+	if err != nil {
+		return map[string]model.OrgRole{}
+	}
+	return orgs
+}
+
+// loadOrg 读取路径中的组织并要求当前用户的角色不低于 min。
+// 非成员返回 404，角色不足返回 403，失败时已写入响应并返回 nil。
+func (h *Handler) loadOrg(w http.ResponseWriter, r *http.Request, min model.OrgRole) (*model.Org, model.OrgRole) {
+	orgID := chi.URLParam(r, "id")
+	role, err := h.orgRole(r, orgID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load organization")
+		return nil, ""
+	}
+	if role == "" {
+		respondError(w, http.StatusNotFound, "Organization not found")
+		return nil, ""
+	}
+	if !role.AtLeast(min) {
+		respondError(w, http.StatusForbidden, "Permission denied")
+		return nil, ""
+	}
+	org, err := h.redis.GetOrg(r.Context(), orgID)
+	if err != nil || org == nil {
+		respondError(w, http.StatusNotFound, "Organization not found")
+		return nil, ""
+	}
+	return org, role
+}
+
+// canViewPrivate 判断当前用户能否查看私有图片：本人上传的个人图片、所属组织的图片或拥有 view_private 权限
+func canViewPrivate(r *http.Request, img *model.Image, orgs map[string]model.OrgRole) bool {
+	if can(r, model.PermViewPrivate) {
+		return true
+	}
+	if img.OrgID != "" {
+		return orgs[img.OrgID] != ""
+	}
+	userID, _ := r.Context().Value("user_id").(string)
+	return userID != "" && img.UserID == userID
+}
+
+// imageVisible 判断当前用户能否看到图片：私有、被审核隐藏或尚未发布的图片按 canViewPrivate 判断，
+// 并排除因上传者被暂停或封禁而隐藏的图片
+func (h *Handler) imageVisible(r *http.Request, img *model.Image, orgs map[string]model.OrgRole) bool {
+	if (img.IsPrivate || img.Hidden || !img.Published()) && !canViewPrivate(r, img, orgs) {
+		return false
+	}
+	return !h.imageHidden(r, img)
+}
+
+// canDeleteImage 判断当前用户能否删除图片：本人上传的个人图片、组织的编辑者或所有者，或拥有 delete_any 权限
+func canDeleteImage(r *http.Request, img *model.Image, orgs map[string]model.OrgRole) bool {
+	if can(r, model.PermDeleteAny) {
+		return true
+	}
+	if img.OrgID != "" {
+		return orgs[img.OrgID].AtLeast(model.OrgEditor)
+	}
+	return img.UserID == r.Context().Value("user_id").(string)
+}
+
+// orgWithRole 组织及当前用户的角色
+type orgWithRole struct {
+	*model.Org
+	Role model.OrgRole `json:"role"`
+}
+
+// CreateOrg 创建组织，创建者成为所有者
+func (h *Handler) CreateOrg(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	org := &model.Org{
+		ID:        uuid.NewString(),
+		Name:      strings.TrimSpace(req.Name),
+		CreatedBy: r.Context().Value("user_id").(string),
+		CreatedAt: time.Now(),
+	}
+	if err := h.redis.CreateOrg(r.Context(), org); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create organization")
+		return
+	}
+	respondJSON(w, http.StatusOK, orgWithRole{Org: org, Role: model.OrgOwner})
+}
+
+// ListOrgs 返回当前用户加入的组织
+func (h *Handler) ListOrgs(w http.ResponseWriter, r *http.Request) {
+	orgs, err := h.redis.UserOrgs(r.Context(), r.Context().Value("user_id").(string))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list organizations")
+		return
+	}
+	result := []orgWithRole{}
+	for id, role := range orgs {
+		org, err := h.redis.GetOrg(r.Context(), id)
+		if err != nil || org == nil {
+			continue
+		}
+		result = append(result, orgWithRole{Org: org, Role: role})
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// GetOrg 返回组织信息和成员列表，组织成员可查看
+func (h *Handler) GetOrg(w http.ResponseWriter, r *http.Request) {
+	org, role := h.loadOrg(w, r, model.OrgViewer)
+	if org == nil {
+		return
+	}
+	members, err := h.redis.OrgMembers(r.Context(), org.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list members")
+		return
+	}
+	list := []model.OrgMember{}
+	for userID, memberRole := range members {
+		member := model.OrgMember{UserID: userID, Role: memberRole}
+		if user, err := h.redis.GetUser(r.Context(), userID); err == nil && user != nil {
+			member.Username = user.Username
+		}
+		list = append(list, member)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"org":     orgWithRole{Org: org, Role: role},
+		"members": list,
+	})
+}
+
+// DeleteOrg 删除组织，组织名下仍有图片时拒绝
+func (h *Handler) DeleteOrg(w http.ResponseWriter, r *http.Request) {
+	org, _ := h.loadOrg(w, r, model.OrgOwner)
+	if org == nil {
+		return
+	}
+	count, err := h.redis.CountOrgImages(r.Context(), org.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete organization")
+		return
+	}
+	if count > 0 {
+		respondError(w, http.StatusConflict, "Organization still has images")
+		return
+	}
+	if err := h.redis.DeleteOrg(r.Context(), org.ID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete organization")
+		return
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditOrgDelete, Target: org.ID,
+		Details: map[string]string{"name": org.Name}})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Organization deleted"})
+}
+
+// SetOrgMember 添加成员或修改成员角色，仅所有者可操作
+func (h *Handler) SetOrgMember(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role model.OrgRole `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Role.Valid() {
+		respondError(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+	org, _ := h.loadOrg(w, r, model.OrgOwner)
+	if org == nil {
+		return
+	}
+	userID := chi.URLParam(r, "user_id")
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil || user.Status == model.StatusDeleting {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if req.Role != model.OrgOwner && !h.keepsOwner(w, r, org.ID, userID) {
+		return
+	}
+	if err := h.redis.SetOrgMember(r.Context(), org.ID, userID, req.Role); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to set member")
+		return
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditOrgMember, Target: userID,
+		Details: map[string]string{"org_id": org.ID, "role": string(req.Role)}})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Member updated"})
+}
+
+// RemoveOrgMember 移除成员；所有者可移除任何成员，成员可以退出组织
+func (h *Handler) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "user_id")
+	min := model.OrgOwner
+	if userID == r.Context().Value("user_id").(string) {
+		min = model.OrgViewer
+	}
+	org, _ := h.loadOrg(w, r, min)
+	if org == nil {
+		return
+	}
+	if !h.keepsOwner(w, r, org.ID, userID) {
+		return
+	}
+	removed, err := h.redis.RemoveOrgMember(r.Context(), org.ID, userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+	if !removed {
+		respondError(w, http.StatusNotFound, "Member not found")
+		return
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditOrgMember, Target: userID,
+		Details: map[string]string{"org_id": org.ID, "removed": "true"}})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Member removed"})
+}
+
+// keepsOwner 检查移除或降级 userID 后组织仍有所有者，否则返回 409
+func (h *Handler) keepsOwner(w http.ResponseWriter, r *http.Request, orgID, userID string) bool {
+	members, err := h.redis.OrgMembers(r.Context(), orgID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list members")
+		return false
+	}
+	if members[userID] != model.OrgOwner {
+		return true
+	}
+	for id, role := range members {
+		if id != userID && role == model.OrgOwner {
+			return true
+		}
+	}
+	respondError(w, http.StatusConflict, "Organization must keep at least one owner")
+	return false
+}
+
+// ListOrgImages 返回组织名下的图片，组织成员可查看
+func (h *Handler) ListOrgImages(w http.ResponseWriter, r *http.Request) {
+	org, _ := h.loadOrg(w, r, model.OrgViewer)
+	if org == nil {
+		return
+	}
+	ids, err := h.redis.OrgImageIDs(r.Context(), org.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list images")
+		return
+	}
+	images := []*model.Image{}
+	for _, id := range ids {
+		if img, err := h.redis.GetImage(r.Context(), id); err == nil && img != nil {
+			images = append(images, img)
+		}
+	}
+	respondJSON(w, http.StatusOK, images)
+}
+
+// ListOrgAlbums 返回组织的相册，组织成员可查看
+func (h *Handler) ListOrgAlbums(w http.ResponseWriter, r *http.Request) {
+	org, _ := h.loadOrg(w, r, model.OrgViewer)
+	if org == nil {
+		return
+	}
+	albums, err := h.redis.OrgAlbums(r.Context(), org.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list albums")
+		return
+	}
+	respondJSON(w, http.StatusOK, albums)
+}
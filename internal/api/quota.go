@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultQuota 未单独设置配额的用户使用的配额
+func (h *Handler) defaultQuota() model.Quota {
+	return model.Quota{MaxBytes: h.config.Quota.MaxBytes, MaxImages: h.config.Quota.MaxImages}
+}
+
+// defaultOrgQuota 未单独设置配额的组织使用的配额
+func (h *Handler) defaultOrgQuota() model.Quota {
+	return model.Quota{MaxBytes: h.config.OrgQuota.MaxBytes, MaxImages: h.config.OrgQuota.MaxImages}
+}
+
+// reserveQuota 占用图片所属用户或组织的配额
+func (h *Handler) reserveQuota(ctx context.Context, img *model.Image, size int64, quota model.Quota) error {
+	if img.OrgID != "" {
+		return h.redis.ReserveOrgQuota(ctx, img.OrgID, size, quota)
+	}
+	return h.redis.ReserveQuota(ctx, img.UserID, size, quota)
+}
+
+// releaseQuota 归还图片所属用户或组织的配额
+func (h *Handler) releaseQuota(ctx context.Context, img *model.Image, size int64) {
+	var err error
+	if img.OrgID != "" {
+		err = h.redis.ReleaseOrgQuota(ctx, img.OrgID, size)
+	} else {
+		err = h.redis.ReleaseQuota(ctx, img.UserID, size)
+	}
+	if err != nil {
+		slog.Error("Failed to release quota", "user_id", img.UserID, "org_id", img.OrgID, "error", err)
+	}
+}
+
+// uploadUsage 返回上传目标的用量：org_id 为空时为当前用户，否则要求是组织的编辑者或所有者。
+// 失败时已写入响应并返回 nil。
+func (h *Handler) uploadUsage(w http.ResponseWriter, r *http.Request, orgID string) *model.Usage {
+	var usage *model.Usage
+	var err error
+	if orgID == "" {
+		usage, err = h.redis.GetUsage(r.Context(), r.Context().Value("user_id").(string), h.defaultQuota())
+	} else {
+		var role model.OrgRole
+		if role, err = h.orgRole(r, orgID); err == nil && !role.AtLeast(model.OrgEditor) {
+			respondError(w, http.StatusForbidden, "Not an editor of the organization")
+			return nil
+		}
+		if err == nil {
+			usage, err = h.redis.GetOrgUsage(r.Context(), orgID, h.defaultOrgQuota())
+		}
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load quota")
+		return nil
+	}
+	return usage
+}
+
+// exceedsQuota 判断再增加 bytes 字节、images 张图片后是否超出配额
+func exceedsQuota(usage *model.Usage, bytes, images int64) bool {
+	if usage.Quota.MaxBytes > 0 && usage.Bytes+bytes > usage.Quota.MaxBytes {
+		return true
+	}
+	return usage.Quota.MaxImages > 0 && usage.Images+images > usage.Quota.MaxImages
+}
+
+// GetUsage 返回当前用户的存储用量和配额
+func (h *Handler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	usage, err := h.redis.GetUsage(r.Context(), userID, h.defaultQuota())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load usage")
+		return
+	}
+	respondJSON(w, http.StatusOK, usage)
+}
+
+func (h *Handler) GetUserQuota(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	usage, err := h.redis.GetUsage(r.Context(), userID, h.defaultQuota())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load usage")
+		return
+	}
+	respondJSON(w, http.StatusOK, usage)
+}
+
+// SetUserQuota 为指定用户单独设置配额
+func (h *Handler) SetUserQuota(w http.ResponseWriter, r *http.Request) {
+	var req model.Quota
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MaxBytes < 0 || req.MaxImages < 0 {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	userID := chi.URLParam(r, "id")
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err := h.redis.SetQuota(r.Context(), userID, req); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to set quota")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Quota updated"})
+}
+
+// ResetUserQuota 恢复指定用户为默认配额
+func (h *Handler) ResetUserQuota(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if err := h.redis.ResetQuota(r.Context(), userID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to reset quota")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Quota reset"})
+}
+
+// GetOrgUsage 返回组织的存储用量和配额，组织成员可查看
+func (h *Handler) GetOrgUsage(w http.ResponseWriter, r *http.Request) {
+	org, _ := h.loadOrg(w, r, model.OrgViewer)
+	if org == nil {
+		return
+	}
+	usage, err := h.redis.GetOrgUsage(r.Context(), org.ID, h.defaultOrgQuota())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load usage")
+		return
+	}
+	respondJSON(w, http.StatusOK, usage)
+}
+
+// SetOrgQuota 为指定组织单独设置配额
+func (h *Handler) SetOrgQuota(w http.ResponseWriter, r *http.Request) {
+	var req model.Quota
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MaxBytes < 0 || req.MaxImages < 0 {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	orgID := chi.URLParam(r, "id")
+	org, err := h.redis.GetOrg(r.Context(), orgID)
+	if err != nil || org == nil {
+		respondError(w, http.StatusNotFound, "Organization not found")
+		return
+	}
+	if err := h.redis.SetOrgQuota(r.Context(), orgID, req); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to set quota")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Quota updated"})
+}
+
+// ResetOrgQuota 恢复指定组织为默认配额
+func (h *Handler) ResetOrgQuota(w http.ResponseWriter, r *http.Request) {
+	if err := h.redis.ResetOrgQuota(r.Context(), chi.URLParam(r, "id")); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to reset quota")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Quota reset"})
+}
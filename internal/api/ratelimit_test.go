@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/config"
+)
+
+func TestRateLimitIgnoresUnverifiedAPIKey(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimit.Classes = map[string]config.RateLimitRule{"login": {Requests: 3, Duration: 60}}
+	})
+	limited := false
+	for i := 0; i < 5; i++ {
+		code, _ := s.do("POST", "/login", "", map[string]string{"username": "eve", "password": "x"}, "X-API-Key", fmt.Sprint("random-", i))
+		if code == http.StatusTooManyRequests {
+			limited = true
+		}
+	}
+	if !limited {
+		t.Fatal("random X-API-Key values bypassed the login limit")
+	}
+}
+
+func TestRateLimitClasses(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		requests int
+		wantCode int
+	}{
+		// image 类别的配额高于默认规则，不应被默认规则限制
+		{"image uses its own class", "/image/missing", 8, http.StatusNotFound},
+		{"default class applies elsewhere", "/top", 8, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.RateLimit.Requests, cfg.RateLimit.Duration = 5, 60
+				cfg.RateLimit.Classes = map[string]config.RateLimitRule{"image": {Requests: 100, Duration: 60}}
+			})
+			var code int
+			for i := 0; i < tt.requests; i++ {
+				code, _ = s.do("GET", tt.path, "", nil)
+			}
+			if code != tt.wantCode {
+				t.Errorf("last status = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRateLimitKeysAuthenticatedUsers(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimit.Requests, cfg.RateLimit.Duration = 3, 60
+	})
+	alice, bob := s.login("alice"), s.login("bob")
+	for i := 0; i < 3; i++ {
+		s.do("GET", "/me/usage", alice, nil)
+	}
+	if code, _ := s.do("GET", "/me/usage", alice, nil); code != http.StatusTooManyRequests {
+		t.Errorf("alice over limit: status %d, want 429", code)
+	}
+	if code, _ := s.do("GET", "/me/usage", bob, nil); code != http.StatusOK {
+		t.Errorf("bob from the same IP: status %d, want 200", code)
+	}
+}
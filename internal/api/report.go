@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// 举报说明的最大长度
+const maxReportComment = 500
+
+// ReportImage 举报图片，未登录或 anonymous 为 true 时不记录举报人；
+// 同一用户（未登录时按 IP）对同一图片只能举报一次，举报数达到阈值时自动隐藏图片
+func (h *Handler) ReportImage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason    model.ReportReason `json:"reason"`
+		Comment   string             `json:"comment"`
+		Anonymous bool               `json:"anonymous"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Comment) > maxReportComment {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if !req.Reason.Valid() {
+		respondError(w, http.StatusBadRequest, "Invalid reason")
+		return
+	}
+
+	img, err := h.redis.GetImage(r.Context(), chi.URLParam(r, "id"))
+	if err != nil || img == nil || !h.imageVisible(r, img, h.currentOrgs(r)) {
+		respondError(w, http.StatusNotFound, "Image not found")
+		return
+	}
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID != "" && userID == img.UserID {
+		respondError(w, http.StatusBadRequest, "Cannot report your own image")
+		return
+	}
+
+	report := &model.Report{
+		ID:        uuid.NewString(),
+		ImageID:   img.ID,
+		Reason:    req.Reason,
+		Comment:   req.Comment,
+		CreatedAt: time.Now(),
+	}
+	// 未登录时按来源地址去重；登录用户按用户去重，同时标记来源地址，退出登录后不能再匿名重复举报
+	reporter, also := h.addressReporter(r), []string(nil)
+	if userID != "" {
+		reporter, also = "user:"+userID, []string{reporter}
+		if !req.Anonymous {
+			report.ReporterID = userID
+		}
+	}
+	count, err := h.redis.AddReport(r.Context(), report, reporter, also...)
+	if err == redis.ErrAlreadyReported {
+		respondError(w, http.StatusConflict, "Already reported")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to submit report")
+		return
+	}
+
+	if threshold := h.config.Moderation.AutoHideReports; threshold > 0 && count >= int64(threshold) {
+		// 重新读取并在事务中隐藏，避免覆盖举报期间对图片的其他修改
+		hidden, err := h.redis.HideImage(r.Context(), img.ID)
+		if err != nil {
+			slog.Error("Failed to hide reported image", "image_id", img.ID, "error", err)
+		} else if hidden != nil {
+			h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditImageAutoHide, Target: hidden.ID,
+				Details: map[string]string{"owner": hidden.UserID, "reports": strconv.FormatInt(count, 10)}})
+			h.notifyUploader(r.Context(), hidden, "Your image has been hidden",
+				fmt.Sprintf("Your image %s received %d reports and has been hidden until a moderator reviews it.", hidden.ID, count))
+		}
+	}
+	respondJSON(w, http.StatusAccepted, map[string]string{"message": "Report submitted"})
+}
+
+// addressReporter 返回来源地址的举报去重标识。IPv6 地址按 /64 前缀归并，避免轮换同一网段内的地址重复举报；
+// 使用以 JWT 密钥为键的 HMAC，存储的标识不能通过枚举地址反查
+func (h *Handler) addressReporter(r *http.Request) string {
+	addr := clientIP(r)
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		addr = ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	mac := hmac.New(sha256.New, []byte(h.config.JWTSecret))
+	mac.Write([]byte(addr))
+	return "ip:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// ModerationQueue 按首次举报时间返回待审核的图片
+func (h *Handler) ModerationQueue(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	cases, err := h.redis.ModerationQueue(r.Context(), offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load moderation queue")
+		return
+	}
+	for _, mc := range cases {
+		mc.Image, _ = h.redis.GetImage(r.Context(), mc.ImageID)
+	}
+	respondJSON(w, http.StatusOK, cases)
+}
+
+// PendingImages 按上传时间返回等待发布前人工审核的图片
+func (h *Handler) PendingImages(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	ids, err := h.redis.PendingImageIDs(r.Context(), offset, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load pending images")
+		return
+	}
+	images := []*model.Image{}
+	for _, id := range ids {
+		if img, err := h.redis.GetImage(r.Context(), id); err == nil && img != nil {
+			images = append(images, img)
+		}
+	}
+	respondJSON(w, http.StatusOK, images)
+}
+
+// ImageReports 返回图片待处理的举报明细
+func (h *Handler) ImageReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := h.redis.ImageReports(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load reports")
+		return
+	}
+	respondJSON(w, http.StatusOK, reports)
+}
+
+// ModerateImage 处理举报和发布前审核：approve 驳回举报或审核通过并恢复显示，reject 审核不通过，
+// hide 隐藏图片，delete 删除图片；处理后移出审核队列并通知上传者
+func (h *Handler) ModerateImage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action string `json:"action"`
+		Note   string `json:"note"` // 附在给上传者的通知中
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	img, err := h.redis.GetImage(r.Context(), chi.URLParam(r, "id"))
+	if err != nil || img == nil {
+		respondError(w, http.StatusNotFound, "Image not found")
+		return
+	}
+
+	var subject, body string
+	switch req.Action {
+	case model.ModerationApprove:
+		if img.Hidden || !img.Published() {
+			subject, body = "Your image is now visible", fmt.Sprintf("A moderator reviewed your image %s and published it.", img.ID)
+		}
+		img.Hidden = false
+		if img.Review != "" {
+			img.Review, img.ReviewReason = model.ReviewApproved, ""
+		}
+	case model.ModerationReject:
+		img.Review, img.ReviewReason = model.ReviewRejected, req.Note
+		subject, body = "Your image was not approved", fmt.Sprintf("A moderator reviewed your image %s and did not approve it for publication.", img.ID)
+	case model.ModerationHide:
+		img.Hidden = true
+		subject, body = "Your image has been hidden", fmt.Sprintf("A moderator reviewed your image %s and hid it.", img.ID)
+	case model.ModerationDelete:
+		subject, body = "Your image has been removed", fmt.Sprintf("A moderator reviewed your image %s and removed it.", img.ID)
+	default:
+		respondError(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+
+	if req.Action == model.ModerationDelete {
+		if err := h.removeImage(r.Context(), img); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to delete image")
+			return
+		}
+	} else if err := h.redis.UpdateImage(r.Context(), img); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to update image")
+		return
+	}
+	if err := h.redis.ResolveReports(r.Context(), img.ID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to resolve reports")
+		return
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditImageModerate, Target: img.ID,
+		Details: map[string]string{"owner": img.UserID, "decision": req.Action, "note": req.Note}})
+
+	if subject != "" {
+		if req.Note != "" {
+			body += "\n\nNote from the moderator: " + req.Note
+		}
+		h.notifyUploader(r.Context(), img, subject, body)
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Image moderated"})
+}
+
+// notifyUploader 邮件通知上传者，失败只记日志
+func (h *Handler) notifyUploader(ctx context.Context, img *model.Image, subject, body string) {
+	if err := h.auth.NotifyUser(ctx, img.UserID, subject, body); err != nil {
+		slog.Error("Failed to notify uploader", "user_id", img.UserID, "image_id", img.ID, "error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/config"
+)
+
+func TestReportDedup(t *testing.T) {
+	type report struct {
+		user string // 为空表示未登录
+		ip   string
+		want int
+	}
+	tests := []struct {
+		name    string
+		reports []report
+	}{
+		{"anonymous twice from one address", []report{
+			{"", "203.0.113.1", http.StatusAccepted},
+			{"", "203.0.113.1", http.StatusConflict},
+		}},
+		{"anonymous from another address", []report{
+			{"", "203.0.113.1", http.StatusAccepted},
+			{"", "203.0.113.2", http.StatusAccepted},
+		}},
+		{"rotating addresses in one IPv6 /64", []report{
+			{"", "2001:db8::1", http.StatusAccepted},
+			{"", "2001:db8::ffff:2", http.StatusConflict},
+			{"", "2001:db8:0:1::1", http.StatusAccepted},
+		}},
+		{"logged out after reporting", []report{
+			{"bob", "203.0.113.1", http.StatusAccepted},
+			{"", "203.0.113.1", http.StatusConflict},
+		}},
+		{"different users behind one address", []report{
+			{"bob", "203.0.113.1", http.StatusAccepted},
+			{"carol", "203.0.113.1", http.StatusAccepted},
+			{"bob", "203.0.113.2", http.StatusConflict},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *config.Config) {
+				c.TrustProxy = true
+				c.Moderation.AutoHideReports = -1
+			})
+			id := s.upload(s.login("alice"), 1, false)
+			tokens := map[string]string{}
+			for i, rep := range tt.reports {
+				token := ""
+				if rep.user != "" {
+					if tokens[rep.user] == "" {
+						tokens[rep.user] = s.login(rep.user)
+					}
+					token = tokens[rep.user]
+				}
+				code, resp := s.do("POST", "/image/"+id+"/report", token, map[string]string{"reason": "spam"},
+					"X-Forwarded-For", rep.ip)
+				if code != rep.want {
+					t.Errorf("report %d: status %d %v, want %d", i, code, resp, rep.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReportAutoHide(t *testing.T) {
+	s := newTestServer(t, func(c *config.Config) {
+		c.TrustProxy = true
+		c.Moderation.AutoHideReports = 2
+	})
+	ctx := context.Background()
+	id := s.upload(s.login("alice"), 1, false)
+	s.do("POST", "/image/"+id+"/report", "", map[string]string{"reason": "spam"}, "X-Forwarded-For", "203.0.113.1")
+
+	// 举报之间上传者修改了图片
+	img, _ := s.redis.GetImage(ctx, id)
+	img.Description = "edited"
+	if err := s.redis.UpdateImage(ctx, img); err != nil {
+		t.Fatal(err)
+	}
+	s.do("POST", "/image/"+id+"/report", "", map[string]string{"reason": "spam"}, "X-Forwarded-For", "203.0.113.2")
+
+	img, _ = s.redis.GetImage(ctx, id)
+	if !img.Hidden {
+		t.Error("image not hidden at the threshold")
+	}
+	if img.Description != "edited" {
+		t.Errorf("description %q, concurrent change lost", img.Description)
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ListRoles 返回角色权限矩阵
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles := map[model.Role][]model.Permission{}
+	for _, role := range model.Roles() {
+		roles[role] = role.Permissions()
+	}
+	respondJSON(w, http.StatusOK, roles)
+}
+
+// SetUserRole 修改用户角色，新角色在用户下次获取令牌时生效
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role model.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Role.Valid() {
+		respondError(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	userID := chi.URLParam(r, "id")
+	if userID == r.Context().Value("user_id").(string) && req.Role != model.RoleAdmin {
+		respondError(w, http.StatusBadRequest, "Cannot demote yourself")
+		return
+	}
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	oldRole := user.Role
+	user.Role = req.Role
+	if err := h.redis.SaveUser(r.Context(), user); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to set role")
+		return
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditRoleChange, Target: user.ID,
+		Details: map[string]string{"from": string(oldRole), "to": string(req.Role)}})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Role updated"})
+}
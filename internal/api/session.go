@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/notes-bin/ibed/internal/auth"
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxUserAgentLength 会话中保存的 User-Agent 最大长度
+const maxUserAgentLength = 256
+
+// clientInfo 返回登录请求的客户端信息
+func clientInfo(r *http.Request) auth.ClientInfo {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return auth.ClientInfo{IP: clientIP(r), UserAgent: ua}
+}
+
+type sessionView struct {
+	*model.Session
+	Current bool `json:"current"` // 是否为发起本次请求的会话
+}
+
+// ListSessions 列出当前用户的登录会话
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	sessions, err := h.auth.ListSessions(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+	current := r.Context().Value("session_id").(string)
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, sessionView{Session: s, Current: s.ID == current})
+	}
+	respondJSON(w, http.StatusOK, views)
+}
+
+// RevokeSession 退出指定会话
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	ok, err := h.auth.RevokeSession(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	if !ok {
+		respondError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// RevokeAllSessions 退出所有设备，包括当前会话
+func (h *Handler) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	count, err := h.auth.RevokeAllSessions(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]int{"revoked": count})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// servedWriter 记录实际返回的状态码和写出的字节数，
+// 304、Range 和中途断开的请求都按真实流量统计
+type servedWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *servedWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *servedWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// served 判断是否真正返回了图片内容，304 等不计入访问
+func (w *servedWriter) served() bool {
+	return w.status == http.StatusOK || w.status == http.StatusPartialContent
+}
+
+// recordView 记录访问统计，失败只记日志不影响图片返回
+func (h *Handler) recordView(r *http.Request, imageID string, size int64) {
+	visitor := sha256.Sum256([]byte(clientIP(r) + "|" + r.UserAgent()))
+	ev := redis.ViewEvent{
+		Visitor:  hex.EncodeToString(visitor[:16]),
+		Referrer: referrerHost(r),
+		Bytes:    size,
+	}
+	if err := h.redis.RecordImageStats(r.Context(), imageID, ev, h.config.Analytics.RetentionDays); err != nil {
+		slog.Error("Failed to record image stats", "image_id", imageID, "error", err)
+	}
+}
+
+// ImageStats 返回图片的访问统计，仅图片所有者和管理员可查看
+func (h *Handler) ImageStats(w http.ResponseWriter, r *http.Request) {
+	imageID := chi.URLParam(r, "id")
+	img, err := h.redis.GetImage(r.Context(), imageID)
+	if err != nil || img == nil {
+		respondError(w, http.StatusNotFound, "Image not found")
+		return
+	}
+
+	if !canViewPrivate(r, img, h.currentOrgs(r)) {
+		respondError(w, http.StatusForbidden, "Unauthorized")
+		return
+	}
+
+	// 默认最近 7 天，最长不超过统计保留期
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to, from := today, today.AddDate(0, 0, -6)
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid to date")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid from date")
+			return
+		}
+	} else {
+		from = to.AddDate(0, 0, -6)
+	}
+	if from.After(to) {
+		respondError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+	if to.Sub(from) > time.Duration(h.config.Analytics.RetentionDays)*24*time.Hour {
+		respondError(w, http.StatusBadRequest, "Date range exceeds retention")
+		return
+	}
+
+	stats, err := h.redis.GetImageStats(r.Context(), imageID, from, to)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load stats")
+		return
+	}
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// clientIP 返回请求方 IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// referrerHost 提取来源站点域名，没有来源时记为 direct
+func referrerHost(r *http.Request) string {
+	ref := r.Referer()
+	if ref == "" {
+		return "direct"
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
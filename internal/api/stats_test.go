@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetImageRecordsServedBytes(t *testing.T) {
+	s := newTestServer(t, nil)
+	id := s.upload(s.login("alice"), 1, false)
+
+	fetch := func(header ...string) (int, int64, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", s.srv.URL+"/image/"+id, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		n, _ := io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, n, resp.Header.Get("Last-Modified")
+	}
+
+	code, size, modified := fetch()
+	if code != http.StatusOK || size == 0 {
+		t.Fatalf("full GET = %d (%d bytes)", code, size)
+	}
+
+	tests := []struct {
+		name   string
+		header []string
+		code   int
+		views  int64
+		bytes  int64
+	}{
+		{"not modified", []string{"If-Modified-Since", modified}, http.StatusNotModified, 1, size},
+		{"range", []string{"Range", "bytes=0-3"}, http.StatusPartialContent, 2, size + 4},
+		{"full", nil, http.StatusOK, 3, 2*size + 4},
+	}
+	for _, tt := range tests {
+		if code, _, _ := fetch(tt.header...); code != tt.code {
+			t.Fatalf("%s: status = %d, want %d", tt.name, code, tt.code)
+		}
+		today := time.Now().UTC()
+		stats, err := s.redis.GetImageStats(context.Background(), id, today, today)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalViews != tt.views || stats.Views != tt.views || stats.BytesServed != tt.bytes {
+			t.Errorf("%s: total/views/bytes = %d/%d/%d, want %d/%d/%d", tt.name,
+				stats.TotalViews, stats.Views, stats.BytesServed, tt.views, tt.views, tt.bytes)
+		}
+	}
+}
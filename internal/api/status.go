@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/auth"
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SetUserStatus 暂停、只读、封禁或恢复账户，可设置原因、有效期和是否隐藏公开图片
+func (h *Handler) SetUserStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status     model.UserStatus `json:"status"`
+		Reason     string           `json:"reason"`
+		ExpiresIn  int64            `json:"expires_in"` // 秒，0 表示不过期
+		HideImages bool             `json:"hide_images"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ExpiresIn < 0 {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if !req.Status.Moderated() {
+		respondError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	operator := r.Context().Value("user_id").(string)
+	userID := chi.URLParam(r, "id")
+	if userID == operator {
+		respondError(w, http.StatusBadRequest, "Cannot change your own status")
+		return
+	}
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if !user.Status.Moderated() {
+		respondError(w, http.StatusConflict, "User is "+string(user.Status))
+		return
+	}
+
+	change := auth.StatusChange{Status: req.Status, Reason: req.Reason, HideImages: req.HideImages}
+	if req.ExpiresIn > 0 {
+		change.ExpiresAt = time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+	}
+	if err := h.auth.SetStatus(r.Context(), user, change, operator); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to set status")
+		return
+	}
+	respondJSON(w, http.StatusOK, user.Sanitized())
+}
+
+// RequireWritable 拒绝只读账户修改内容的请求
+func (h *Handler) RequireWritable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentStatus(r) == model.StatusReadOnly {
+			respondError(w, http.StatusForbidden, "Account is read-only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentStatus 返回当前请求用户生效的账户状态，未登录时为空
+func currentStatus(r *http.Request) model.UserStatus {
+	status, _ := r.Context().Value("status").(model.UserStatus)
+	return status
+}
+
+// respondRestricted 账户被暂停或封禁时返回 403 及原因，其他错误返回 false
+func respondRestricted(w http.ResponseWriter, err error) bool {
+	var restricted *auth.RestrictedError
+	if !errors.As(err, &restricted) {
+		return false
+	}
+	resp := map[string]interface{}{
+		"error":  "Account " + string(restricted.Status),
+		"status": restricted.Status,
+	}
+	if restricted.Reason != "" {
+		resp["reason"] = restricted.Reason
+	}
+	if restricted.ExpiresAt != nil {
+		resp["expires_at"] = restricted.ExpiresAt
+	}
+	respondJSON(w, http.StatusForbidden, resp)
+	return true
+}
+
+// imageHidden 判断图片是否因上传者被暂停或封禁而对他人隐藏，本人和可查看私有图片的用户不受影响；
+// 组织图片不随上传者隐藏
+func (h *Handler) imageHidden(r *http.Request, img *model.Image) bool {
+	if img.OrgID != "" {
+		return false
+	}
+	if userID, _ := r.Context().Value("user_id").(string); userID == img.UserID || can(r, model.PermViewPrivate) {
+		return false
+	}
+	hidden, err := h.redis.UserImagesHidden(r.Context(), img.UserID)
+	if err != nil {
+		slog.Error("Failed to check hidden images", "user_id", img.UserID, "error", err)
+		return false
+	}
+	return hidden
+}
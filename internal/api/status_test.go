@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestAccountStatusEnforced(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name       string
+		status     model.UserStatus
+		expiresAt  *time.Time
+		wantRead   int // GET /me/usage，经过 AuthMiddleware
+		wantUpload int // POST /upload，经过 RequirePermission（空请求体在通过时返回 400）
+		wantDelete int // DELETE /image/{id}，经过 RequireWritable
+	}{
+		{"active", model.StatusActive, nil, http.StatusOK, http.StatusBadRequest, http.StatusOK},
+		{"suspended", model.StatusSuspended, nil, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+		{"banned", model.StatusBanned, &future, http.StatusForbidden, http.StatusForbidden, http.StatusForbidden},
+		{"read only", model.StatusReadOnly, nil, http.StatusOK, http.StatusForbidden, http.StatusForbidden},
+		{"expired suspension", model.StatusSuspended, &past, http.StatusOK, http.StatusBadRequest, http.StatusOK},
+		{"expired read only", model.StatusReadOnly, &past, http.StatusOK, http.StatusBadRequest, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			token := s.login("alice")
+			id := s.upload(token, 1, false)
+
+			// 直接修改状态而不撤销会话，确认已签发的令牌在每次请求时都会检查状态
+			ctx := context.Background()
+			user, _ := s.redis.GetUserByUsername(ctx, "alice")
+			user.Status, user.StatusExpiresAt = tt.status, tt.expiresAt
+			if err := s.redis.SaveUser(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+
+			code, resp := s.do("GET", "/me/usage", token, nil)
+			if code != tt.wantRead {
+				t.Errorf("read: status %d, want %d (%v)", code, tt.wantRead, resp)
+			}
+			if code == http.StatusForbidden && resp["status"] != string(tt.status) {
+				t.Errorf("read: body %v, want status %s", resp, tt.status)
+			}
+			if code, resp := s.do("POST", "/upload", token, nil); code != tt.wantUpload {
+				t.Errorf("upload: status %d, want %d (%v)", code, tt.wantUpload, resp)
+			}
+			if code, resp := s.do("DELETE", "/image/"+id, token, nil); code != tt.wantDelete {
+				t.Errorf("delete: status %d, want %d (%v)", code, tt.wantDelete, resp)
+			}
+		})
+	}
+}
+
+func TestSetUserStatusHidesImages(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        map[string]interface{}
+		wantExpiry  bool
+		wantPublic  int // 匿名访问图片
+		wantAdmin   int // 管理员访问图片
+		wantRevoked bool
+	}{
+		{"suspend without hiding", map[string]interface{}{"status": "suspended"}, false, http.StatusOK, http.StatusOK, true},
+		{"ban and hide", map[string]interface{}{"status": "banned", "hide_images": true, "expires_in": 3600}, true, http.StatusNotFound, http.StatusOK, true},
+		{"read only cannot hide", map[string]interface{}{"status": "read_only", "hide_images": true}, false, http.StatusOK, http.StatusOK, false},
+		{"active", map[string]interface{}{"status": "active", "hide_images": true, "expires_in": 3600}, false, http.StatusOK, http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			adminToken, _ := s.admin("root")
+			token := s.login("alice")
+			id := s.upload(token, 1, false)
+			alice, _ := s.redis.GetUserByUsername(context.Background(), "alice")
+
+			code, resp := s.do("PUT", "/users/"+alice.ID+"/status", adminToken, tt.body)
+			if code != http.StatusOK {
+				t.Fatalf("set status: %d %v", code, resp)
+			}
+			// 没有到期时间时不返回 status_expires_at
+			if _, ok := resp["status_expires_at"]; ok != tt.wantExpiry {
+				t.Errorf("status_expires_at present = %v, want %v (%v)", ok, tt.wantExpiry, resp)
+			}
+			if code, _ := s.do("GET", "/image/"+id, "", nil); code != tt.wantPublic {
+				t.Errorf("anonymous view: %d, want %d", code, tt.wantPublic)
+			}
+			if code, _ := s.do("GET", "/image/"+id, adminToken, nil); code != tt.wantAdmin {
+				t.Errorf("admin view: %d, want %d", code, tt.wantAdmin)
+			}
+			code, _ = s.do("GET", "/me/usage", token, nil)
+			if revoked := code == http.StatusUnauthorized; revoked != tt.wantRevoked {
+				t.Errorf("session revoked = %v (status %d), want %v", revoked, code, tt.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestReactivateUnhidesImages(t *testing.T) {
+	s := newTestServer(t, nil)
+	adminToken, _ := s.admin("root")
+	id := s.upload(s.login("alice"), 1, false)
+	alice, _ := s.redis.GetUserByUsername(context.Background(), "alice")
+
+	steps := []struct {
+		status     string
+		wantPublic int
+	}{
+		{"suspended", http.StatusNotFound},
+		{"active", http.StatusOK},
+	}
+	for _, step := range steps {
+		body := map[string]interface{}{"status": step.status, "hide_images": true}
+		if code, resp := s.do("PUT", "/users/"+alice.ID+"/status", adminToken, body); code != http.StatusOK {
+			t.Fatalf("set %s: %d %v", step.status, code, resp)
+		}
+		if code, _ := s.do("GET", "/image/"+id, "", nil); code != step.wantPublic {
+			t.Errorf("%s: anonymous view %d, want %d", step.status, code, step.wantPublic)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/notes-bin/ibed/internal/auth"
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// LoginTwoFactor 使用登录返回的挑战和验证码（或恢复码）换取令牌
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == "" || req.Code == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	result, err := h.auth.CompleteLogin(r.Context(), req.Challenge, req.Code, clientInfo(r))
+	if err != nil {
+		if respondRestricted(w, err) {
+			return
+		}
+		respondTwoFactorError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// EnrollTwoFactor 生成新的 TOTP 密钥、otpauth URI 和二维码
+func (h *Handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	user, err := h.redis.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	enrollment, err := h.auth.BeginTOTPEnrollment(r.Context(), user)
+	if err != nil {
+		respondTwoFactorError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, enrollment)
+}
+
+// ActivateTwoFactor 验证首个验证码后启用两步验证，并返回恢复码
+func (h *Handler) ActivateTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	codes, err := h.auth.ActivateTOTP(r.Context(), userID, req.Code)
+	if err != nil {
+		respondTwoFactorError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	if err := h.auth.DisableTOTP(r.Context(), userID, req.Password, req.Code); err != nil {
+		h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditTwoFactorOff, Target: userID, Outcome: model.AuditFailure,
+			Details: map[string]string{"error": err.Error()}})
+		respondTwoFactorError(w, err)
+		return
+	}
+	h.audit.Record(r.Context(), model.AuditEvent{Action: model.AuditTwoFactorOff, Target: userID})
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	codes, err := h.auth.RegenerateRecoveryCodes(r.Context(), userID, req.Code)
+	if err != nil {
+		respondTwoFactorError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+func respondTwoFactorError(w http.ResponseWriter, err error) {
+	var locked *auth.LockedError
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(locked.RetryAfter)))
+		respondError(w, http.StatusTooManyRequests, "Too many failed attempts, try again later")
+	case errors.Is(err, auth.ErrInvalidCode), errors.Is(err, auth.ErrInvalidCredentials):
+		respondError(w, http.StatusUnauthorized, "Invalid code or password")
+	case errors.Is(err, auth.ErrChallengeExpired):
+		respondError(w, http.StatusUnauthorized, "Challenge expired")
+	case errors.Is(err, auth.ErrTOTPAlreadyActive), errors.Is(err, auth.ErrTOTPNotEnabled), errors.Is(err, auth.ErrNoPendingTOTP):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "Two-factor operation failed")
+	}
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+)
+
+const (
+	// batchSize 每次从 stream 读取的条目数
+	batchSize = 500
+	// maxScan 单次查询最多检查的条目数，条件过于稀疏时提前返回游标
+	maxScan = 20000
+)
+
+// ErrInvalidCursor 查询游标格式错误
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Logger 将安全和管理操作写入 Redis stream 作为审计日志
+type Logger struct {
+	redis     *redis.Client
+	retention time.Duration
+}
+
+func New(redis *redis.Client, cfg config.AuditConfig) *Logger {
+	return &Logger{redis: redis, retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour}
+}
+
+// Record 写入一条审计记录。未填写的操作者、IP 和请求 ID 从请求上下文中读取，结果默认为 success；
+// 写入失败只记录错误日志，不影响业务操作
+func (l *Logger) Record(ctx context.Context, e model.AuditEvent) {
+	e.Time = time.Now()
+	if e.ActorID == "" {
+		e.ActorID, _ = ctx.Value("user_id").(string)
+	}
+	if e.Actor == "" {
+		e.Actor, _ = ctx.Value("username").(string)
+	}
+	if e.IP == "" {
+		e.IP, _ = ctx.Value("client_ip").(string)
+	}
+	if e.RequestID == "" {
+		e.RequestID, _ = ctx.Value("request_id").(string)
+	}
+	if e.Outcome == "" {
+		e.Outcome = model.AuditSuccess
+	}
+
+	slog.Info("Audit", "action", e.Action, "actor_id", e.ActorID, "actor", e.Actor, "target", e.Target,
+		"ip", e.IP, "request_id", e.RequestID, "outcome", e.Outcome, "details", e.Details)
+	if _, err := l.redis.AppendAudit(context.WithoutCancel(ctx), &e, l.retention); err != nil {
+		slog.Error("Failed to write audit log", "action", e.Action, "error", err)
+	}
+}
+
+// Query 从新到旧返回满足条件的记录，cursor 为上一页返回的游标；
+// 返回的游标为空表示没有更多记录
+func (l *Logger) Query(ctx context.Context, f model.AuditFilter, cursor string, limit int) ([]*model.AuditEvent, string, error) {
+	start, end := "-", "+"
+	if !f.Since.IsZero() {
+		start = redis.AuditStreamID(f.Since, false)
+	}
+	if !f.Until.IsZero() {
+		end = redis.AuditStreamID(f.Until, true)
+	}
+	if cursor != "" {
+		var err error
+		if end, err = redis.AuditNextID(cursor, true); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	events := []*model.AuditEvent{}
+	for scanned := 0; scanned < maxScan; {
+		batch, err := l.redis.AuditRange(ctx, start, end, batchSize, true)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, e := range batch {
+			scanned++
+			if f.Match(e) {
+				events = append(events, e)
+				if len(events) == limit {
+					return events, e.ID, nil
+				}
+			}
+		}
+		if len(batch) < batchSize {
+			return events, "", nil
+		}
+		last := batch[len(batch)-1].ID
+		if end, err = redis.AuditNextID(last, true); err != nil {
+			return events, "", nil
+		}
+		cursor = last
+	}
+	return events, cursor, nil
+}
+
+// Export 从旧到新将满足条件的记录按 JSON Lines 格式写入 w
+func (l *Logger) Export(ctx context.Context, f model.AuditFilter, w io.Writer) error {
+	start, end := "-", "+"
+	if !f.Since.IsZero() {
+		start = redis.AuditStreamID(f.Since, false)
+	}
+	if !f.Until.IsZero() {
+		end = redis.AuditStreamID(f.Until, true)
+	}
+
+	enc := json.NewEncoder(w)
+	for {
+		batch, err := l.redis.AuditRange(ctx, start, end, batchSize, false)
+		if err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if f.Match(e) {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		if start, err = redis.AuditNextID(batch[len(batch)-1].ID, false); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func newTestLogger(t *testing.T) (*Logger, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := redis.NewClient(mr.Addr(), "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return New(rc, config.AuditConfig{}), rc
+}
+
+// queryAll 按 limit 逐页读取，直到游标为空
+func queryAll(t *testing.T, l *Logger, f model.AuditFilter, limit int) []*model.AuditEvent {
+	t.Helper()
+	var all []*model.AuditEvent
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > 10000 {
+			t.Fatal("too many pages")
+		}
+		events, next, err := l.Query(context.Background(), f, cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) > limit {
+			t.Fatalf("page %d has %d events, limit %d", page, len(events), limit)
+		}
+		all = append(all, events...)
+		if next == "" {
+			return all
+		}
+		cursor = next
+	}
+}
+
+// exportAll 导出并解析 JSON Lines
+func exportAll(t *testing.T, l *Logger, f model.AuditFilter) []*model.AuditEvent {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := l.Export(context.Background(), f, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var events []*model.AuditEvent
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var e model.AuditEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("invalid json line %q: %v", sc.Text(), err)
+		}
+		events = append(events, &e)
+	}
+	return events
+}
+
+func eventIDs(events []*model.AuditEvent) []string {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func reversed(ids []string) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[len(ids)-1-i] = id
+	}
+	return out
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueryAndExport(t *testing.T) {
+	ctx := context.Background()
+	l, rc := newTestLogger(t)
+	// 超过 batchSize 以覆盖跨批次读取
+	const n = 2*batchSize + 200
+	for i := 0; i < n; i++ {
+		e := model.AuditEvent{Action: model.AuditLogin, Actor: "alice", Target: fmt.Sprint(i)}
+		if i%3 == 0 {
+			e.Action, e.Actor = model.AuditRoleChange, "bob"
+		}
+		if i%7 == 0 {
+			e.Outcome = model.AuditFailure
+		}
+		l.Record(ctx, e)
+	}
+	stored, err := rc.AuditRange(ctx, "-", "+", n+1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != n {
+		t.Fatalf("stored %d events, want %d", len(stored), n)
+	}
+
+	ids := func(match func(i int) bool) []string {
+		var out []string
+		for i, e := range stored {
+			if match(i) {
+				out = append(out, e.ID)
+			}
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		filter model.AuditFilter
+		want   []string // 从旧到新
+	}{
+		{"all", model.AuditFilter{}, ids(func(int) bool { return true })},
+		{"action prefix", model.AuditFilter{Action: "user"}, ids(func(i int) bool { return i%3 == 0 })},
+		{"action exact", model.AuditFilter{Action: model.AuditLogin}, ids(func(i int) bool { return i%3 != 0 })},
+		{"actor and outcome", model.AuditFilter{Actor: "alice", Outcome: model.AuditFailure},
+			ids(func(i int) bool { return i%3 != 0 && i%7 == 0 })},
+		{"target", model.AuditFilter{Target: "42"}, ids(func(i int) bool { return i == 42 })},
+		{"no match", model.AuditFilter{Actor: "carol"}, nil},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{1, 37, batchSize, n} {
+			if limit == 1 && len(tt.want) > 100 {
+				continue
+			}
+			got := eventIDs(queryAll(t, l, tt.filter, limit))
+			if !equalIDs(got, reversed(tt.want)) {
+				t.Errorf("%s limit %d: query got %d events, want %d in reverse order", tt.name, limit, len(got), len(tt.want))
+			}
+		}
+		got := exportAll(t, l, tt.filter)
+		if !equalIDs(eventIDs(got), tt.want) {
+			t.Errorf("%s: export got %d events, want %d in order", tt.name, len(got), len(tt.want))
+		}
+	}
+
+	first := exportAll(t, l, model.AuditFilter{Target: "0"})
+	if len(first) != 1 || first[0].Action != model.AuditRoleChange || first[0].Actor != "bob" ||
+		first[0].Outcome != model.AuditFailure || first[0].Time.IsZero() {
+		t.Errorf("exported event = %+v", first)
+	}
+}
+
+func TestQueryTimeRange(t *testing.T) {
+	ctx := context.Background()
+	l, _ := newTestLogger(t)
+	// stream ID 以毫秒为单位，窗口之间间隔数毫秒
+	record := func(target string) {
+		l.Record(ctx, model.AuditEvent{Action: model.AuditLogin, Target: target})
+		time.Sleep(3 * time.Millisecond)
+	}
+	record("a1")
+	record("a2")
+	since := time.Now()
+	time.Sleep(3 * time.Millisecond)
+	record("b1")
+	record("b2")
+	until := time.Now()
+	time.Sleep(3 * time.Millisecond)
+	record("c1")
+
+	tests := []struct {
+		name   string
+		filter model.AuditFilter
+		want   []string // 从旧到新
+	}{
+		{"since", model.AuditFilter{Since: since}, []string{"b1", "b2", "c1"}},
+		{"until", model.AuditFilter{Until: until}, []string{"a1", "a2", "b1", "b2"}},
+		{"since and until", model.AuditFilter{Since: since, Until: until}, []string{"b1", "b2"}},
+		{"range and filter", model.AuditFilter{Since: since, Until: until, Target: "b2"}, []string{"b2"}},
+		{"empty range", model.AuditFilter{Since: until, Until: since}, nil},
+	}
+	targets := func(events []*model.AuditEvent) []string {
+		var out []string
+		for _, e := range events {
+			out = append(out, e.Target)
+		}
+		return out
+	}
+	for _, tt := range tests {
+		if got := targets(queryAll(t, l, tt.filter, 1)); !equalIDs(got, reversed(tt.want)) {
+			t.Errorf("%s: query = %v, want %v", tt.name, got, reversed(tt.want))
+		}
+		if got := targets(exportAll(t, l, tt.filter)); !equalIDs(got, tt.want) {
+			t.Errorf("%s: export = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryStreamIDBoundaries(t *testing.T) {
+	ctx := context.Background()
+	l, rc := newTestLogger(t)
+	// 同一毫秒内序号为 0 和最大值的条目，翻页时需要借位到上一毫秒
+	ids := []string{"1-0", "1-1", "1-18446744073709551615", "2-0", "2-1"}
+	for _, id := range ids {
+		data, _ := json.Marshal(&model.AuditEvent{Action: model.AuditLogin, Target: id, Outcome: model.AuditSuccess})
+		if err := rc.XAdd(ctx, &goredis.XAddArgs{Stream: "audit:log", ID: id, Values: map[string]interface{}{"event": data}}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, limit := range []int{1, 2, 3} {
+		if got := eventIDs(queryAll(t, l, model.AuditFilter{}, limit)); !equalIDs(got, reversed(ids)) {
+			t.Errorf("limit %d: query = %v", limit, got)
+		}
+	}
+	if got := eventIDs(exportAll(t, l, model.AuditFilter{})); !equalIDs(got, ids) {
+		t.Errorf("export = %v", got)
+	}
+
+	events, next, err := l.Query(ctx, model.AuditFilter{}, "2-0", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventIDs(events); next != "" || !equalIDs(got, []string{"1-18446744073709551615", "1-1", "1-0"}) {
+		t.Errorf("page after 2-0 = %v, cursor %q", got, next)
+	}
+
+	// 时间范围的边界包含整毫秒
+	ms := time.UnixMilli(1)
+	if got := eventIDs(exportAll(t, l, model.AuditFilter{Since: ms, Until: ms})); !equalIDs(got, ids[:3]) {
+		t.Errorf("export of ms 1 = %v", got)
+	}
+
+	for _, cursor := range []string{"0-0", "bad", "1-x"} {
+		if _, _, err := l.Query(ctx, model.AuditFilter{}, cursor, 10); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor %q: err = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
@@ -4,89 +4,304 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/notes-bin/ibed/internal/audit"
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/mail"
 	"github.com/notes-bin/ibed/internal/model"
 	"github.com/notes-bin/ibed/internal/redis"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误，不区分用户是否存在
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUsernameTaken      = redis.ErrUsernameTaken
+	ErrRegistrationClosed = errors.New("registration closed")
+	ErrInviteRequired     = errors.New("invite code required")
+	ErrAccountPending     = errors.New("account pending approval")
 )
 
 type Auth struct {
-	secret string
+	config *config.Config
 	redis  *redis.Client
+	guard  *LoginGuard
+	mailer mail.Mailer
+	keys   *KeyManager
+	audit  *audit.Logger
+}
+
+func NewAuth(config *config.Config, redis *redis.Client, mailer mail.Mailer) *Auth {
+	auditLog := audit.New(redis, config.Audit)
+	return &Auth{
+		config: config,
+		redis:  redis,
+		guard:  NewLoginGuard(redis, config.LoginProtection, auditLog),
+		mailer: mailer,
+		keys:   NewKeyManager(redis, config.JWT, config.JWTSecret),
+		audit:  auditLog,
+	}
+}
+
+// Keys 返回签名密钥管理器
+func (a *Auth) Keys() *KeyManager {
+	return a.keys
+}
+
+// Audit 返回审计日志
+func (a *Auth) Audit() *audit.Logger {
+	return a.audit
+}
+
+func mailMessage(to, subject, body string) mail.Message {
+	return mail.Message{To: to, Subject: subject, Body: body}
 }
 
-func NewAuth(secret string, redis *redis.Client) *Auth {
-	return &Auth{secret: secret, redis: redis}
+// TokenClaims 写入令牌的用户信息
+type TokenClaims struct {
+	UserID    string
+	Username  string
+	Role      model.Role
+	MFA       bool   // 本次登录是否通过了两步验证
+	SessionID string // 关联的会话
 }
 
-func (a *Auth) Register(ctx context.Context, username, password string) (*model.User, error) {
-	// 检查用户名是否已存在
-	existingUser, err := a.redis.GetUser(ctx, username)
+// Register 按注册模式注册用户；邀请码可指定角色和配额，审核模式下无邀请码的用户需等待审核
+func (a *Auth) Register(ctx context.Context, username, password, inviteCode string) (*model.User, error) {
+	mode := a.config.RegistrationMode
+	if mode == config.RegistrationClosed {
+		return nil, ErrRegistrationClosed
+	}
+	if mode == config.RegistrationInvite && inviteCode == "" {
+		return nil, ErrInviteRequired
+	}
+
+	// 检查用户名是否已存在，最终由 CreateUser 原子地保证唯一
+	existingUser, err := a.redis.GetUserByUsername(ctx, username)
 	if err != nil {
 		return nil, err
 	}
 	if existingUser != nil {
-		return nil, fmt.Errorf("username already exists")
+		return nil, ErrUsernameTaken
 	}
 
 	hashed := a.HashPassword(password)
 	user := &model.User{
-		ID:        username, // 使用用户名作为ID
+		ID:        uuid.NewString(),
 		Username:  username,
 		Password:  hashed,
-		IsAdmin:   username == "admin", // 首次注册 admin 为超级管理员
+		Role:      model.Role(a.config.DefaultRole),
+		Status:    model.StatusActive,
 		CreatedAt: time.Now(),
 	}
-	if err := a.redis.SaveUser(ctx, user); err != nil {
+
+	var invite *model.Invite
+	if inviteCode != "" {
+		if invite, err = a.redis.UseInvite(ctx, inviteCode); err != nil {
+			return nil, err
+		}
+		if invite.Role != "" {
+			user.Role = invite.Role
+		}
+	} else if mode == config.RegistrationApproval {
+		user.Status = model.StatusPending
+	}
+
+	if err := a.saveNewUser(ctx, user, invite); err != nil {
+		if invite != nil {
+			a.redis.ReleaseInvite(ctx, invite.Code)
+		}
 		return nil, err
 	}
+	details := map[string]string{"role": string(user.Role), "status": string(user.Status)}
+	if invite != nil {
+		details["invite"] = invite.Code
+	}
+	a.audit.Record(ctx, model.AuditEvent{Action: model.AuditRegister, ActorID: user.ID, Actor: user.Username, Target: user.ID, Details: details})
 	return user, nil
 }
 
+func (a *Auth) saveNewUser(ctx context.Context, user *model.User, invite *model.Invite) error {
+	if err := a.redis.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	if invite != nil && invite.Quota != nil {
+		if err := a.redis.SetQuota(ctx, user.ID, *invite.Quota); err != nil {
+			return err
+		}
+	}
+	if user.Status == model.StatusPending {
+		return a.redis.AddPendingUser(ctx, user.ID, user.CreatedAt)
+	}
+	return nil
+}
+
 func (a *Auth) HashPassword(password string) string {
 	hash := md5.Sum([]byte(password))
 	return hex.EncodeToString(hash[:])
 }
 
-func (a *Auth) Login(ctx context.Context, username, password string, expiresIn time.Duration) (string, error) {
-	user, err := a.redis.GetUser(ctx, username)
+func (a *Auth) Login(ctx context.Context, username, password string, client ClientInfo, expiresIn time.Duration) (*LoginResult, error) {
+	user, result, err := a.passwordLogin(ctx, username, password, client, expiresIn)
+	a.recordLogin(ctx, "password", username, user, client, result, err)
+	return result, err
+}
+
+// passwordLogin 校验用户名和密码，返回的用户仅用于审计，用户名不存在时为空
+func (a *Auth) passwordLogin(ctx context.Context, username, password string, client ClientInfo, expiresIn time.Duration) (*model.User, *LoginResult, error) {
+	if err := a.guard.Check(ctx, username, client.IP); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := a.redis.GetUserByUsername(ctx, username)
 	if err != nil {
-		return "", err
+		return nil, nil, err
+	}
+	hashed := a.HashPassword(password)
+	if user == nil || user.Password != hashed {
+		if err := a.guard.Fail(ctx, username, client.IP); err != nil {
+			return user, nil, err
+		}
+		return user, nil, ErrInvalidCredentials
+	}
+
+	// 开启两步验证的用户在第二步通过后才清除失败计数，否则反复发起挑战可以无限次尝试验证码
+	if !user.TOTPEnabled {
+		if err := a.guard.Succeed(ctx, username, client.IP); err != nil {
+			return user, nil, err
+		}
+	}
+	if user.Status == model.StatusPending {
+		return user, nil, ErrAccountPending
+	}
+	if _, err := checkStatus(user); err != nil {
+		return user, nil, err
+	}
+
+	// 开启两步验证的用户先返回挑战，验证码通过后再签发令牌
+	var result *LoginResult
+	if user.TOTPEnabled {
+		result, err = a.newChallenge(ctx, user, expiresIn)
+	} else {
+		result, err = a.startSession(ctx, user, false, client, expiresIn)
+	}
+	return user, result, err
+}
+
+// recordLogin 记录一次登录尝试；账户被锁定、待审核或受限时结果为 denied
+func (a *Auth) recordLogin(ctx context.Context, method, username string, user *model.User, client ClientInfo, result *LoginResult, err error) {
+	e := model.AuditEvent{
+		Action:  model.AuditLogin,
+		Actor:   username,
+		IP:      client.IP,
+		Details: map[string]string{"method": method},
 	}
-	if user == nil || user.Password != a.HashPassword(password) {
-		return "", fmt.Errorf("invalid credentials")
+	if user != nil {
+		e.ActorID, e.Target = user.ID, user.ID
+		if e.Actor == "" {
+			e.Actor = user.Username
+		}
 	}
-	return a.GenerateToken(user.ID, user.Username, user.IsAdmin, expiresIn)
+	var locked *LockedError
+	var restricted *RestrictedError
+	switch {
+	case err == nil:
+		if result.TwoFactorRequired {
+			e.Details["two_factor"] = "required"
+		}
+	case errors.As(err, &locked), errors.As(err, &restricted), errors.Is(err, ErrAccountPending):
+		e.Outcome = model.AuditDenied
+		e.Details["error"] = err.Error()
+	default:
+		e.Outcome = model.AuditFailure
+		e.Details["error"] = err.Error()
+	}
+	a.audit.Record(ctx, e)
+}
+
+// Unlock 解除用户名和/或 IP 的登录锁定
+func (a *Auth) Unlock(ctx context.Context, username, ip string) error {
+	return a.guard.Unlock(ctx, username, ip)
 }
 
-func (a *Auth) GenerateToken(userID, username string, isAdmin bool, expiresIn time.Duration) (string, error) {
+// GenerateToken 签发令牌，有效期不超过 jwt.max_token_ttl
+func (a *Auth) GenerateToken(c TokenClaims, expiresIn time.Duration) (string, error) {
+	expiresIn = a.tokenTTL(expiresIn)
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"is_admin": isAdmin,
-		"exp":      time.Now().Add(expiresIn).Unix(),
+		"iss":      a.config.JWT.Issuer,
+		"aud":      a.config.JWT.Audience,
+		"iat":      now.Unix(),
+		"exp":      now.Add(expiresIn).Unix(),
+		"user_id":  c.UserID,
+		"username": c.Username,
+		"role":     string(c.Role),
+		"mfa":      c.MFA,
+		"sid":      c.SessionID,
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(a.secret))
+	return a.keys.Sign(claims)
 }
 
-func (a *Auth) ChangePassword(ctx context.Context, username, newPassword string) error {
-	user, err := a.redis.GetUser(ctx, username)
+// ParseToken 校验令牌并返回其中的用户信息
+func (a *Auth) ParseToken(ctx context.Context, tokenStr string) (*TokenClaims, error) {
+	claims, err := a.keys.Parse(ctx, tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := claims["user_id"].(string)
+	username, _ := claims["username"].(string)
+	if userID == "" {
+		return nil, ErrInvalidCredentials
+	}
+	mfa, _ := claims["mfa"].(bool)
+	sid, _ := claims["sid"].(string)
+	return &TokenClaims{UserID: userID, Username: username, Role: tokenRole(claims), MFA: mfa, SessionID: sid}, nil
+}
+
+// tokenRole 读取令牌中的角色，兼容只有 is_admin 的旧令牌
+func tokenRole(claims jwt.MapClaims) model.Role {
+	if role, ok := claims["role"].(string); ok && model.Role(role).Valid() {
+		return model.Role(role)
+	}
+	if isAdmin, _ := claims["is_admin"].(bool); isAdmin {
+		return model.RoleAdmin
+	}
+	return model.RoleUploader
+}
+
+// ChangePassword 修改自己的密码，需要提供当前密码
+func (a *Auth) ChangePassword(ctx context.Context, userID, oldPassword, newPassword string) error {
+	user, err := a.redis.GetUser(ctx, userID)
 	if err != nil {
 		return err
 	}
 	if user == nil {
 		return fmt.Errorf("user not found")
 	}
+	if user.Password != a.HashPassword(oldPassword) {
+		a.audit.Record(ctx, model.AuditEvent{Action: model.AuditPasswordChange, Target: user.ID, Outcome: model.AuditFailure,
+			Details: map[string]string{"error": ErrInvalidCredentials.Error()}})
+		return ErrInvalidCredentials
+	}
 
-	// 更新密码
+	if err := a.SetPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+	a.audit.Record(ctx, model.AuditEvent{Action: model.AuditPasswordChange, Target: user.ID})
+	return nil
+}
+
+// SetPassword 更新密码并撤销用户的全部会话
+func (a *Auth) SetPassword(ctx context.Context, user *model.User, newPassword string) error {
 	user.Password = a.HashPassword(newPassword)
 	if err := a.redis.SaveUser(ctx, user); err != nil {
 		return err
 	}
-
-	return nil
+	_, err := a.RevokeAllSessions(ctx, user.ID)
+	return err
 }
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/mail"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestAuth 使用 miniredis 创建认证服务，configure 可以在填充默认值前修改配置
+func newTestAuth(t *testing.T, configure func(*config.Config)) (*Auth, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := redis.NewClient(mr.Addr(), "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	cfg := &config.Config{JWTSecret: "test-secret", DefaultRole: "uploader", RegistrationMode: "open"}
+	if configure != nil {
+		configure(cfg)
+	}
+	cfg.SetDefaults()
+	a := NewAuth(cfg, rc, mail.LogMailer{})
+	if err := a.Keys().Rotate(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	return a, mr
+}
+
+// registerUser 以密码 password 注册用户
+func registerUser(t *testing.T, a *Auth, username string) *model.User {
+	t.Helper()
+	user, err := a.Register(context.Background(), username, "password", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
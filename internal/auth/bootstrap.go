@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	setupDoneKey   = "setup:done"
+	setupTokenKey  = "setup:token"
+	setupTokenTTL  = 24 * time.Hour
+	setupTokenSize = 24
+)
+
+var ErrInvalidSetupToken = errors.New("invalid or expired setup token")
+
+// HasAdmin 判断是否已有管理员；兼容升级前已存在的管理员账户
+func (a *Auth) HasAdmin(ctx context.Context) (bool, error) {
+	n, err := a.redis.Exists(ctx, setupDoneKey).Result()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return true, nil
+	}
+
+	found := false
+	err = a.redis.ScanUsers(ctx, func(user *model.User) bool {
+		found = user.Role == model.RoleAdmin
+		return !found
+	})
+	if err != nil {
+		return false, err
+	}
+	if found {
+		return true, a.redis.Set(ctx, setupDoneKey, time.Now().Unix(), 0).Err()
+	}
+	return false, nil
+}
+
+// IssueSetupToken 在还没有管理员时签发一次性初始化令牌，Redis 中只保存其哈希。
+// 多个实例同时启动时只有一个实例能签发成功，其余返回 issued=false。
+func (a *Auth) IssueSetupToken(ctx context.Context) (token string, issued bool, err error) {
+	buf := make([]byte, setupTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, err
+	}
+	token = hex.EncodeToString(buf)
+	issued, err = a.redis.SetNX(ctx, setupTokenKey, hashSetupToken(token), setupTokenTTL).Result()
+	if err != nil || !issued {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+// consumeScript 令牌哈希匹配时删除并返回 1，否则返回 0
+var consumeScript = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// CompleteSetup 使用初始化令牌创建首个管理员，令牌使用后立即失效
+func (a *Auth) CompleteSetup(ctx context.Context, token, username, password string) (*model.User, error) {
+	if username == "" || password == "" {
+		return nil, errors.New("username and password required")
+	}
+	ok, err := consumeScript.Run(ctx, a.redis, []string{setupTokenKey}, hashSetupToken(token)).Int()
+	if err != nil {
+		return nil, err
+	}
+	if ok != 1 {
+		return nil, ErrInvalidSetupToken
+	}
+	return a.CreateAdmin(ctx, username, password)
+}
+
+// CreateAdmin 创建管理员账户；用户已存在时提升为管理员，密码非空时同时重置密码
+func (a *Auth) CreateAdmin(ctx context.Context, username, password string) (*model.User, error) {
+	user, err := a.redis.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if password == "" {
+			return nil, errors.New("password required")
+		}
+		user = &model.User{
+			ID:        uuid.NewString(),
+			Username:  username,
+			Password:  a.HashPassword(password),
+			Role:      model.RoleAdmin,
+			Status:    model.StatusActive,
+			CreatedAt: time.Now(),
+		}
+		if err := a.redis.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+	} else {
+		if password != "" {
+			user.Password = a.HashPassword(password)
+		}
+		user.Role = model.RoleAdmin
+		if err := a.redis.SaveUser(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.redis.Set(ctx, setupDoneKey, time.Now().Unix(), 0).Err(); err != nil {
+		return nil, err
+	}
+	a.redis.Del(ctx, setupTokenKey)
+	a.audit.Record(ctx, model.AuditEvent{Action: model.AuditAdminBootstrap, ActorID: user.ID, Actor: user.Username, Target: user.ID})
+	return user, nil
+}
+
+func hashSetupToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
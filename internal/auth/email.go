@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	verifyTokenTTL = 24 * time.Hour
+	resetTokenTTL  = time.Hour
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrEmailTaken   = errors.New("email already in use")
+	ErrInvalidToken = errors.New("invalid or expired token")
+)
+
+// newMailToken 生成一次性令牌，Redis 中只保存其哈希
+func (a *Auth) newMailToken(ctx context.Context, kind, value string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := a.redis.Set(ctx, mailTokenKey(kind, token), value, ttl).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeMailToken 取出并删除令牌，保证只能使用一次
+func (a *Auth) consumeMailToken(ctx context.Context, kind, token string) (string, error) {
+	value, err := a.redis.GetDel(ctx, mailTokenKey(kind, token)).Result()
+	if err == goredis.Nil {
+		return "", ErrInvalidToken
+	}
+	return value, err
+}
+
+func mailTokenKey(kind, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("token:%s:%s", kind, hex.EncodeToString(sum[:]))
+}
+
+// SetEmail 修改邮箱并发送验证邮件。邮箱在所有用户中唯一，验证通过后才占用邮箱索引，
+// 避免他人提前填写别人的邮箱而使其无法使用
+func (a *Auth) SetEmail(ctx context.Context, userID, email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user not found")
+	}
+	if strings.EqualFold(user.Email, email) && user.EmailVerified {
+		return nil
+	}
+
+	// 已被其他用户验证的邮箱直接拒绝
+	owner, verified, err := a.emailOwner(ctx, email)
+	if err != nil {
+		return err
+	}
+	if verified && owner != user.ID {
+		return ErrEmailTaken
+	}
+
+	if user.Email != "" {
+		if err := a.redis.ReleaseEmail(ctx, user.Email, user.ID); err != nil {
+			return err
+		}
+	}
+	user.Email = email
+	user.EmailVerified = false
+	if err := a.redis.SaveUser(ctx, user); err != nil {
+		return err
+	}
+	return a.SendVerification(ctx, user)
+}
+
+// emailOwner 返回邮箱索引指向的用户 ID，以及该用户是否确实已验证这个邮箱。
+// 旧版本在验证前就写入索引，未验证的占用不算数，验证时可以覆盖
+func (a *Auth) emailOwner(ctx context.Context, email string) (string, bool, error) {
+	owner, err := a.redis.Get(ctx, redis.EmailKey(email)).Result()
+	if err == goredis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	user, err := a.redis.GetUser(ctx, owner)
+	if err != nil {
+		return "", false, err
+	}
+	return owner, user != nil && user.EmailVerified && strings.EqualFold(user.Email, email), nil
+}
+
+// SendVerification 发送邮箱验证邮件
+func (a *Auth) SendVerification(ctx context.Context, user *model.User) error {
+	if user.Email == "" {
+		return ErrInvalidEmail
+	}
+	token, err := a.newMailToken(ctx, "verify", user.ID+"|"+strings.ToLower(user.Email), verifyTokenTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?token=%s", a.config.PublicURL, url.QueryEscape(token))
+	return a.mailer.Send(ctx, mailMessage(user.Email, "Verify your email address",
+		fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below within 24 hours:\n\n%s\n\nIf you did not request this, you can ignore this email.\n", user.Username, link)))
+}
+
+// VerifyEmail 校验验证令牌并占用邮箱索引，令牌签发后邮箱又被修改时视为无效
+func (a *Auth) VerifyEmail(ctx context.Context, token string) error {
+	value, err := a.consumeMailToken(ctx, "verify", token)
+	if err != nil {
+		return err
+	}
+	userID, email, _ := strings.Cut(value, "|")
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || strings.ToLower(user.Email) != email {
+		return ErrInvalidToken
+	}
+
+	// 验证通过后占用邮箱索引，期间已被其他用户验证时拒绝
+	owner, verified, err := a.emailOwner(ctx, email)
+	if err != nil {
+		return err
+	}
+	if verified && owner != user.ID {
+		return ErrEmailTaken
+	}
+	stale := ""
+	if !verified {
+		stale = owner
+	}
+	ok, err := a.redis.ClaimEmail(ctx, email, user.ID, stale)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrEmailTaken
+	}
+	user.EmailVerified = true
+	return a.redis.SaveUser(ctx, user)
+}
+
+// ForgotPassword 向已验证的邮箱发送重置密码链接。
+// 无论邮箱是否存在都返回 nil，避免泄露账户信息。
+func (a *Auth) ForgotPassword(ctx context.Context, email string) error {
+	userID, err := a.redis.Get(ctx, redis.EmailKey(email)).Result()
+	if err == goredis.Nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.EmailVerified || !strings.EqualFold(user.Email, email) {
+		return nil
+	}
+
+	token, err := a.newMailToken(ctx, "reset", user.ID, resetTokenTTL)
+	if err != nil {
+		return err
+	}
+	link := a.config.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	if err := a.mailer.Send(ctx, mailMessage(user.Email, "Reset your password",
+		fmt.Sprintf("Hi %s,\n\nA password reset was requested for your account. Open the link below within 1 hour to choose a new password:\n\n%s\n\nIf you did not request this, you can ignore this email.\n", user.Username, link))); err != nil {
+		slog.Error("Failed to send password reset mail", "user_id", user.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ResetPasswordWithToken 使用邮件中的一次性令牌设置新密码
+func (a *Auth) ResetPasswordWithToken(ctx context.Context, token, newPassword string) error {
+	userID, err := a.consumeMailToken(ctx, "reset", token)
+	if err != nil {
+		return err
+	}
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidToken
+	}
+	if err := a.SetPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+	a.audit.Record(ctx, model.AuditEvent{Action: model.AuditPasswordReset, ActorID: user.ID, Actor: user.Username, Target: user.ID,
+		Details: map[string]string{"via": "email"}})
+	return nil
+}
+
+// NotifyUser 向用户已验证的邮箱发送通知，未绑定或未验证邮箱时忽略
+func (a *Auth) NotifyUser(ctx context.Context, userID, subject, body string) error {
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil || user == nil || user.Email == "" || !user.EmailVerified {
+		return err
+	}
+	return a.mailer.Send(ctx, mailMessage(user.Email, subject, fmt.Sprintf("Hi %s,\n\n%s\n", user.Username, body)))
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/mail"
+	"github.com/notes-bin/ibed/internal/redis"
+)
+
+// recordMailer 保存发出的邮件
+type recordMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var tokenPattern = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+// lastToken 取出最近一封邮件中的令牌
+func (m *recordMailer) lastToken(t *testing.T) string {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatal("no mail sent")
+	}
+	match := tokenPattern.FindStringSubmatch(m.sent[len(m.sent)-1].Body)
+	if match == nil {
+		t.Fatal("no token in mail")
+	}
+	return match[1]
+}
+
+func TestEmailIndexClaimedOnVerification(t *testing.T) {
+	const email = "shared@example.com"
+	tests := []struct {
+		name string
+		// 依次执行的步骤：用户名和操作，set 为设置邮箱，verify 为打开该用户最近的验证链接
+		steps   []struct{ user, op string }
+		wantErr error  // 最后一步的错误
+		owner   string // 最终邮箱索引指向的用户，为空表示没有索引
+	}{
+		{"unverified address is not reserved", []struct{ user, op string }{{"alice", "set"}}, nil, ""},
+		{"verification claims the address", []struct{ user, op string }{{"alice", "set"}, {"alice", "verify"}}, nil, "alice"},
+		{"squatter does not block the owner", []struct{ user, op string }{{"mallory", "set"}, {"alice", "set"}, {"alice", "verify"}}, nil, "alice"},
+		{"verified address cannot be taken", []struct{ user, op string }{{"alice", "set"}, {"alice", "verify"}, {"mallory", "set"}}, ErrEmailTaken, "alice"},
+		{"first verification wins", []struct{ user, op string }{{"alice", "set"}, {"mallory", "set"}, {"alice", "verify"}, {"mallory", "verify"}}, ErrEmailTaken, "alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, _ := newTestAuth(t, nil)
+			mailers := map[string]*recordMailer{}
+			ids := map[string]string{}
+			for _, name := range []string{"alice", "mallory"} {
+				ids[name] = registerUser(t, a, name).ID
+				mailers[name] = &recordMailer{}
+			}
+
+			var err error
+			for _, step := range tt.steps {
+				a.mailer = mailers[step.user]
+				switch step.op {
+				case "set":
+					err = a.SetEmail(ctx, ids[step.user], email)
+				case "verify":
+					err = a.VerifyEmail(ctx, mailers[step.user].lastToken(t))
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("last step error = %v, want %v", err, tt.wantErr)
+			}
+			owner, _ := a.redis.Get(ctx, redis.EmailKey(email)).Result()
+			if want := ids[tt.owner]; owner != want {
+				t.Errorf("email index owner = %q, want %q", owner, want)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailReplacesLegacyReservation(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuth(t, nil)
+	alice, mallory := registerUser(t, a, "alice"), registerUser(t, a, "mallory")
+	// 旧版本在验证前写入的索引
+	mallory.Email = "alice@example.com"
+	a.redis.SaveUser(ctx, mallory)
+	a.redis.Set(ctx, redis.EmailKey(mallory.Email), mallory.ID, 0)
+
+	m := &recordMailer{}
+	a.mailer = m
+	if err := a.SetEmail(ctx, alice.ID, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.VerifyEmail(ctx, m.lastToken(t)); err != nil {
+		t.Fatal(err)
+	}
+	if owner, _ := a.redis.Get(ctx, redis.EmailKey("alice@example.com")).Result(); owner != alice.ID {
+		t.Errorf("email index owner = %q, want alice", owner)
+	}
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/oidc"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/google/uuid"
+)
+
+const maxUsernameAttempts = 20
+
+func externalLinkKey(issuer, subject string) string {
+	return fmt.Sprintf("oidc:link:%s|%s", issuer, subject)
+}
+
+// LoginExternal 使用身份提供方验证过的身份登录，首次登录时关联或创建本地用户
+func (a *Auth) LoginExternal(ctx context.Context, id *oidc.Identity, client ClientInfo, expiresIn time.Duration) (*LoginResult, error) {
+	user, result, err := a.externalLogin(ctx, id, client, expiresIn)
+	a.recordLogin(ctx, "oidc", id.Username, user, client, result, err)
+	return result, err
+}
+
+func (a *Auth) externalLogin(ctx context.Context, id *oidc.Identity, client ClientInfo, expiresIn time.Duration) (*model.User, *LoginResult, error) {
+	user, err := a.resolveExternalUser(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.Status == model.StatusPending {
+		return user, nil, ErrAccountPending
+	}
+
+	// 按用户组同步管理员角色，移出管理员组后降为默认角色
+	if admins := a.config.OIDC.AdminGroups; len(admins) > 0 {
+		isAdmin := slices.ContainsFunc(id.Groups, func(g string) bool { return slices.Contains(admins, g) })
+		role := user.Role
+		if isAdmin {
+			role = model.RoleAdmin
+		} else if role == model.RoleAdmin {
+			role = model.Role(a.config.DefaultRole)
+		}
+		if role != user.Role {
+			oldRole := user.Role
+			user.Role = role
+			if err := a.redis.SaveUser(ctx, user); err != nil {
+				return user, nil, err
+			}
+			// 操作者记为身份提供方
+			a.audit.Record(ctx, model.AuditEvent{Action: model.AuditRoleChange, Actor: "oidc:" + id.Issuer, Target: user.ID,
+				Details: map[string]string{"from": string(oldRole), "to": string(role), "source": "oidc_groups"}})
+		}
+	}
+
+	result, err := a.startSession(ctx, user, id.MFA, client, expiresIn)
+	return user, result, err
+}
+
+func (a *Auth) resolveExternalUser(ctx context.Context, id *oidc.Identity) (*model.User, error) {
+	linkKey := externalLinkKey(id.Issuer, id.Subject)
+	userID, err := a.redis.Get(ctx, linkKey).Result()
+	if err == nil {
+		user, err := a.redis.GetUser(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			return user, nil
+		}
+		// 本地用户已被删除，重新创建
+	}
+
+	username := id.Username
+	if username == "" {
+		username = id.Subject
+	}
+
+	if a.config.OIDC.LinkExisting {
+		user, err := a.redis.GetUserByUsername(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil && emailMatches(user, id) {
+			if err := a.redis.Set(ctx, linkKey, user.ID, 0).Err(); err != nil {
+				return nil, err
+			}
+			slog.Info("Linked external identity", "issuer", id.Issuer, "subject", id.Subject, "user_id", user.ID)
+			return user, nil
+		}
+	}
+
+	// 创建新用户与本地注册遵循相同的注册模式：关闭和邀请模式下只允许已关联的身份登录，审核模式下等待管理员审核
+	status := model.StatusActive
+	switch a.config.RegistrationMode {
+	case config.RegistrationClosed, config.RegistrationInvite:
+		return nil, ErrRegistrationClosed
+	case config.RegistrationApproval:
+		status = model.StatusPending
+	}
+
+	// 用户名冲突时（包括同名但邮箱不匹配的本地账户）追加序号；外部用户没有本地密码
+	for i := 0; i < maxUsernameAttempts; i++ {
+		candidate := username
+		if i > 0 {
+			candidate = fmt.Sprintf("%s-%d", username, i+1)
+		}
+		user := &model.User{
+			ID:        uuid.NewString(),
+			Username:  candidate,
+			Role:      model.Role(a.config.DefaultRole),
+			Status:    status,
+			CreatedAt: time.Now(),
+		}
+		err := a.saveNewUser(ctx, user, nil)
+		if err == redis.ErrUsernameTaken {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := a.redis.Set(ctx, linkKey, user.ID, 0).Err(); err != nil {
+			return nil, err
+		}
+		slog.Info("Provisioned external user", "issuer", id.Issuer, "subject", id.Subject, "user_id", user.ID, "status", user.Status)
+		return user, nil
+	}
+	return nil, fmt.Errorf("no available username for %q", username)
+}
+
+// emailMatches 身份提供方验证过的邮箱与本地账户已验证的邮箱相同时才允许关联，
+// 仅凭用户名关联会让能在身份提供方注册任意用户名的人接管同名本地账户
+func emailMatches(user *model.User, id *oidc.Identity) bool {
+	return id.EmailVerified && user.EmailVerified && id.Email != "" &&
+		strings.EqualFold(strings.TrimSpace(user.Email), strings.TrimSpace(id.Email))
+}
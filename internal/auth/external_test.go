@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/oidc"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider 用 httptest 模拟身份提供方，令牌端点返回以 claims 签名的 ID Token
+type mockProvider struct {
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "k1", "kty": "RSA", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		claims := jwt.MapClaims{"iss": m.srv.URL, "aud": "ibed", "exp": time.Now().Add(time.Minute).Unix(), "nonce": "n"}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// identity 使用给定声明完成一次授权码交换
+func (m *mockProvider) identity(t *testing.T, claims jwt.MapClaims) *oidc.Identity {
+	t.Helper()
+	m.claims = claims
+	p := oidc.NewProvider(config.OIDCConfig{Issuer: m.srv.URL, ClientID: "ibed", UsernameClaim: "preferred_username"})
+	id, err := p.Exchange(context.Background(), "code", "verifier", "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestLoginExternalLinkExisting(t *testing.T) {
+	tests := []struct {
+		name          string
+		linkExisting  bool
+		localVerified bool
+		idpEmail      string
+		idpVerified   interface{}
+		wantLinked    bool
+	}{
+		{"verified emails match", true, true, "Alice@Example.com", true, true},
+		{"email_verified as string", true, true, "alice@example.com", "true", true},
+		{"idp email not verified", true, true, "alice@example.com", false, false},
+		{"idp email_verified missing", true, true, "alice@example.com", nil, false},
+		{"local email not verified", true, false, "alice@example.com", true, false},
+		{"different email", true, true, "mallory@example.com", true, false},
+		{"linking disabled", false, true, "alice@example.com", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, _ := newTestAuth(t, func(cfg *config.Config) { cfg.OIDC.LinkExisting = tt.linkExisting })
+			local := registerUser(t, a, "alice")
+			local.Email, local.EmailVerified = "alice@example.com", tt.localVerified
+			if err := a.redis.SaveUser(ctx, local); err != nil {
+				t.Fatal(err)
+			}
+
+			claims := jwt.MapClaims{"sub": "idp-1", "preferred_username": "alice", "email": tt.idpEmail}
+			if tt.idpVerified != nil {
+				claims["email_verified"] = tt.idpVerified
+			}
+			m := newMockProvider(t)
+			if _, err := a.LoginExternal(ctx, m.identity(t, claims), ClientInfo{IP: "192.0.2.1"}, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			linkedID, err := a.redis.Get(ctx, externalLinkKey(m.srv.URL, "idp-1")).Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked := linkedID == local.ID; linked != tt.wantLinked {
+				t.Fatalf("linked to local account = %v, want %v", linked, tt.wantLinked)
+			}
+			if !tt.wantLinked {
+				user, _ := a.redis.GetUser(ctx, linkedID)
+				if user == nil || user.Username != "alice-2" {
+					t.Errorf("provisioned user = %+v, want alice-2", user)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginExternalSyncsAdminRole(t *testing.T) {
+	tests := []struct {
+		name      string
+		startRole model.Role
+		groups    []string
+		wantRole  model.Role
+		wantAudit bool
+	}{
+		{"joins admin group", model.RoleUploader, []string{"staff", "ibed-admins"}, model.RoleAdmin, true},
+		{"leaves admin group", model.RoleAdmin, []string{"staff"}, model.RoleUploader, true},
+		{"unchanged admin", model.RoleAdmin, []string{"ibed-admins"}, model.RoleAdmin, false},
+		{"unchanged user", model.RoleUploader, nil, model.RoleUploader, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, _ := newTestAuth(t, func(cfg *config.Config) { cfg.OIDC.AdminGroups = []string{"ibed-admins"} })
+			id := &oidc.Identity{Issuer: "https://idp.example.com", Subject: "idp-1", Username: "alice", Groups: tt.groups}
+			if _, err := a.LoginExternal(ctx, id, ClientInfo{IP: "192.0.2.1"}, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			userID, _ := a.redis.Get(ctx, externalLinkKey(id.Issuer, id.Subject)).Result()
+			user, _ := a.redis.GetUser(ctx, userID)
+			if user.Role != tt.startRole {
+				user.Role = tt.startRole
+				a.redis.SaveUser(ctx, user)
+			}
+			// 审计条目 ID 精确到毫秒，与首次登录的记录错开
+			time.Sleep(2 * time.Millisecond)
+			since := time.Now()
+			if _, err := a.LoginExternal(ctx, id, ClientInfo{IP: "192.0.2.1"}, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			user, _ = a.redis.GetUser(ctx, userID)
+			if user.Role != tt.wantRole {
+				t.Errorf("role %q, want %q", user.Role, tt.wantRole)
+			}
+			events, err := a.redis.AuditRange(ctx, redis.AuditStreamID(since, false), "+", 100, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var change *model.AuditEvent
+			for _, e := range events {
+				if e.Action == model.AuditRoleChange {
+					change = e
+				}
+			}
+			if (change != nil) != tt.wantAudit {
+				t.Fatalf("role change audited %v, want %v", change != nil, tt.wantAudit)
+			}
+			if change != nil && (change.Actor != "oidc:"+id.Issuer || change.Target != userID ||
+				change.Details["from"] != string(tt.startRole) || change.Details["to"] != string(tt.wantRole)) {
+				t.Errorf("audit event %+v", change)
+			}
+		})
+	}
+}
+
+func TestLoginExternalRegistrationMode(t *testing.T) {
+	tests := []struct {
+		mode        string
+		wantErr     error
+		wantStatus  model.UserStatus
+		wantPending bool
+	}{
+		{config.RegistrationOpen, nil, model.StatusActive, false},
+		{config.RegistrationInvite, ErrRegistrationClosed, "", false},
+		{config.RegistrationClosed, ErrRegistrationClosed, "", false},
+		{config.RegistrationApproval, ErrAccountPending, model.StatusPending, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			ctx := context.Background()
+			var cfg *config.Config
+			a, _ := newTestAuth(t, func(c *config.Config) { cfg = c })
+			m := newMockProvider(t)
+			client := ClientInfo{IP: "192.0.2.1"}
+
+			// 开放注册时关联的身份在任何注册模式下都可以继续登录
+			if _, err := a.LoginExternal(ctx, m.identity(t, jwt.MapClaims{"sub": "linked", "preferred_username": "linked"}), client, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			cfg.RegistrationMode = tt.mode
+			if _, err := a.LoginExternal(ctx, m.identity(t, jwt.MapClaims{"sub": "linked", "preferred_username": "linked"}), client, time.Hour); err != nil {
+				t.Errorf("linked identity: %v", err)
+			}
+
+			_, err := a.LoginExternal(ctx, m.identity(t, jwt.MapClaims{"sub": "new", "preferred_username": "bob"}), client, time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("new identity: error = %v, want %v", err, tt.wantErr)
+			}
+			user, err := a.redis.GetUserByUsername(ctx, "bob")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantStatus == "" {
+				if user != nil {
+					t.Errorf("account created in %s mode: %+v", tt.mode, user)
+				}
+				if a.redis.Exists(ctx, externalLinkKey(m.srv.URL, "new")).Val() != 0 {
+					t.Error("refused identity was linked")
+				}
+				return
+			}
+			if user == nil || user.Status != tt.wantStatus {
+				t.Fatalf("provisioned user = %+v, want status %s", user, tt.wantStatus)
+			}
+			pending, err := a.redis.ListPendingUsers(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inQueue := len(pending) == 1 && pending[0].ID == user.ID; inQueue != tt.wantPending {
+				t.Errorf("in pending queue = %v, want %v", inQueue, tt.wantPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/golang-jwt/jwt/v5"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	jwtKeysKey       = "jwt:keys"        // kid -> 密钥 JSON
+	jwtCurrentKey    = "jwt:current"     // 当前签名密钥的 kid
+	jwtRotateLockKey = "jwt:rotate:lock" // 轮换锁，避免多实例同时生成密钥
+	jwtRotateLockTTL = 30 * time.Second
+
+	// 未知 kid 触发重新加载的最短间隔，防止伪造 kid 的请求打满 Redis
+	keyReloadInterval = 10 * time.Second
+	// 其他实例持有轮换锁时检查锁是否释放的间隔
+	rotateWaitInterval = 100 * time.Millisecond
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// storedKey 保存在 Redis 中的签名密钥，私钥以 jwt.key_encryption_key 派生的密钥加密
+type storedKey struct {
+	ID        string    `json:"kid"`
+	Alg       string    `json:"alg"`
+	Private   []byte    `json:"private,omitempty"`   // 旧版本保存的明文 PKCS#8 DER，加载时改为加密保存
+	Encrypted []byte    `json:"encrypted,omitempty"` // AES-256-GCM 加密的 PKCS#8 DER，nonce 在前，kid 作为附加数据
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // 轮换后设置，过期后不再用于校验
+}
+
+type signingKey struct {
+	storedKey
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeyManager 管理非对称签名密钥。所有实例通过 Redis 共享密钥，
+// 当前密钥到期后生成新密钥，旧密钥的公钥保留到其签发的令牌全部过期。
+type KeyManager struct {
+	redis  *redis.Client
+	config config.JWTConfig
+	secret []byte
+	kek    cipher.AEAD // 加密 Redis 中的私钥
+
+	mu       sync.RWMutex
+	keys     map[string]*signingKey
+	current  string
+	loadedAt time.Time
+}
+
+func NewKeyManager(redis *redis.Client, config config.JWTConfig, secret string) *KeyManager {
+	sum := sha256.Sum256([]byte(config.KeyEncryptionKey))
+	block, _ := aes.NewCipher(sum[:]) // 32 字节密钥不会出错
+	kek, _ := cipher.NewGCM(block)
+	return &KeyManager{redis: redis, config: config, secret: []byte(secret), kek: kek, keys: map[string]*signingKey{}}
+}
+
+func (m *KeyManager) symmetric() bool {
+	return m.config.Algorithm == config.JWTAlgHS256
+}
+
+// Load 从 Redis 加载密钥并清理已过期的旧密钥
+func (m *KeyManager) Load(ctx context.Context) error {
+	raw, err := m.redis.HGetAll(ctx, jwtKeysKey).Result()
+	if err != nil {
+		return err
+	}
+	current, err := m.redis.Get(ctx, jwtCurrentKey).Result()
+	if err != nil && err != goredis.Nil {
+		return err
+	}
+
+	now := time.Now()
+	keys := make(map[string]*signingKey, len(raw))
+	for kid, data := range raw {
+		key, err := m.parseStoredKey(data)
+		if err != nil {
+			slog.Error("Failed to parse signing key", "kid", kid, "error", err)
+			continue
+		}
+		if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+			m.redis.HDel(ctx, jwtKeysKey, kid)
+			continue
+		}
+		if key.Private != nil {
+			// 旧版本的明文私钥改为加密保存
+			if err := m.saveEncrypted(ctx, key); err != nil {
+				return err
+			}
+		}
+		keys[kid] = key
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.current = current
+	m.loadedAt = now
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *KeyManager) parseStoredKey(data string) (*signingKey, error) {
+	var key signingKey
+	if err := json.Unmarshal([]byte(data), &key.storedKey); err != nil {
+		return nil, err
+	}
+	der := key.Private
+	if der == nil {
+		var err error
+		if der, err = m.decrypt(&key.storedKey); err != nil {
+			return nil, err
+		}
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	key.private = signer
+	key.public = signer.Public()
+	return &key, nil
+}
+
+// encrypt 用 key-encryption key 加密 PKCS#8 DER 私钥，清除明文
+func (m *KeyManager) encrypt(key *storedKey, der []byte) error {
+	nonce := make([]byte, m.kek.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key.Encrypted = m.kek.Seal(nonce, nonce, der, []byte(key.ID))
+	key.Private = nil
+	return nil
+}
+
+// decrypt 解密私钥，key_encryption_key 与加密时不同会返回错误
+func (m *KeyManager) decrypt(key *storedKey) ([]byte, error) {
+	n := m.kek.NonceSize()
+	if len(key.Encrypted) < n {
+		return nil, errors.New("missing private key")
+	}
+	der, err := m.kek.Open(nil, key.Encrypted[:n], key.Encrypted[n:], []byte(key.ID))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt private key (wrong jwt.key_encryption_key?): %w", err)
+	}
+	return der, nil
+}
+
+// saveEncrypted 把旧版本明文保存的私钥加密后写回
+func (m *KeyManager) saveEncrypted(ctx context.Context, key *signingKey) error {
+	if err := m.encrypt(&key.storedKey, key.Private); err != nil {
+		return err
+	}
+	data, err := json.Marshal(key.storedKey)
+	if err != nil {
+		return err
+	}
+	return m.redis.HSet(ctx, jwtKeysKey, key.ID, data).Err()
+}
+
+// Rotate 当前密钥不存在、算法不符或已到轮换时间时生成新密钥；force 为 true 时立即轮换。
+// 其他实例正在轮换时等待其完成并加载新密钥，避免本实例在没有签名密钥的情况下启动
+func (m *KeyManager) Rotate(ctx context.Context, force bool) error {
+	var cur *signingKey
+	for {
+		if err := m.Load(ctx); err != nil {
+			return err
+		}
+		if m.symmetric() {
+			return nil
+		}
+
+		m.mu.RLock()
+		cur = m.keys[m.current]
+		m.mu.RUnlock()
+		due := cur == nil || cur.Alg != m.config.Algorithm ||
+			time.Since(cur.CreatedAt) >= time.Duration(m.config.RotationInterval)*time.Second
+		if !force && !due {
+			return nil
+		}
+
+		ok, err := m.redis.SetNX(ctx, jwtRotateLockKey, 1, jwtRotateLockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+		if err := m.waitRotation(ctx); err != nil {
+			return err
+		}
+		// 其他实例已完成轮换，重新加载后按新的当前密钥判断
+		force = false
+	}
+	defer m.redis.Del(ctx, jwtRotateLockKey)
+
+	key, der, err := generateKey(m.config.Algorithm)
+	if err != nil {
+		return err
+	}
+	if err := m.encrypt(key, der); err != nil {
+		return err
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	maxTTL := time.Duration(m.config.MaxTokenTTL) * time.Second
+	_, err = m.redis.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, jwtKeysKey, key.ID, data)
+		if cur != nil {
+			// 旧密钥不再签发，保留到它签发的令牌全部过期
+			cur.ExpiresAt = time.Now().Add(maxTTL)
+			old, err := json.Marshal(cur.storedKey)
+			if err != nil {
+				return err
+			}
+			pipe.HSet(ctx, jwtKeysKey, cur.ID, old)
+		}
+		pipe.Set(ctx, jwtCurrentKey, key.ID, 0)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Rotated signing key", "kid", key.ID, "alg", key.Alg)
+	return m.Load(ctx)
+}
+
+// waitRotation 等待其他实例释放轮换锁，锁在 jwtRotateLockTTL 后自动过期
+func (m *KeyManager) waitRotation(ctx context.Context) error {
+	ticker := time.NewTicker(rotateWaitInterval)
+	defer ticker.Stop()
+	for {
+		held, err := m.redis.Exists(ctx, jwtRotateLockKey).Result()
+		if err != nil {
+			return err
+		}
+		if held == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// generateKey 生成新密钥，返回不含私钥的 storedKey 和 PKCS#8 DER 私钥
+func generateKey(alg string) (*storedKey, []byte, error) {
+	var private any
+	switch alg {
+	case config.JWTAlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, nil, err
+		}
+		private = key
+	case config.JWTAlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		private = key
+	default:
+		return nil, nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	kid := make([]byte, 12)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, nil, err
+	}
+	return &storedKey{
+		ID:        base64.RawURLEncoding.EncodeToString(kid),
+		Alg:       alg,
+		CreatedAt: time.Now(),
+	}, der, nil
+}
+
+// StartRotation 定期检查是否需要轮换，并重新加载其他实例生成的密钥
+func (m *KeyManager) StartRotation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Rotate(ctx, false); err != nil {
+				slog.Error("Failed to rotate signing key", "error", err)
+			}
+		}
+	}
+}
+
+// Sign 使用当前密钥签名，非对称算法在头部写入 kid
+func (m *KeyManager) Sign(claims jwt.MapClaims) (string, error) {
+	if m.symmetric() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	}
+
+	m.mu.RLock()
+	key := m.keys[m.current]
+	m.mu.RUnlock()
+	if key == nil {
+		return "", ErrUnknownKey
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// Parse 校验签名、算法、iss、aud 和 exp。算法必须与 kid 对应的密钥一致，
+// 没有 kid 的令牌只在 HS256 模式下接受。
+func (m *KeyManager) Parse(ctx context.Context, tokenStr string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			if !m.symmetric() || token.Method.Alg() != config.JWTAlgHS256 {
+				return nil, ErrUnknownKey
+			}
+			return m.secret, nil
+		}
+		key := m.lookup(ctx, kid)
+		if key == nil {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.Alg {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.public, nil
+	},
+		jwt.WithValidMethods([]string{config.JWTAlgHS256, config.JWTAlgRS256, config.JWTAlgEdDSA}),
+		jwt.WithIssuer(m.config.Issuer),
+		jwt.WithAudience(m.config.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// lookup 查找 kid 对应的密钥，本地没有时（其他实例刚轮换）从 Redis 重新加载
+func (m *KeyManager) lookup(ctx context.Context, kid string) *signingKey {
+	m.mu.RLock()
+	key, loadedAt := m.keys[kid], m.loadedAt
+	m.mu.RUnlock()
+	if key == nil && time.Since(loadedAt) > keyReloadInterval {
+		if err := m.Load(ctx); err != nil {
+			slog.Error("Failed to reload signing keys", "error", err)
+			return nil
+		}
+		m.mu.RLock()
+		key = m.keys[kid]
+		m.mu.RUnlock()
+	}
+	if key != nil && !key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt) {
+		return nil
+	}
+	return key
+}
+
+// JWK 公钥的 JSON Web Key 表示
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS 返回所有仍有效的公钥，HS256 密钥不公开
+func (m *KeyManager) JWKS() []JWK {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	keys := make([]JWK, 0, len(m.keys))
+	for _, key := range m.keys {
+		if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+			continue
+		}
+		jwk := JWK{Kid: key.ID, Alg: key.Alg, Use: "sig"}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
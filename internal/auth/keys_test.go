@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestKeys 在同一个 Redis 上创建密钥管理器，模拟一个实例
+func newTestKeys(rc *redis.Client, alg, kek string) *KeyManager {
+	return NewKeyManager(rc, config.JWTConfig{Algorithm: alg, Issuer: "ibed", Audience: "ibed",
+		RotationInterval: 3600, MaxTokenTTL: 3600, KeyEncryptionKey: kek}, "")
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"iss": "ibed", "aud": "ibed", "exp": time.Now().Add(time.Minute).Unix(), "user_id": "u1"}
+}
+
+func TestRotate(t *testing.T) {
+	for _, alg := range []string{config.JWTAlgRS256, config.JWTAlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			ctx := context.Background()
+			a, _ := newTestAuth(t, nil)
+			m := newTestKeys(a.redis, alg, "kek")
+			if err := m.Rotate(ctx, false); err != nil {
+				t.Fatal(err)
+			}
+			first := m.current
+			old, err := m.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := m.Rotate(ctx, false); err != nil {
+				t.Fatal(err)
+			}
+			if m.current != first {
+				t.Fatal("rotated before the rotation interval")
+			}
+			if err := m.Rotate(ctx, true); err != nil {
+				t.Fatal(err)
+			}
+			if m.current == first {
+				t.Fatal("forced rotation kept the current key")
+			}
+
+			// 旧密钥签发的令牌在过期前仍然有效，两个公钥都公开
+			if _, err := m.Parse(ctx, old); err != nil {
+				t.Errorf("token signed by the previous key: %v", err)
+			}
+			if n := len(m.JWKS()); n != 2 {
+				t.Errorf("JWKS has %d keys, want 2", n)
+			}
+			// 其他实例从 Redis 加载后可以校验新令牌
+			token, _ := m.Sign(testClaims())
+			other := newTestKeys(a.redis, alg, "kek")
+			if _, err := other.Parse(ctx, token); err != nil {
+				t.Errorf("other instance: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrivateKeyEncryption(t *testing.T) {
+	tests := []struct {
+		name     string
+		loadKEK  string
+		wantLoad bool
+	}{
+		{"same key-encryption key", "kek", true},
+		{"different key-encryption key", "other", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, mr := newTestAuth(t, nil)
+			m := newTestKeys(a.redis, config.JWTAlgEdDSA, "kek")
+			if err := m.Rotate(ctx, false); err != nil {
+				t.Fatal(err)
+			}
+			stored := mr.HGet(jwtKeysKey, m.current)
+			if strings.Contains(stored, `"private"`) {
+				t.Fatalf("private key stored in plaintext: %s", stored)
+			}
+
+			other := newTestKeys(a.redis, config.JWTAlgEdDSA, tt.loadKEK)
+			if err := other.Load(ctx); err != nil {
+				t.Fatal(err)
+			}
+			_, err := other.Sign(testClaims())
+			if loaded := err == nil; loaded != tt.wantLoad {
+				t.Errorf("signing after load: %v, want loaded %v", err, tt.wantLoad)
+			}
+			if !tt.wantLoad && !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("error = %v, want ErrUnknownKey", err)
+			}
+		})
+	}
+}
+
+func TestLoadEncryptsLegacyPlaintextKey(t *testing.T) {
+	ctx := context.Background()
+	a, mr := newTestAuth(t, nil)
+	key, der, err := generateKey(config.JWTAlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Private = der
+	data, _ := json.Marshal(key)
+	mr.HSet(jwtKeysKey, key.ID, string(data))
+	mr.Set(jwtCurrentKey, key.ID)
+
+	m := newTestKeys(a.redis, config.JWTAlgEdDSA, "kek")
+	if err := m.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Sign(testClaims()); err != nil {
+		t.Fatalf("legacy key unusable: %v", err)
+	}
+	if stored := mr.HGet(jwtKeysKey, key.ID); strings.Contains(stored, `"private"`) {
+		t.Errorf("legacy key still stored in plaintext: %s", stored)
+	}
+}
+
+func TestRotateWaitsForOtherInstance(t *testing.T) {
+	ctx := context.Background()
+	a, mr := newTestAuth(t, nil)
+	// 其他实例持有轮换锁
+	mr.Set(jwtRotateLockKey, "1")
+
+	waiting := newTestKeys(a.redis, config.JWTAlgRS256, "kek")
+	holder := newTestKeys(a.redis, config.JWTAlgRS256, "kek")
+	var wg sync.WaitGroup
+	var waitErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		waitErr = waiting.Rotate(ctx, false)
+	}()
+
+	time.Sleep(3 * rotateWaitInterval)
+	mr.Del(jwtRotateLockKey)
+	if err := holder.Rotate(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if waitErr != nil {
+		t.Fatal(waitErr)
+	}
+
+	// 只生成了一个密钥，两个实例都加载了它
+	if keys, _ := mr.HKeys(jwtKeysKey); len(keys) != 1 {
+		t.Errorf("%d keys generated, want 1", len(keys))
+	}
+	holder.Load(ctx)
+	if waiting.current == "" || waiting.current != holder.current {
+		t.Errorf("waiting instance current key %q, holder %q", waiting.current, holder.current)
+	}
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// 最近访问时间的更新间隔，避免每个请求都写 Redis
+const sessionTouchInterval = time.Minute
+
+var ErrSessionRevoked = errors.New("session revoked")
+
+// ClientInfo 发起登录的客户端信息，记录在会话中
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// tokenTTL 令牌有效期，不超过 jwt.max_token_ttl
+func (a *Auth) tokenTTL(expiresIn time.Duration) time.Duration {
+	if maxTTL := time.Duration(a.config.JWT.MaxTokenTTL) * time.Second; expiresIn > maxTTL {
+		return maxTTL
+	}
+	return expiresIn
+}
+
+// startSession 创建会话并签发关联该会话的令牌
+func (a *Auth) startSession(ctx context.Context, user *model.User, mfa bool, client ClientInfo, expiresIn time.Duration) (*LoginResult, error) {
+	if user.Status == model.StatusDeleting {
+		return nil, ErrInvalidCredentials
+	}
+	if _, err := checkStatus(user); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresIn = a.tokenTTL(expiresIn)
+	session := &model.Session{
+		ID:        hex.EncodeToString(buf),
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		MFA:       mfa,
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now.Add(expiresIn),
+	}
+	if err := a.redis.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	token, err := a.GenerateToken(TokenClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		MFA:       mfa,
+		SessionID: session.ID,
+	}, expiresIn)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Token: token}, nil
+}
+
+// ValidateSession 检查令牌关联的会话仍然有效且账户未被暂停或封禁，返回账户当前生效的状态。
+// 同时定期更新会话的最近访问时间和 IP。
+func (a *Auth) ValidateSession(ctx context.Context, claims *TokenClaims, ip string) (model.UserStatus, error) {
+	if claims.SessionID == "" {
+		return "", ErrSessionRevoked
+	}
+	session, err := a.redis.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return "", err
+	}
+	if session == nil || session.UserID != claims.UserID {
+		return "", ErrSessionRevoked
+	}
+	user, err := a.redis.GetUser(ctx, claims.UserID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", ErrSessionRevoked
+	}
+	status, err := checkStatus(user)
+	if err != nil {
+		return status, err
+	}
+	if time.Since(session.LastSeen) >= sessionTouchInterval || session.IP != ip {
+		session.LastSeen = time.Now()
+		session.IP = ip
+		return status, a.redis.TouchSession(ctx, session)
+	}
+	return status, nil
+}
+
+// RefreshToken 延长当前会话并签发新令牌，会话已被撤销时返回 ErrSessionRevoked。
+// 用户名和角色从用户数据重新读取，修改后在刷新时生效。
+func (a *Auth) RefreshToken(ctx context.Context, claims TokenClaims, expiresIn time.Duration) (string, error) {
+	user, err := a.redis.GetUser(ctx, claims.UserID)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", ErrSessionRevoked
+	}
+	if _, err := checkStatus(user); err != nil {
+		return "", err
+	}
+	claims.Username = user.Username
+	claims.Role = user.Role
+
+	session, err := a.redis.GetSession(ctx, claims.SessionID)
+	if err != nil {
+		return "", err
+	}
+	if session == nil || session.UserID != claims.UserID {
+		return "", ErrSessionRevoked
+	}
+	expiresIn = a.tokenTTL(expiresIn)
+	session.LastSeen = time.Now()
+	session.ExpiresAt = session.LastSeen.Add(expiresIn)
+	ok, err := a.redis.ExtendSession(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrSessionRevoked
+	}
+	return a.GenerateToken(claims, expiresIn)
+}
+
+// ListSessions 返回用户当前的登录会话
+func (a *Auth) ListSessions(ctx context.Context, userID string) ([]*model.Session, error) {
+	return a.redis.ListSessions(ctx, userID)
+}
+
+// RevokeSession 撤销用户的某个会话，会话不存在时返回 false
+func (a *Auth) RevokeSession(ctx context.Context, userID, sessionID string) (bool, error) {
+	return a.redis.DeleteSession(ctx, userID, sessionID)
+}
+
+// RevokeAllSessions 撤销用户的全部会话，所有已签发的令牌立即失效
+func (a *Auth) RevokeAllSessions(ctx context.Context, userID string) (int, error) {
+	return a.redis.DeleteUserSessions(ctx, userID)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionRevocation(t *testing.T) {
+	ctx := context.Background()
+	client := ClientInfo{IP: "192.0.2.1"}
+	tests := []struct {
+		name    string
+		revoke  func(t *testing.T, a *Auth, userID, current, other string)
+		wantErr error
+	}{
+		{"active session", func(*testing.T, *Auth, string, string, string) {}, nil},
+		{"other session revoked", func(t *testing.T, a *Auth, userID, _, other string) {
+			if ok, err := a.RevokeSession(ctx, userID, other); err != nil || !ok {
+				t.Fatalf("RevokeSession() = %v, %v", ok, err)
+			}
+		}, nil},
+		{"session revoked", func(t *testing.T, a *Auth, userID, current, _ string) {
+			if ok, err := a.RevokeSession(ctx, userID, current); err != nil || !ok {
+				t.Fatalf("RevokeSession() = %v, %v", ok, err)
+			}
+		}, ErrSessionRevoked},
+		{"all sessions revoked", func(t *testing.T, a *Auth, userID, _, _ string) {
+			if n, err := a.RevokeAllSessions(ctx, userID); err != nil || n != 2 {
+				t.Fatalf("RevokeAllSessions() = %d, %v", n, err)
+			}
+		}, ErrSessionRevoked},
+		{"password set", func(t *testing.T, a *Auth, userID, _, _ string) {
+			user, _ := a.redis.GetUser(ctx, userID)
+			if err := a.SetPassword(ctx, user, "new-password"); err != nil {
+				t.Fatal(err)
+			}
+		}, ErrSessionRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAuth(t, nil)
+			user := registerUser(t, a, "alice")
+			login := func() *TokenClaims {
+				res, err := a.Login(ctx, "alice", "password", client, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				claims, err := a.ParseToken(ctx, res.Token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return claims
+			}
+			claims, other := login(), login()
+			if claims.SessionID == "" || claims.SessionID == other.SessionID {
+				t.Fatalf("session IDs %q and %q", claims.SessionID, other.SessionID)
+			}
+
+			tt.revoke(t, a, user.ID, claims.SessionID, other.SessionID)
+
+			if _, err := a.ValidateSession(ctx, claims, client.IP); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateSession() error = %v, want %v", err, tt.wantErr)
+			}
+			token, err := a.RefreshToken(ctx, *claims, time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RefreshToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				refreshed, err := a.ParseToken(ctx, token)
+				if err != nil || refreshed.SessionID != claims.SessionID {
+					t.Errorf("refreshed token session = %+v, %v; want %s", refreshed, err, claims.SessionID)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSessionRejectsForeignTokens(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuth(t, nil)
+	alice := registerUser(t, a, "alice")
+	registerUser(t, a, "bob")
+	res, err := a.Login(ctx, "bob", "password", ClientInfo{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := a.ParseToken(ctx, res.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims TokenClaims
+	}{
+		// 未关联会话的令牌（如会话功能之前签发的）不再有效
+		{"no sid", TokenClaims{UserID: alice.ID, Username: "alice", Role: alice.Role}},
+		{"unknown sid", TokenClaims{UserID: alice.ID, Username: "alice", Role: alice.Role, SessionID: "missing"}},
+		{"another user's sid", TokenClaims{UserID: alice.ID, Username: "alice", Role: alice.Role, SessionID: bob.SessionID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := a.GenerateToken(tt.claims, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := a.ParseToken(ctx, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := a.ValidateSession(ctx, claims, ""); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("ValidateSession() error = %v, want %v", err, ErrSessionRevoked)
+			}
+			if _, err := a.RefreshToken(ctx, *claims, time.Hour); !errors.Is(err, ErrSessionRevoked) {
+				t.Errorf("RefreshToken() error = %v, want %v", err, ErrSessionRevoked)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// RestrictedError 账户被暂停或封禁，不能登录和访问接口
+type RestrictedError struct {
+	Status    model.UserStatus
+	Reason    string
+	ExpiresAt *time.Time // 为空表示不过期
+}
+
+func (e *RestrictedError) Error() string {
+	return fmt.Sprintf("account %s", e.Status)
+}
+
+// checkStatus 返回用户当前生效的状态，暂停或封禁时返回 RestrictedError
+func checkStatus(user *model.User) (model.UserStatus, error) {
+	status := user.EffectiveStatus(time.Now())
+	if status.Blocked() {
+		return status, &RestrictedError{Status: status, Reason: user.StatusReason, ExpiresAt: user.StatusExpiresAt}
+	}
+	return status, nil
+}
+
+// StatusChange 管理员修改账户状态的参数
+type StatusChange struct {
+	Status     model.UserStatus
+	Reason     string
+	ExpiresAt  time.Time // 零值表示不过期
+	HideImages bool      // 仅对暂停和封禁生效
+}
+
+// SetStatus 修改账户状态；暂停或封禁时撤销全部会话，并按需隐藏公开图片
+func (a *Auth) SetStatus(ctx context.Context, user *model.User, change StatusChange, operator string) error {
+	user.Status = change.Status
+	user.StatusReason = change.Reason
+	user.StatusExpiresAt = nil
+	if !change.ExpiresAt.IsZero() {
+		user.StatusExpiresAt = &change.ExpiresAt
+	}
+	user.HideImages = change.HideImages && change.Status.Blocked()
+	if change.Status == model.StatusActive {
+		user.StatusReason = ""
+		user.StatusExpiresAt = nil
+	}
+	if err := a.redis.SaveUser(ctx, user); err != nil {
+		return err
+	}
+
+	if user.HideImages {
+		if err := a.redis.HideUserImages(ctx, user.ID, change.ExpiresAt); err != nil {
+			return err
+		}
+	} else if err := a.redis.UnhideUserImages(ctx, user.ID); err != nil {
+		return err
+	}
+	if change.Status.Blocked() {
+		if _, err := a.RevokeAllSessions(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	details := map[string]string{"status": string(user.Status), "reason": user.StatusReason}
+	if user.StatusExpiresAt != nil {
+		details["expires_at"] = user.StatusExpiresAt.Format(time.RFC3339)
+	}
+	if user.HideImages {
+		details["hide_images"] = "true"
+	}
+	a.audit.Record(ctx, model.AuditEvent{Action: model.AuditStatusChange, ActorID: operator, Target: user.ID, Details: details})
+	return nil
+}
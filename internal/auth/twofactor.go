@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	pendingTOTPTTL     = 10 * time.Minute
+	challengeTTL       = 5 * time.Minute
+	maxChallengeTries  = 5
+	qrCodeSize         = 256
+	usedTOTPStepMaxTTL = (2*totpSkew + 1) * totpPeriod * time.Second
+)
+
+var (
+	ErrInvalidCode       = errors.New("invalid verification code")
+	ErrChallengeExpired  = errors.New("challenge expired")
+	ErrTOTPNotEnabled    = errors.New("two-factor authentication not enabled")
+	ErrTOTPAlreadyActive = errors.New("two-factor authentication already enabled")
+	ErrNoPendingTOTP     = errors.New("no pending two-factor enrolment")
+)
+
+// LoginResult 登录结果，开启两步验证的用户只返回 Challenge，需再调用 CompleteLogin
+type LoginResult struct {
+	Token             string `json:"token,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+}
+
+// TOTPEnrollment 两步验证登记信息
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode []byte `json:"qr_code"` // PNG，JSON 中为 Base64
+}
+
+type loginChallenge struct {
+	UserID    string `json:"user_id"`
+	ExpiresIn int64  `json:"expires_in"` // 秒
+}
+
+func pendingTOTPKey(userID string) string {
+	return fmt.Sprintf("2fa:pending:%s", userID)
+}
+
+func challengeKey(challenge string) string {
+	return fmt.Sprintf("2fa:challenge:%s", challenge)
+}
+
+// BeginTOTPEnrollment 生成待激活的密钥，需调用 ActivateTOTP 验证后才会生效
+func (a *Auth) BeginTOTPEnrollment(ctx context.Context, user *model.User) (*TOTPEnrollment, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyActive
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	uri := TOTPURI(a.config.TwoFactor.Issuer, user.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.redis.Set(ctx, pendingTOTPKey(user.ID), secret, pendingTOTPTTL).Err(); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{Secret: secret, URI: uri, QRCode: png}, nil
+}
+
+// ActivateTOTP 用验证码确认登记，返回恢复码明文（只展示这一次）
+func (a *Auth) ActivateTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyActive
+	}
+	secret, err := a.redis.Get(ctx, pendingTOTPKey(userID)).Result()
+	if err == goredis.Nil {
+		return nil, ErrNoPendingTOTP
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ValidateTOTP(secret, code, time.Now()); !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+	user.TOTPEnabled = true
+	user.RecoveryCodes = hashes
+	if err := a.redis.SaveUser(ctx, user); err != nil {
+		return nil, err
+	}
+	a.redis.Del(ctx, pendingTOTPKey(userID))
+	return codes, nil
+}
+
+// DisableTOTP 关闭两步验证，需要同时提供密码和验证码（或恢复码）
+func (a *Auth) DisableTOTP(ctx context.Context, userID, password, code string) error {
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Password != a.HashPassword(password) {
+		return ErrInvalidCredentials
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+	if err := a.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.RecoveryCodes = nil
+	return a.redis.SaveUser(ctx, user)
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func (a *Auth) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := a.redis.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnabled
+	}
+	if err := a.verifySecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.RecoveryCodes = hashes
+	if err := a.redis.SaveUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newChallenge 密码验证通过后为两步验证用户签发短期挑战
+func (a *Auth) newChallenge(ctx context.Context, user *model.User, expiresIn time.Duration) (*LoginResult, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	challenge := hex.EncodeToString(buf)
+	data, err := json.Marshal(loginChallenge{UserID: user.ID, ExpiresIn: int64(expiresIn / time.Second)})
+	if err != nil {
+		return nil, err
+	}
+	if err := a.redis.Set(ctx, challengeKey(challenge), data, challengeTTL).Err(); err != nil {
+		return nil, err
+	}
+	return &LoginResult{Challenge: challenge, TwoFactorRequired: true}, nil
+}
+
+// CompleteLogin 校验挑战对应的验证码或恢复码并签发令牌，连续错误过多时挑战作废；
+// 错误的验证码计入登录失败次数，触发与密码错误相同的退避和锁定
+func (a *Auth) CompleteLogin(ctx context.Context, challenge, code string, client ClientInfo) (*LoginResult, error) {
+	user, result, err := a.completeLogin(ctx, challenge, code, client)
+	a.recordLogin(ctx, "2fa", "", user, client, result, err)
+	return result, err
+}
+
+func (a *Auth) completeLogin(ctx context.Context, challenge, code string, client ClientInfo) (*model.User, *LoginResult, error) {
+	key := challengeKey(challenge)
+	data, err := a.redis.Get(ctx, key).Bytes()
+	if err == goredis.Nil {
+		return nil, nil, ErrChallengeExpired
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var ch loginChallenge
+	if err := json.Unmarshal(data, &ch); err != nil {
+		return nil, nil, err
+	}
+	user, err := a.redis.GetUser(ctx, ch.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, ErrChallengeExpired
+	}
+
+	// 验证码错误与密码错误一起按用户名和 IP 计数，达到阈值后同样被锁定
+	if err := a.guard.Check(ctx, user.Username, client.IP); err != nil {
+		return user, nil, err
+	}
+	if err := a.verifySecondFactor(ctx, user, code); err != nil {
+		if err != ErrInvalidCode {
+			return user, nil, err
+		}
+		tries, _ := a.redis.Incr(ctx, key+":tries").Result()
+		a.redis.Expire(ctx, key+":tries", challengeTTL)
+		if tries >= maxChallengeTries {
+			a.redis.Del(ctx, key, key+":tries")
+		}
+		if err := a.guard.Fail(ctx, user.Username, client.IP); err != nil {
+			return user, nil, err
+		}
+		return user, nil, ErrInvalidCode
+	}
+	a.redis.Del(ctx, key, key+":tries")
+	if err := a.guard.Succeed(ctx, user.Username, client.IP); err != nil {
+		return user, nil, err
+	}
+
+	result, err := a.startSession(ctx, user, true, client, time.Duration(ch.ExpiresIn)*time.Second)
+	return user, result, err
+}
+
+// verifySecondFactor 校验 TOTP 验证码（同一时间步只能使用一次）或消耗一个恢复码
+func (a *Auth) verifySecondFactor(ctx context.Context, user *model.User, code string) error {
+	if step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		fresh, err := a.redis.SetNX(ctx, fmt.Sprintf("2fa:used:%s:%d", user.ID, step), 1, usedTOTPStepMaxTTL).Result()
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	// 恢复码在 Redis 中原子地移除，并发使用同一个恢复码时只有一个成功
+	used, err := a.redis.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// codeAt 计算 now 所在时间步偏移 offset 个时间步的验证码
+func codeAt(t *testing.T, secret string, now time.Time, offset int64) string {
+	t.Helper()
+	key, err := b32.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, uint64(now.Unix()/totpPeriod+offset))
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"current step", secret, codeAt(t, secret, now, 0), true},
+		{"previous step", secret, codeAt(t, secret, now, -1), true},
+		{"next step", secret, codeAt(t, secret, now, 1), true},
+		{"two steps old", secret, codeAt(t, secret, now, -2), false},
+		{"lower case secret", strings.ToLower(secret), codeAt(t, secret, now, 0), true},
+		{"wrong length", secret, "12345", false},
+		{"invalid secret", "not base32!", "123456", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok != tt.want {
+				t.Errorf("ValidateTOTP() = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+// enableTOTP 为用户直接启用两步验证，返回密钥
+func enableTOTP(t *testing.T, a *Auth, user *model.User) string {
+	t.Helper()
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.TOTPSecret, user.TOTPEnabled, user.RecoveryCodes = secret, true, hashes
+	if err := a.redis.SaveUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestCompleteLogin(t *testing.T) {
+	ctx := context.Background()
+	client := ClientInfo{IP: "192.0.2.1"}
+	tests := []struct {
+		name     string
+		failures int  // 提交正确验证码前，每次重新登录后提交错误验证码的次数
+		reuse    bool // 重复提交已使用过的验证码
+		wantErr  error
+		locked   bool
+	}{
+		{"valid code", 0, false, nil, false},
+		{"some failures then valid", 2, false, nil, false},
+		{"replayed code", 0, true, ErrInvalidCode, false},
+		{"failures across challenges lock the account", 3, false, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, mr := newTestAuth(t, func(cfg *config.Config) {
+				cfg.LoginProtection.MaxUserFailures = 3
+			})
+			user := registerUser(t, a, "alice")
+			secret := enableTOTP(t, a, user)
+
+			for i := 0; i < tt.failures; i++ {
+				res, err := a.Login(ctx, "alice", "password", client, time.Hour)
+				if err != nil {
+					t.Fatalf("login %d: %v", i, err)
+				}
+				if _, err := a.CompleteLogin(ctx, res.Challenge, "000000", client); !errors.Is(err, ErrInvalidCode) {
+					t.Fatalf("wrong code %d: %v", i, err)
+				}
+				mr.FastForward(time.Minute) // 跳过退避期
+			}
+
+			res, err := a.Login(ctx, "alice", "password", client, time.Hour)
+			var lockedErr *LockedError
+			if tt.locked {
+				if !errors.As(err, &lockedErr) {
+					t.Fatalf("login after %d second factor failures: %v, want locked", tt.failures, err)
+				}
+				return
+			}
+			if err != nil || !res.TwoFactorRequired {
+				t.Fatalf("login: %v %+v", err, res)
+			}
+			code := codeAt(t, secret, time.Now(), 0)
+			if tt.reuse {
+				if _, err := a.CompleteLogin(ctx, res.Challenge, code, client); err != nil {
+					t.Fatalf("first use: %v", err)
+				}
+				if res, err = a.Login(ctx, "alice", "password", client, time.Hour); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result, err := a.CompleteLogin(ctx, res.Challenge, code, client)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CompleteLogin() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.Token == "" {
+				t.Error("no token issued")
+			}
+			if err == nil && mr.Exists("login:fail:user:alice") {
+				t.Error("failure count not cleared after second factor passed")
+			}
+		})
+	}
+}
+
+func TestLoginKeepsFailuresUntilSecondFactor(t *testing.T) {
+	ctx := context.Background()
+	a, mr := newTestAuth(t, nil)
+	user := registerUser(t, a, "alice")
+	enableTOTP(t, a, user)
+
+	if _, err := a.Login(ctx, "alice", "wrong", ClientInfo{IP: "192.0.2.1"}, time.Hour); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatal(err)
+	}
+	mr.FastForward(time.Minute)
+	if _, err := a.Login(ctx, "alice", "password", ClientInfo{IP: "192.0.2.1"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("login:fail:user:alice") {
+		t.Error("correct password alone cleared the failure count")
+	}
+}
+
+func TestRecoveryCodeUsedOnce(t *testing.T) {
+	ctx := context.Background()
+	a, _ := newTestAuth(t, nil)
+	user := registerUser(t, a, "alice")
+	enableTOTP(t, a, user)
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.RecoveryCodes = hashes
+	if err := a.redis.SaveUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// 多个登录挑战同时提交同一个恢复码，只有一个成功
+	const parallel = 8
+	challenges := make([]string, parallel)
+	for i := range challenges {
+		client := ClientInfo{IP: fmt.Sprintf("192.0.2.%d", i+1)}
+		res, err := a.Login(ctx, "alice", "password", client, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		challenges[i] = res.Challenge
+	}
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i, challenge := range challenges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := ClientInfo{IP: fmt.Sprintf("192.0.2.%d", i+1)}
+			if _, err := a.CompleteLogin(ctx, challenge, codes[0], client); err == nil {
+				succeeded.Add(1)
+			} else if !errors.Is(err, ErrInvalidCode) {
+				t.Errorf("CompleteLogin() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := succeeded.Load(); n != 1 {
+		t.Errorf("recovery code accepted %d times, want 1", n)
+	}
+
+	saved, err := a.redis.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.RecoveryCodes) != len(hashes)-1 {
+		t.Errorf("%d recovery codes left, want %d", len(saved.RecoveryCodes), len(hashes)-1)
+	}
+	if !saved.TOTPEnabled || saved.TOTPSecret != user.TOTPSecret {
+		t.Error("spending a recovery code changed other user fields")
+	}
+}
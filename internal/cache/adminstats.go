@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/redis"
+)
+
+// StartAdminStatsSweep 定期扣减随过期时间删除的图片的统计计数器，并清理超过保留期的每日统计
+func StartAdminStatsSweep(ctx context.Context, redis *redis.Client, interval time.Duration) {
+	sweep := func() {
+		now := time.Now()
+		swept, err := redis.SweepExpiredImages(ctx, now)
+		if err != nil {
+			slog.Error("Failed to sweep expired images", "error", err)
+			return
+		}
+		trimmed, err := redis.TrimDailyStats(ctx, now)
+		if err != nil {
+			slog.Error("Failed to trim daily stats", "error", err)
+			return
+		}
+		slog.Info("Swept admin stats", "expired_images", swept, "trimmed_days", trimmed)
+	}
+
+	sweep()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep()
+		}
+	}
+}
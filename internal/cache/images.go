@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultTopN 默认预热的热门图片数量
+	DefaultTopN = 10
+	// DefaultMaxBytes 默认内存预算（64 MiB）
+	DefaultMaxBytes = 64 << 20
+)
+
+// CachedImage 缓存中的图片内容
+type CachedImage struct {
+	ID       string
+	Filename string
+	Data     []byte
+	ModTime  time.Time
+}
+
+// Stats 缓存命中统计
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxItems  int    `json:"max_items"`
+	MaxBytes  int64  `json:"max_bytes"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// ImageCache 进程内的热门图片字节缓存，按条目数和总字节数双重限制，超出时按 LRU 淘汰
+type ImageCache struct {
+	mu       sync.Mutex
+	maxItems int
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+func NewImageCache(maxItems int, maxBytes int64) *ImageCache {
+	if maxItems <= 0 {
+		maxItems = DefaultTopN
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &ImageCache{
+		maxItems: maxItems,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get 读取缓存，命中时将条目移到队首
+func (c *ImageCache) Get(id string) (*CachedImage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[id]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	c.hits.Add(1)
+	return el.Value.(*CachedImage), true
+}
+
+// Contains 判断图片是否已缓存，不影响统计和 LRU 顺序
+func (c *ImageCache) Contains(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[id]
+	return ok
+}
+
+// Touch 将已缓存的条目移到队首，不影响统计，条目不存在时返回 false
+func (c *ImageCache) Touch(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[id]
+	if ok {
+		c.ll.MoveToFront(el)
+	}
+	return ok
+}
+
+// Set 写入缓存，单个文件超过内存预算时返回 false
+func (c *ImageCache) Set(img *CachedImage) bool {
+	n := int64(len(img.Data))
+	if n > c.maxBytes {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[img.ID]; ok {
+		c.size += n - int64(len(el.Value.(*CachedImage).Data))
+		el.Value = img
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[img.ID] = c.ll.PushFront(img)
+		c.size += n
+	}
+
+	for c.ll.Len() > c.maxItems || c.size > c.maxBytes {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+	return true
+}
+
+// Delete 移除缓存条目，用于图片被删除时
+func (c *ImageCache) Delete(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[id]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Retain 只保留给定 ID 的条目，其余全部淘汰
+func (c *ImageCache) Retain(ids []string) {
+	keep := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		keep[id] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, el := range c.items {
+		if _, ok := keep[id]; !ok {
+			c.removeElement(el)
+			c.evictions.Add(1)
+		}
+	}
+}
+
+func (c *ImageCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Entries:   c.ll.Len(),
+		Bytes:     c.size,
+		MaxItems:  c.maxItems,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+func (c *ImageCache) removeElement(el *list.Element) {
+	img := el.Value.(*CachedImage)
+	c.ll.Remove(el)
+	delete(c.items, img.ID)
+	c.size -= int64(len(img.Data))
+}
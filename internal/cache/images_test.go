@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+	"github.com/notes-bin/ibed/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func cached(id string, size int) *CachedImage {
+	return &CachedImage{ID: id, Data: make([]byte, size)}
+}
+
+// keys 返回缓存中的 ID，从队首（最近使用）到队尾
+func keys(c *ImageCache) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := []string{}
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		ids = append(ids, el.Value.(*CachedImage).ID)
+	}
+	return ids
+}
+
+func TestImageCacheEviction(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxItems      int
+		maxBytes      int64
+		ops           func(c *ImageCache)
+		want          []string
+		wantEvictions uint64
+	}{
+		{"item limit evicts least recently used", 2, 100, func(c *ImageCache) {
+			c.Set(cached("a", 1))
+			c.Set(cached("b", 1))
+			c.Get("a")
+			c.Set(cached("c", 1))
+		}, []string{"c", "a"}, 1},
+		{"byte budget evicts until it fits", 10, 10, func(c *ImageCache) {
+			c.Set(cached("a", 4))
+			c.Set(cached("b", 4))
+			c.Set(cached("c", 8))
+		}, []string{"c"}, 2},
+		{"oversize image rejected", 10, 10, func(c *ImageCache) {
+			c.Set(cached("a", 4))
+			if c.Set(cached("big", 11)) {
+				t.Error("oversize image accepted")
+			}
+		}, []string{"a"}, 0},
+		{"touch moves to front", 2, 100, func(c *ImageCache) {
+			c.Set(cached("a", 1))
+			c.Set(cached("b", 1))
+			c.Touch("a")
+			c.Set(cached("c", 1))
+		}, []string{"c", "a"}, 1},
+		{"replace keeps byte count", 10, 10, func(c *ImageCache) {
+			c.Set(cached("a", 6))
+			c.Set(cached("a", 2))
+			c.Set(cached("b", 8))
+		}, []string{"b", "a"}, 0},
+		{"retain drops others", 10, 100, func(c *ImageCache) {
+			c.Set(cached("a", 1))
+			c.Set(cached("b", 1))
+			c.Set(cached("c", 1))
+			c.Retain([]string{"b", "x"})
+		}, []string{"b"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewImageCache(tt.maxItems, tt.maxBytes)
+			tt.ops(c)
+			if got := keys(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries %v, want %v", got, tt.want)
+			}
+			stats := c.Stats()
+			if stats.Evictions != tt.wantEvictions {
+				t.Errorf("evictions %d, want %d", stats.Evictions, tt.wantEvictions)
+			}
+			if stats.Bytes > tt.maxBytes {
+				t.Errorf("bytes %d over budget %d", stats.Bytes, tt.maxBytes)
+			}
+		})
+	}
+}
+
+func TestImageCacheStats(t *testing.T) {
+	c := NewImageCache(10, 100)
+	c.Set(cached("a", 3))
+	c.Get("a")
+	c.Get("a")
+	c.Get("missing")
+	c.Contains("missing")
+	c.Touch("a")
+
+	stats := c.Stats()
+	want := Stats{Entries: 1, Bytes: 3, MaxItems: 10, MaxBytes: 100, Hits: 2, Misses: 1}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestRefreshTopKeepsHighestRanked(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rc, err := redis.NewClient(mr.Addr(), "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	st, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// img1 访问最多；img3 超出预算剩余部分，img4 单张超出预算，均不读取
+	sizes := map[string]int{"img1": 40, "img2": 40, "img3": 40, "img4": 200}
+	for i, id := range []string{"img1", "img2", "img3", "img4"} {
+		img := &model.Image{ID: id, Filename: id + ".png", Size: int64(sizes[id]), CreatedAt: time.Now()}
+		if err := rc.SaveImage(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := st.SaveFile(bytes.NewReader(make([]byte, sizes[id])), st.GetFilePath(img.Filename)); err != nil {
+			t.Fatal(err)
+		}
+		for v := 0; v < 10-i; v++ {
+			rc.IncrementView(ctx, id, 7)
+		}
+	}
+
+	hot := NewImageCache(10, 100)
+	refreshTop(ctx, rc, st, hot, 10)
+	if got := keys(hot); !reflect.DeepEqual(got, []string{"img1", "img2"}) {
+		t.Fatalf("entries %v, want [img1 img2]", got)
+	}
+
+	// 新图片挤出的是排名靠后的图片
+	hot.Set(cached("new", 40))
+	if !hot.Contains("img1") || hot.Contains("img2") {
+		t.Errorf("entries %v, want img1 kept and img2 evicted", keys(hot))
+	}
+}
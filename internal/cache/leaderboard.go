@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/redis"
+)
+
+// StartLeaderboardRollup 定期汇总周榜、热度榜并清理过期的访问天桶
+func StartLeaderboardRollup(ctx context.Context, redis *redis.Client, retentionDays int, halfLife time.Duration, interval int) {
+	rollup := func() {
+		now := time.Now()
+		if err := redis.RollupLeaderboards(ctx, now, retentionDays, halfLife); err != nil {
+			slog.Error("Failed to roll up leaderboards", "error", err)
+			return
+		}
+		removed, err := redis.CleanupViewBuckets(ctx, now, retentionDays)
+		if err != nil {
+			slog.Error("Failed to clean up view buckets", "error", err)
+			return
+		}
+		slog.Info("Rolled up leaderboards", "removed_buckets", removed)
+	}
+
+	rollup()
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rollup()
+		}
+	}
+}
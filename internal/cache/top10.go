@@ -5,10 +5,19 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/notes-bin/ibed/internal/model"
 	"github.com/notes-bin/ibed/internal/redis"
+	"github.com/notes-bin/ibed/internal/storage"
 )
 
-func StartTop10Refresh(ctx context.Context, redis *redis.Client, interval int) {
+func StartTop10Refresh(ctx context.Context, redis *redis.Client, store *storage.Storage, hot *ImageCache, topN, interval int) {
+	if topN <= 0 {
+		topN = DefaultTopN
+	}
+
+	// 启动时先预热一次
+	refreshTop(ctx, redis, store, hot, topN)
+
 	ticker := time.NewTicker(time.Duration(interval) * time.Second)
 	defer ticker.Stop()
 
@@ -17,14 +26,51 @@ func StartTop10Refresh(ctx context.Context, redis *redis.Client, interval int) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// 获取 Top10 图片 ID
-			ids, err := redis.GetTop10Images(ctx)
-			if err != nil {
-				slog.Error("Failed to refresh Top10", "error", err)
-				continue
-			}
-			// 缓存到 Redis（可选：直接使用 Sorted Set）
-			slog.Info("Refreshed Top10 cache", "ids", ids)
+			refreshTop(ctx, redis, store, hot, topN)
 		}
 	}
 }
+
+func refreshTop(ctx context.Context, redis *redis.Client, store *storage.Storage, hot *ImageCache, topN int) {
+	// 获取 TopN 图片 ID
+	ids, err := redis.GetTopImages(ctx, topN)
+	if err != nil {
+		slog.Error("Failed to refresh Top10", "error", err)
+		return
+	}
+
+	// 淘汰已跌出榜单的图片，再按排名挑选能放进内存预算的图片，排名靠后的放不下时跳过，不读取文件
+	hot.Retain(ids)
+	budget := hot.Stats().MaxBytes
+	type candidate struct {
+		id  string
+		img *model.Image
+	}
+	var picked []candidate
+	for _, id := range ids {
+		img, err := redis.GetImage(ctx, id)
+		if err != nil || img == nil || img.Size > budget {
+			continue
+		}
+		budget -= img.Size
+		picked = append(picked, candidate{id, img})
+	}
+
+	// 从排名最低的开始放入，排名第一的最后放入队首，超出预算时最先淘汰排名靠后的图片
+	for i := len(picked) - 1; i >= 0; i-- {
+		id, img := picked[i].id, picked[i].img
+		if hot.Touch(id) {
+			continue
+		}
+		data, err := store.ReadFile(store.GetFilePath(img.Filename))
+		if err != nil {
+			slog.Error("Failed to load hot image", "image_id", id, "error", err)
+			continue
+		}
+		hot.Set(&CachedImage{ID: id, Filename: img.Filename, Data: data, ModTime: img.CreatedAt})
+	}
+
+	stats := hot.Stats()
+	slog.Info("Refreshed Top10 cache", "ids", ids, "entries", stats.Entries, "bytes", stats.Bytes,
+		"hits", stats.Hits, "misses", stats.Misses)
+}
@@ -0,0 +1,133 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize INSTREAM 每个数据块的大小
+const chunkSize = 64 << 10
+
+// Result 扫描结果，Signature 为命中的病毒名
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Client clamd 客户端，每条命令使用一个新连接
+type Client struct {
+	network string
+	addr    string
+}
+
+// NewClient 解析 clamd 地址：tcp://host:port、unix:///path，
+// 也可以直接写 host:port 或以 / 开头的套接字路径
+func NewClient(address string) (*Client, error) {
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		return &Client{network: "tcp", addr: strings.TrimPrefix(address, "tcp://")}, nil
+	case strings.HasPrefix(address, "unix://"):
+		return &Client{network: "unix", addr: strings.TrimPrefix(address, "unix://")}, nil
+	case strings.HasPrefix(address, "/"):
+		return &Client{network: "unix", addr: address}, nil
+	case strings.Contains(address, "://"):
+		return nil, fmt.Errorf("unsupported clamd address %q", address)
+	case address == "":
+		return nil, fmt.Errorf("clamd address is empty")
+	}
+	return &Client{network: "tcp", addr: address}, nil
+}
+
+// Ping 检查 clamd 是否可用
+func (c *Client) Ping(ctx context.Context) error {
+	reply, err := c.command(ctx, "zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// Scan 通过 INSTREAM 命令扫描数据流
+func (c *Client) Scan(ctx context.Context, r io.Reader) (*Result, error) {
+	reply, err := c.command(ctx, "zINSTREAM\x00", r)
+	if err != nil {
+		return nil, err
+	}
+
+	// 回复格式为 "stream: OK"、"stream: <病毒名> FOUND" 或 "<原因> ERROR"
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(reply, " ERROR"))
+	}
+	return nil, fmt.Errorf("unexpected clamd reply %q", reply)
+}
+
+// command 发送以 z 开头的命令，body 不为空时按 INSTREAM 格式分块发送，返回以 \0 结尾的回复
+func (c *Client) command(ctx context.Context, cmd string, body io.Reader) (string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", err
+	}
+	// clamd 超出 StreamMaxLength 时先回复错误再断开连接，写入失败后仍尝试读取回复
+	var writeErr error
+	if body != nil {
+		writeErr = writeChunks(conn, body)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		if writeErr != nil {
+			return "", writeErr
+		}
+		return "", err
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// writeChunks 每块前写入 4 字节大端长度，最后以长度 0 结束
+func writeChunks(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,145 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// fakeClamd 在本地端口模拟 clamd 的 INSTREAM 命令。maxStream 大于 0 时超出长度后回复大小超限错误；
+// reply 为空时不回复，用于模拟超时
+func fakeClamd(t *testing.T, reply string, maxStream int) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		ln.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, reply, maxStream, done)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn, reply string, maxStream int, done chan struct{}) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+		return
+	}
+	total := 0
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return
+		}
+		total += int(size)
+		if maxStream > 0 && total > maxStream {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			// 丢弃剩余数据直到客户端关闭，避免连接被重置导致回复丢失
+			io.Copy(io.Discard, r)
+			return
+		}
+	}
+	if reply == "" {
+		<-done
+		return
+	}
+	conn.Write([]byte(reply + "\x00"))
+}
+
+func TestScannerCheck(t *testing.T) {
+	tests := []struct {
+		name           string
+		reply          string
+		maxStream      int
+		size           int
+		failOpen       bool
+		want           model.ScanStatus
+		wantErr        error
+		wantInfected   string
+		wantQuarantine bool
+	}{
+		{name: "clean", reply: "stream: OK", size: 1024, want: model.ScanClean},
+		{name: "clean multi-chunk", reply: "stream: OK", size: 3*chunkSize + 1, want: model.ScanClean},
+		{name: "infected", reply: "stream: Eicar-Signature FOUND", size: 1024, wantInfected: "Eicar-Signature", wantQuarantine: true},
+		{name: "scanner error", reply: "Can't allocate memory ERROR", size: 1024, wantErr: ErrUnavailable},
+		{name: "oversize", reply: "stream: OK", maxStream: chunkSize, size: 4 * chunkSize, wantErr: ErrUnavailable},
+		{name: "oversize fail open", reply: "stream: OK", maxStream: chunkSize, size: 4 * chunkSize, failOpen: true, want: model.ScanUnscanned},
+		{name: "timeout", size: 1024, wantErr: ErrUnavailable},
+		{name: "timeout fail open", size: 1024, failOpen: true, want: model.ScanUnscanned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(fakeClamd(t, tt.reply, tt.maxStream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &Scanner{client: client, timeout: 200 * time.Millisecond, failOpen: tt.failOpen, quarantineDir: t.TempDir()}
+			path := filepath.Join(t.TempDir(), "upload")
+			if err := os.WriteFile(path, bytes.Repeat([]byte{'x'}, tt.size), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := s.Check(context.Background(), path, &model.Image{ID: "img1", UserID: "alice"})
+			var infected *InfectedError
+			switch {
+			case tt.wantInfected != "":
+				if !errors.As(err, &infected) || infected.Signature != tt.wantInfected {
+					t.Fatalf("error = %v, want infected by %s", err, tt.wantInfected)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			}
+			if status != tt.want {
+				t.Errorf("status %q, want %q", status, tt.want)
+			}
+			entries, _ := os.ReadDir(s.quarantineDir)
+			if quarantined := len(entries) > 0; quarantined != tt.wantQuarantine {
+				t.Errorf("quarantined %v, want %v", quarantined, tt.wantQuarantine)
+			}
+		})
+	}
+}
+
+func TestScanOversizeReturnsClamdError(t *testing.T) {
+	client, err := NewClient(fakeClamd(t, "stream: OK", chunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Scan(context.Background(), bytes.NewReader(make([]byte, 4*chunkSize)))
+	if err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("error = %v, want clamd size limit error", err)
+	}
+}
@@ -0,0 +1,153 @@
+package clamd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// ErrUnavailable clamd 不可用且配置为拒绝上传
+var ErrUnavailable = errors.New("virus scanner unavailable")
+
+// InfectedError 上传的文件中发现病毒
+type InfectedError struct {
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return "malware detected: " + e.Signature
+}
+
+// Scanner 扫描上传文件，按配置处理 clamd 不可用的情况并隔离感染文件
+type Scanner struct {
+	client        *Client
+	timeout       time.Duration
+	failOpen      bool
+	quarantineDir string
+}
+
+// New 根据配置创建扫描器，未配置地址时返回的扫描器不启用
+func New(cfg config.ClamAVConfig) (*Scanner, error) {
+	s := &Scanner{
+		timeout:       time.Duration(cfg.Timeout) * time.Second,
+		failOpen:      cfg.FailOpen,
+		quarantineDir: cfg.QuarantineDir,
+	}
+	if cfg.Address == "" {
+		return s, nil
+	}
+	client, err := NewClient(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.QuarantineDir, 0700); err != nil {
+		return nil, fmt.Errorf("create quarantine dir: %w", err)
+	}
+	s.client = client
+	return s, nil
+}
+
+// Enabled 是否配置了 clamd
+func (s *Scanner) Enabled() bool {
+	return s.client != nil
+}
+
+// Ping 检查 clamd 是否可用
+func (s *Scanner) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.client.Ping(ctx)
+}
+
+// Check 扫描上传的临时文件并返回扫描状态。发现病毒时隔离文件并返回 *InfectedError；
+// clamd 不可用时 fail_open 放行并返回 unscanned，否则返回 ErrUnavailable
+func (s *Scanner) Check(ctx context.Context, path string, img *model.Image) (model.ScanStatus, error) {
+	result, err := s.scan(ctx, path)
+	if err != nil {
+		slog.Error("Virus scan failed", "image_id", img.ID, "error", err)
+		if s.failOpen {
+			return model.ScanUnscanned, nil
+		}
+		return "", ErrUnavailable
+	}
+	if !result.Infected {
+		return model.ScanClean, nil
+	}
+
+	slog.Warn("Malware detected in upload", "image_id", img.ID, "user_id", img.UserID, "signature", result.Signature)
+	if err := s.quarantine(path, img, result.Signature); err != nil {
+		slog.Error("Failed to quarantine file", "image_id", img.ID, "error", err)
+	}
+	return "", &InfectedError{Signature: result.Signature}
+}
+
+func (s *Scanner) scan(ctx context.Context, path string) (*Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.client.Scan(ctx, file)
+}
+
+// quarantineRecord 隔离文件旁的 .json 记录
+type quarantineRecord struct {
+	ImageID    string    `json:"image_id"`
+	UserID     string    `json:"user_id"`
+	OrgID      string    `json:"org_id,omitempty"`
+	Filename   string    `json:"filename"`
+	MimeType   string    `json:"mime_type"`
+	Size       int64     `json:"size"`
+	Signature  string    `json:"signature"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// quarantine 将感染文件复制到隔离目录，文件名带检测时间，并写入同名 .json 记录
+func (s *Scanner) quarantine(path string, img *model.Image, signature string) error {
+	now := time.Now()
+	name := filepath.Join(s.quarantineDir, fmt.Sprintf("%s-%s", now.UTC().Format("20060102T150405Z"), img.ID))
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(quarantineRecord{
+		ImageID:    img.ID,
+		UserID:     img.UserID,
+		OrgID:      img.OrgID,
+		Filename:   img.Filename,
+		MimeType:   img.MimeType,
+		Size:       img.Size,
+		Signature:  signature,
+		DetectedAt: now,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name+".json", data, 0600)
+}
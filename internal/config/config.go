@@ -1,16 +1,173 @@
 package config
 
+import (
+	"path/filepath"
+	"strings"
+)
+
+// 注册模式
+const (
+	RegistrationOpen     = "open"     // 开放注册
+	RegistrationInvite   = "invite"   // 仅限邀请码注册
+	RegistrationClosed   = "closed"   // 关闭注册
+	RegistrationApproval = "approval" // 注册后需管理员审核，持邀请码注册免审核
+)
+
 type Config struct {
-	UploadDir          string      `json:"upload_dir"`
-	JWTSecret          string      `json:"jwt_secret"`
-	Redis              RedisConfig `json:"redis"`
-	Port               string      `json:"port"`
-	MaxUploadSize      int64       `json:"max_upload_size"`
-	TopRefreshInterval int         `json:"top_refresh_interval"`
-	RateLimit          struct {
-		Requests int `json:"requests"`
-		Duration int `json:"duration"`
-	} `json:"rate_limit"`
+	UploadDir           string                `json:"upload_dir"`
+	JWTSecret           string                `json:"jwt_secret"` // HS256 签名密钥
+	JWT                 JWTConfig             `json:"jwt"`
+	Redis               RedisConfig           `json:"redis"`
+	Port                string                `json:"port"`
+	MaxUploadSize       int64                 `json:"max_upload_size"`
+	TopRefreshInterval  int                   `json:"top_refresh_interval"`
+	HotCache            HotCacheConfig        `json:"hot_cache"`
+	Leaderboard         LeaderboardConfig     `json:"leaderboard"`
+	Analytics           AnalyticsConfig       `json:"analytics"`
+	Quota               QuotaConfig           `json:"quota"`
+	OrgQuota            QuotaConfig           `json:"org_quota"` // 组织的默认存储配额
+	RateLimit           RateLimitConfig       `json:"rate_limit"`
+	TrustProxy          bool                  `json:"trust_proxy"` // 是否信任 X-Forwarded-For / X-Real-IP
+	LoginProtection     LoginProtectionConfig `json:"login_protection"`
+	TwoFactor           TwoFactorConfig       `json:"two_factor"`
+	OIDC                OIDCConfig            `json:"oidc"`
+	DefaultRole         string                `json:"default_role"`         // 新用户默认角色
+	DisableRegistration bool                  `json:"disable_registration"` // 关闭注册，等同于 registration_mode=closed
+	RegistrationMode    string                `json:"registration_mode"`    // 注册模式：open、invite、closed、approval
+	PublicURL           string                `json:"public_url"`           // 对外访问地址，用于生成邮件中的链接
+	PasswordResetURL    string                `json:"password_reset_url"`   // 重置密码页面地址，令牌以 token 参数附加
+	SMTP                SMTPConfig            `json:"smtp"`
+	Export              ExportConfig          `json:"export"`
+	Moderation          ModerationConfig      `json:"moderation"`
+	ClamAV              ClamAVConfig          `json:"clamav"`
+	Audit               AuditConfig           `json:"audit"`
+}
+
+// SetDefaults 为未配置的可选项填充默认值
+func (c *Config) SetDefaults() {
+	if c.Leaderboard.RetentionDays <= 0 {
+		c.Leaderboard.RetentionDays = 30
+	}
+	if c.Leaderboard.HalfLifeHours <= 0 {
+		c.Leaderboard.HalfLifeHours = 24
+	}
+	if c.Leaderboard.RollupInterval <= 0 {
+		c.Leaderboard.RollupInterval = 300
+	}
+	if c.RateLimit.Classes == nil {
+		c.RateLimit.Classes = map[string]RateLimitRule{}
+	}
+	for class, rule := range map[string]RateLimitRule{
+		"login":  {Requests: 10, Duration: 60},
+		"upload": {Requests: 30, Duration: 60},
+		"image":  {Requests: 600, Duration: 60},
+		"report": {Requests: 20, Duration: 3600},
+	} {
+		if _, ok := c.RateLimit.Classes[class]; !ok {
+			c.RateLimit.Classes[class] = rule
+		}
+	}
+	lp := &c.LoginProtection
+	if lp.Window <= 0 {
+		lp.Window = 900
+	}
+	if lp.MaxUserFailures <= 0 {
+		lp.MaxUserFailures = 5
+	}
+	if lp.MaxIPFailures <= 0 {
+		lp.MaxIPFailures = 50
+	}
+	if lp.LockoutDuration <= 0 {
+		lp.LockoutDuration = 900
+	}
+	if lp.BackoffBase <= 0 {
+		lp.BackoffBase = 500
+	}
+	if lp.MaxBackoff <= 0 {
+		lp.MaxBackoff = 30000
+	}
+	if c.TwoFactor.Issuer == "" {
+		c.TwoFactor.Issuer = "ibed"
+	}
+	if len(c.OIDC.Scopes) == 0 {
+		c.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.OIDC.UsernameClaim == "" {
+		c.OIDC.UsernameClaim = "preferred_username"
+	}
+	if c.OIDC.GroupsClaim == "" {
+		c.OIDC.GroupsClaim = "groups"
+	}
+	if c.OIDC.TokenTTL <= 0 {
+		c.OIDC.TokenTTL = 86400
+	}
+	if c.PublicURL == "" {
+		c.PublicURL = "http://localhost:" + c.Port
+	}
+	c.PublicURL = strings.TrimSuffix(c.PublicURL, "/")
+	if c.PasswordResetURL == "" {
+		c.PasswordResetURL = c.PublicURL + "/password/reset"
+	}
+	if c.JWT.Algorithm == "" {
+		c.JWT.Algorithm = JWTAlgHS256
+	}
+	if c.JWT.Issuer == "" {
+		c.JWT.Issuer = c.PublicURL
+	}
+	if c.JWT.Audience == "" {
+		c.JWT.Audience = "ibed"
+	}
+	if c.JWT.RotationInterval <= 0 {
+		c.JWT.RotationInterval = 30 * 86400
+	}
+	if c.JWT.MaxTokenTTL <= 0 {
+		c.JWT.MaxTokenTTL = 30 * 86400
+	}
+	if c.JWT.KeyEncryptionKey == "" {
+		c.JWT.KeyEncryptionKey = c.JWTSecret
+	}
+	if c.SMTP.Port == 0 {
+		c.SMTP.Port = 587
+	}
+	if c.SMTP.TLS == "" {
+		c.SMTP.TLS = SMTPTLSStartTLS
+	}
+	if c.DisableRegistration {
+		c.RegistrationMode = RegistrationClosed
+	}
+	if c.RegistrationMode == "" {
+		c.RegistrationMode = RegistrationOpen
+	}
+	if c.DefaultRole == "" {
+		c.DefaultRole = "uploader"
+	}
+	// 导出文件默认放在上传目录下，多实例部署时与图片一样对所有实例可见
+	if c.Export.Dir == "" {
+		c.Export.Dir = filepath.Join(c.UploadDir, "exports")
+	}
+	if c.Export.TTL <= 0 {
+		c.Export.TTL = 86400
+	}
+	if c.Moderation.AutoHideReports == 0 {
+		c.Moderation.AutoHideReports = 5
+	}
+	if c.Moderation.OnError == "" {
+		c.Moderation.OnError = "pending"
+	}
+	for i := range c.Moderation.Classifiers {
+		if c.Moderation.Classifiers[i].Timeout <= 0 {
+			c.Moderation.Classifiers[i].Timeout = 10
+		}
+	}
+	if c.ClamAV.Timeout <= 0 {
+		c.ClamAV.Timeout = 30
+	}
+	if c.ClamAV.QuarantineDir == "" {
+		c.ClamAV.QuarantineDir = "./quarantine"
+	}
+	if c.Analytics.RetentionDays <= 0 {
+		c.Analytics.RetentionDays = 90
+	}
 }
 
 type RedisConfig struct {
@@ -19,3 +176,152 @@ type RedisConfig struct {
 	DB       int    `json:"db"`
 	PoolSize int    `json:"pool_size"`
 }
+
+type HotCacheConfig struct {
+	TopN     int   `json:"top_n"`     // 预热的热门图片数量
+	MaxBytes int64 `json:"max_bytes"` // 内存预算（字节）
+}
+
+type LeaderboardConfig struct {
+	RetentionDays  int `json:"retention_days"`  // 访问天桶保留天数
+	HalfLifeHours  int `json:"half_life_hours"` // 热度衰减半衰期（小时）
+	RollupInterval int `json:"rollup_interval"` // 汇总间隔（秒）
+}
+
+type AnalyticsConfig struct {
+	RetentionDays int `json:"retention_days"` // 单图访问统计保留天数
+}
+
+// 发布前审核分类器类型
+const (
+	ClassifierWebhook = "webhook" // 将图片 POST 到 HTTP 接口
+	ClassifierCommand = "command" // 执行本地命令，图片路径作为最后一个参数
+)
+
+// ModerationConfig 举报与审核配置
+type ModerationConfig struct {
+	AutoHideReports int                `json:"auto_hide_reports"` // 待处理举报达到该数量时自动隐藏图片，负数表示不自动隐藏
+	Classifiers     []ClassifierConfig `json:"classifiers"`       // 发布前审核的分类器，为空时上传直接发布
+	OnError         string             `json:"on_error"`          // 分类器出错或超时时的处理：pending、rejected、approved
+}
+
+// ClamAVConfig 上传病毒扫描配置
+type ClamAVConfig struct {
+	Address       string `json:"address"`        // clamd 地址，如 tcp://127.0.0.1:3310 或 unix:///run/clamav/clamd.ctl，为空时不扫描
+	Timeout       int    `json:"timeout"`        // 单次扫描超时（秒）
+	FailOpen      bool   `json:"fail_open"`      // clamd 不可用时是否放行上传，默认拒绝
+	QuarantineDir string `json:"quarantine_dir"` // 感染文件的隔离目录
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	RetentionDays int `json:"retention_days"` // 审计记录保留天数，0 表示永久保留
+}
+
+// ClassifierConfig 发布前审核分类器
+type ClassifierConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`    // webhook 或 command
+	URL     string            `json:"url"`     // webhook 地址
+	Headers map[string]string `json:"headers"` // webhook 额外请求头，如鉴权令牌
+	Command []string          `json:"command"` // 命令及参数
+	Timeout int               `json:"timeout"` // 超时时间（秒）
+}
+
+// ExportConfig 用户数据导出配置
+type ExportConfig struct {
+	Dir string `json:"dir"` // 导出压缩包存放目录，多实例部署时必须是所有实例共享的目录，默认为 upload_dir/exports
+	TTL int    `json:"ttl"` // 下载链接和压缩包的有效期（秒）
+}
+
+// QuotaConfig 默认存储配额，0 表示不限制
+type QuotaConfig struct {
+	MaxBytes  int64 `json:"max_bytes"`  // 每个用户的总字节数上限
+	MaxImages int64 `json:"max_images"` // 每个用户的图片数量上限
+}
+
+// RateLimitConfig 限流配置，Requests/Duration 为默认规则，Classes 按路由类别单独设置
+type RateLimitConfig struct {
+	Requests int                      `json:"requests"`
+	Duration int                      `json:"duration"`
+	Classes  map[string]RateLimitRule `json:"classes"`
+}
+
+type RateLimitRule struct {
+	Requests int `json:"requests"` // 时间窗口内允许的请求数
+	Duration int `json:"duration"` // 时间窗口（秒）
+}
+
+// Rule 返回路由类别对应的限流规则，未配置时使用默认规则
+func (c RateLimitConfig) Rule(class string) RateLimitRule {
+	if rule, ok := c.Classes[class]; ok {
+		return rule
+	}
+	return RateLimitRule{Requests: c.Requests, Duration: c.Duration}
+}
+
+// LoginProtectionConfig 登录防暴力破解配置
+type LoginProtectionConfig struct {
+	Window          int `json:"window"`            // 失败次数统计窗口（秒）
+	MaxUserFailures int `json:"max_user_failures"` // 单个用户名锁定阈值
+	MaxIPFailures   int `json:"max_ip_failures"`   // 单个 IP 锁定阈值
+	LockoutDuration int `json:"lockout_duration"`  // 锁定时长（秒）
+	BackoffBase     int `json:"backoff_base"`      // 退避基数（毫秒），每次失败翻倍
+	MaxBackoff      int `json:"max_backoff"`       // 退避上限（毫秒）
+}
+
+// TwoFactorConfig 两步验证配置
+type TwoFactorConfig struct {
+	Issuer       string `json:"issuer"`        // 验证器 App 中显示的发行方
+	RequireAdmin bool   `json:"require_admin"` // 管理员访问管理接口前必须通过两步验证
+}
+
+// OIDCConfig OpenID Connect 单点登录配置
+type OIDCConfig struct {
+	Enabled           bool     `json:"enabled"`
+	Issuer            string   `json:"issuer"` // 身份提供方地址，用于自动发现
+	ClientID          string   `json:"client_id"`
+	ClientSecret      string   `json:"client_secret"` // 公共客户端可留空，仅使用 PKCE
+	RedirectURL       string   `json:"redirect_url"`  // 回调地址，指向 /oidc/callback
+	Scopes            []string `json:"scopes"`
+	UsernameClaim     string   `json:"username_claim"`      // 用作用户名的声明
+	GroupsClaim       string   `json:"groups_claim"`        // 用户组声明
+	AdminGroups       []string `json:"admin_groups"`        // 属于这些组的用户为管理员，为空时不同步管理员身份
+	LinkExisting      bool     `json:"link_existing"`       // 首次登录时关联同名且邮箱相同的本地账户，双方的邮箱都必须已验证
+	TokenTTL          int      `json:"token_ttl"`           // 签发令牌的有效期（秒）
+	PostLoginRedirect string   `json:"post_login_redirect"` // 登录成功后跳转的前端地址，令牌放在 URL 片段中
+}
+
+// JWT 签名算法
+const (
+	JWTAlgHS256 = "HS256" // 对称签名，使用 jwt_secret
+	JWTAlgRS256 = "RS256" // RSA 2048 签名，密钥自动生成和轮换
+	JWTAlgEdDSA = "EdDSA" // Ed25519 签名，密钥自动生成和轮换
+)
+
+// JWTConfig 令牌签发与校验配置
+type JWTConfig struct {
+	Algorithm        string `json:"algorithm"`          // HS256、RS256、EdDSA
+	Issuer           string `json:"issuer"`             // iss 声明，默认为 public_url
+	Audience         string `json:"audience"`           // aud 声明
+	RotationInterval int    `json:"rotation_interval"`  // 非对称密钥轮换间隔（秒）
+	MaxTokenTTL      int    `json:"max_token_ttl"`      // 令牌最长有效期（秒），旧公钥在轮换后保留这么久
+	KeyEncryptionKey string `json:"key_encryption_key"` // 加密 Redis 中非对称私钥的口令，默认使用 jwt_secret
+}
+
+// SMTP 连接的 TLS 模式
+const (
+	SMTPTLSStartTLS = "starttls" // 明文连接后升级为 TLS（默认）
+	SMTPTLSImplicit = "implicit" // 直接使用 TLS 连接，一般为 465 端口
+	SMTPTLSNone     = "none"     // 不加密，仅用于本地测试服务器
+)
+
+// SMTPConfig 邮件发送配置，Host 为空时只记录日志不发送
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+	TLS      string `json:"tls"` // starttls、implicit、none
+}
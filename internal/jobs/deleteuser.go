@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// deleteUser 删除或转移用户的全部图片，然后清除用户数据。
+// 每张图片处理完才从用户图片索引中移除，中断后重新执行只处理剩余图片。lockToken 为任务锁令牌，用于续期
+func (r *Runner) deleteUser(ctx context.Context, job *model.Job, lockToken string) error {
+	ids, err := r.redis.UserImageIDs(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	if job.Total == 0 {
+		job.Total = int64(len(ids))
+	}
+	job.Processed = job.Total - int64(len(ids))
+
+	if job.Images == model.ImagesTransfer {
+		target, err := r.redis.GetUser(ctx, job.TransferTo)
+		if err != nil {
+			return err
+		}
+		if target == nil {
+			return fmt.Errorf("transfer target %s not found", job.TransferTo)
+		}
+	}
+
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := r.processImage(ctx, job, id); err != nil {
+			return fmt.Errorf("image %s: %w", id, err)
+		}
+		job.Processed++
+		if (i+1)%progressEvery == 0 {
+			if err := r.redis.SaveJob(ctx, job); err != nil {
+				return err
+			}
+			if err := r.redis.ExtendJobLock(ctx, job.ID, lockToken, lockTTL); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := r.releaseOrgs(ctx, job); err != nil {
+		return err
+	}
+	return r.redis.PurgeUser(ctx, job.UserID)
+}
+
+// releaseOrgs 处理用户是唯一成员的组织：转移模式下由接收用户成为所有者，
+// 删除模式下删除组织图片，空组织随后由 PurgeUser 删除
+func (r *Runner) releaseOrgs(ctx context.Context, job *model.Job) error {
+	orgs, err := r.redis.UserOrgs(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	for orgID := range orgs {
+		members, err := r.redis.OrgMembers(ctx, orgID)
+		if err != nil {
+			return err
+		}
+		if len(members) > 1 {
+			continue
+		}
+		if job.Images == model.ImagesTransfer {
+			if err := r.redis.SetOrgMember(ctx, orgID, job.TransferTo, model.OrgOwner); err != nil {
+				return err
+			}
+			continue
+		}
+		ids, err := r.redis.OrgImageIDs(ctx, orgID)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			img, err := r.redis.GetImage(ctx, id)
+			if err != nil {
+				return err
+			}
+			if img == nil {
+				continue
+			}
+			if err := r.deleteImage(ctx, img); err != nil {
+				return fmt.Errorf("org %s image %s: %w", orgID, id, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Runner) processImage(ctx context.Context, job *model.Job, id string) error {
+	img, err := r.redis.GetImage(ctx, id)
+	if err != nil {
+		return err
+	}
+	if img == nil || img.UserID != job.UserID {
+		// 元数据已过期或图片已转移，只清理索引
+		return r.redis.RemoveUserImage(ctx, job.UserID, id)
+	}
+
+	if job.Images == model.ImagesTransfer {
+		err := r.redis.TransferImage(ctx, img, job.TransferTo)
+		if err == goredis.Nil {
+			// 元数据刚好过期，已从用户图片索引中移除
+			return nil
+		}
+		// 用量随图片一起计入接收方，不受接收方配额限制
+		return err
+	}
+
+	return r.deleteImage(ctx, img)
+}
+
+// deleteImage 删除图片文件、缓存和元数据
+func (r *Runner) deleteImage(ctx context.Context, img *model.Image) error {
+	r.hot.Delete(img.ID)
+	path := r.storage.GetFilePath(img.Filename)
+	if err := r.storage.DeleteFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return r.redis.DeleteImage(ctx, img)
+}
@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestDeleteUserReleasesSoleOrgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		images    string
+		wantOrg   bool
+		wantImage bool
+	}{
+		{"delete", model.ImagesDelete, false, false},
+		{"transfer", model.ImagesTransfer, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := newTestRunner(t)
+			for _, u := range []*model.User{{ID: "u1", Username: "alice"}, {ID: "u2", Username: "bob"}} {
+				u.CreatedAt = time.Now()
+				if err := r.redis.CreateUser(ctx, u); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.redis.CreateOrg(ctx, &model.Org{ID: "org1", Name: "team", CreatedBy: "u1", CreatedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			img := &model.Image{ID: "img1", Filename: "img1.png", UserID: "u1", OrgID: "org1", Size: 10, CreatedAt: time.Now()}
+			if err := r.redis.SaveImage(ctx, img); err != nil {
+				t.Fatal(err)
+			}
+
+			job := &model.Job{ID: "job1", Type: model.JobDeleteUser, UserID: "u1", Images: tt.images, TransferTo: "u2"}
+			if err := r.deleteUser(ctx, job, "token"); err != nil {
+				t.Fatal(err)
+			}
+			org, err := r.redis.GetOrg(ctx, "org1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists := org != nil; exists != tt.wantOrg {
+				t.Errorf("org exists %v, want %v", exists, tt.wantOrg)
+			}
+			if got, _ := r.redis.GetImage(ctx, "img1"); (got != nil) != tt.wantImage {
+				t.Errorf("org image exists %v, want %v", got != nil, tt.wantImage)
+			}
+			if tt.wantOrg {
+				if role, _ := r.redis.OrgRole(ctx, "org1", "u2"); role != model.OrgOwner {
+					t.Errorf("transfer target role %q, want owner", role)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// exportImage 导出清单中的一张图片
+type exportImage struct {
+	*model.Image
+	File  string            `json:"file"` // 压缩包内的路径，原文件缺失时为空
+	Stats *model.ImageStats `json:"stats,omitempty"`
+}
+
+// exportAlbum 导出清单中的一个个人相册，图片按加入顺序排列
+type exportAlbum struct {
+	*model.Album
+	ImageIDs []string `json:"image_ids"`
+}
+
+type exportManifest struct {
+	ExportedAt time.Time     `json:"exported_at"`
+	User       model.User    `json:"user"`
+	Images     []exportImage `json:"images"`
+	Albums     []exportAlbum `json:"albums"`
+}
+
+// ExportPath 返回导出任务的压缩包路径
+func ExportPath(dir, jobID string) string {
+	return filepath.Join(dir, jobID+".zip")
+}
+
+// export 将用户的原图和元数据清单写入 zip。图片逐个从磁盘流式写入，不整体读入内存；
+// 先写临时文件，完成后再改名，中断后重新执行会从头生成。lockToken 为任务锁令牌，用于续期
+func (r *Runner) export(ctx context.Context, job *model.Job, lockToken string) (err error) {
+	defer r.redis.FinishExport(ctx, job.UserID, job.ID)
+
+	user, err := r.redis.GetUser(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", job.UserID)
+	}
+	ids, err := r.redis.UserImageIDs(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	job.Total, job.Processed = int64(len(ids)), 0
+
+	dir := r.config.Export.Dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	final := ExportPath(dir, job.ID)
+	tmp := final + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+	zw := zip.NewWriter(f)
+
+	manifest := exportManifest{ExportedAt: time.Now(), User: user.Sanitized(), Images: []exportImage{}}
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, 1-r.config.Analytics.RetentionDays)
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		img, err := r.redis.GetImage(ctx, id)
+		if err != nil {
+			return err
+		}
+		if img != nil && img.UserID == job.UserID {
+			entry := exportImage{Image: img}
+			if entry.Stats, err = r.redis.GetImageStats(ctx, id, from, to); err != nil {
+				return err
+			}
+			if entry.File, err = r.addImageFile(zw, img); err != nil {
+				return fmt.Errorf("image %s: %w", id, err)
+			}
+			manifest.Images = append(manifest.Images, entry)
+		}
+		job.Processed++
+		if (i+1)%progressEvery == 0 {
+			if err := r.redis.SaveJob(ctx, job); err != nil {
+				return err
+			}
+			if err := r.redis.ExtendJobLock(ctx, job.ID, lockToken, lockTTL); err != nil {
+				return err
+			}
+		}
+	}
+
+	if manifest.Albums, err = r.exportAlbums(ctx, job.UserID); err != nil {
+		return err
+	}
+	if err := writeJSONManifest(zw, &manifest); err != nil {
+		return err
+	}
+	if err := writeCSVManifest(zw, manifest.Images); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	ttl := time.Duration(r.config.Export.TTL) * time.Second
+	token := hex.EncodeToString(buf)
+	if err := r.redis.SaveExportToken(ctx, token, job.ID, ttl); err != nil {
+		return err
+	}
+	job.Result = token
+	job.ExpiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+// exportAlbums 返回用户的个人相册及其图片 ID
+func (r *Runner) exportAlbums(ctx context.Context, userID string) ([]exportAlbum, error) {
+	albums, err := r.redis.UserAlbums(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(albums, func(i, j int) bool { return albums[i].CreatedAt.Before(albums[j].CreatedAt) })
+	result := make([]exportAlbum, 0, len(albums))
+	for _, album := range albums {
+		ids, err := r.redis.AlbumImageIDs(ctx, album.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, exportAlbum{Album: album, ImageIDs: ids})
+	}
+	return result, nil
+}
+
+// addImageFile 以不压缩的方式写入原图（图片本身已压缩），原文件缺失时跳过
+func (r *Runner) addImageFile(zw *zip.Writer, img *model.Image) (string, error) {
+	src, err := os.Open(r.storage.GetFilePath(img.Filename))
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Image file missing during export", "image_id", img.ID)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	name := "images/" + img.Filename
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: img.CreatedAt})
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func writeJSONManifest(zw *zip.Writer, manifest *exportManifest) error {
+	w, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
+
+func writeCSVManifest(zw *zip.Writer, images []exportImage) error {
+	w, err := zw.Create("manifest.csv")
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "file", "filename", "description", "tags", "is_private", "size", "mime_type", "views", "created_at"})
+	for _, img := range images {
+		cw.Write([]string{
+			img.ID,
+			img.File,
+			img.Filename,
+			img.Description,
+			strings.Join(img.Tags, ";"),
+			strconv.FormatBool(img.IsPrivate),
+			strconv.FormatInt(img.Size, 10),
+			img.MimeType,
+			strconv.FormatInt(img.Views, 10),
+			img.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// cleanupExports 删除过期的导出压缩包和中断留下的临时文件
+func (r *Runner) cleanupExports() {
+	entries, err := os.ReadDir(r.config.Export.Dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("Failed to read export dir", "error", err)
+		}
+		return
+	}
+	cutoff := time.Now().Add(-time.Duration(r.config.Export.TTL) * time.Second)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.config.Export.Dir, entry.Name())); err != nil {
+			slog.Error("Failed to remove expired export", "file", entry.Name(), "error", err)
+		}
+	}
+}
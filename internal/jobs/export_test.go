@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/cache"
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+	"github.com/notes-bin/ibed/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRunner 使用 miniredis 和临时目录创建任务执行器
+func newTestRunner(t *testing.T) *Runner {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc, err := redis.NewClient(mr.Addr(), "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	st, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Export: config.ExportConfig{Dir: t.TempDir()}}
+	cfg.SetDefaults()
+	return NewRunner(cfg, rc, st, cache.NewImageCache(1, 1<<20))
+}
+
+func TestExportManifestAlbums(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRunner(t)
+	user := &model.User{ID: "u1", Username: "alice", CreatedAt: time.Now()}
+	if err := r.redis.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	albums := []struct {
+		album *model.Album
+		ids   []string
+	}{
+		{&model.Album{ID: "a1", Name: "trip", UserID: "u1", CreatedAt: now}, []string{"img2", "img1"}},
+		{&model.Album{ID: "a2", Name: "empty", UserID: "u1", CreatedAt: now.Add(time.Second)}, nil},
+	}
+	for _, a := range albums {
+		if err := r.redis.SaveAlbum(ctx, a.album); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range a.ids {
+			if err := r.redis.AddAlbumImages(ctx, a.album.ID, []string{id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	job := &model.Job{ID: "job1", Type: model.JobExport, UserID: "u1"}
+	if err := r.export(ctx, job, "token"); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(ExportPath(r.config.Export.Dir, job.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	f, err := zr.Open("manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var manifest struct {
+		Albums []struct {
+			ID       string   `json:"id"`
+			Name     string   `json:"name"`
+			ImageIDs []string `json:"image_ids"`
+		} `json:"albums"`
+	}
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifest.Albums) != len(albums) {
+		t.Fatalf("manifest has %d albums, want %d", len(manifest.Albums), len(albums))
+	}
+	for i, want := range albums {
+		got := manifest.Albums[i]
+		if got.ID != want.album.ID || got.Name != want.album.Name {
+			t.Errorf("album %d = %s %q, want %s %q", i, got.ID, got.Name, want.album.ID, want.album.Name)
+		}
+		if len(got.ImageIDs) != len(want.ids) {
+			t.Errorf("album %s image_ids = %v, want %v", got.ID, got.ImageIDs, want.ids)
+			continue
+		}
+		for j := range want.ids {
+			if got.ImageIDs[j] != want.ids[j] {
+				t.Errorf("album %s image_ids = %v, want %v", got.ID, got.ImageIDs, want.ids)
+				break
+			}
+		}
+	}
+}
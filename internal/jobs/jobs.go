@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/cache"
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/redis"
+	"github.com/notes-bin/ibed/internal/storage"
+)
+
+const (
+	claimTimeout    = 5 * time.Second
+	lockTTL         = time.Minute
+	requeueInterval = time.Minute
+	progressEvery   = 20 // 每处理多少张图片保存一次进度
+)
+
+// Runner 执行 Redis 队列中的后台任务，多个实例可以同时运行
+type Runner struct {
+	config  *config.Config
+	redis   *redis.Client
+	storage *storage.Storage
+	hot     *cache.ImageCache
+}
+
+func NewRunner(config *config.Config, redis *redis.Client, storage *storage.Storage, hot *cache.ImageCache) *Runner {
+	return &Runner{config: config, redis: redis, storage: storage, hot: hot}
+}
+
+// jobTypes 每类任务使用独立的队列和执行协程，耗时的导出不会阻塞删除用户
+var jobTypes = []string{model.JobDeleteUser, model.JobExport}
+
+// Start 为每类任务持续领取并执行任务，同时定期把中断的任务放回队列并清理过期的导出文件
+func (r *Runner) Start(ctx context.Context) {
+	for _, jobType := range jobTypes {
+		go r.work(ctx, jobType)
+	}
+	ticker := time.NewTicker(requeueInterval)
+	defer ticker.Stop()
+	for {
+		r.maintain(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work 依次领取并执行 jobType 类任务
+func (r *Runner) work(ctx context.Context, jobType string) {
+	for ctx.Err() == nil {
+		id, err := r.redis.ClaimJob(ctx, jobType, claimTimeout)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to claim job", "type", jobType, "error", err)
+				time.Sleep(claimTimeout)
+			}
+			continue
+		}
+		if id != "" {
+			r.run(ctx, jobType, id)
+		}
+	}
+}
+
+// maintain 迁移旧版本队列中的任务，把中断的任务放回队列并清理过期的导出文件
+func (r *Runner) maintain(ctx context.Context) {
+	if n, err := r.redis.MigrateJobQueues(ctx); err != nil {
+		slog.Error("Failed to migrate job queue", "error", err)
+	} else if n > 0 {
+		slog.Info("Moved jobs to per-type queues", "count", n)
+	}
+	for _, jobType := range jobTypes {
+		if n, err := r.redis.RequeueStaleJobs(ctx, jobType); err != nil {
+			slog.Error("Failed to requeue stale jobs", "type", jobType, "error", err)
+		} else if n > 0 {
+			slog.Info("Requeued interrupted jobs", "type", jobType, "count", n)
+		}
+	}
+	r.cleanupExports()
+}
+
+func (r *Runner) run(ctx context.Context, jobType, id string) {
+	token, err := r.redis.LockJob(ctx, id, lockTTL)
+	if err != nil {
+		slog.Error("Failed to lock job", "job_id", id, "error", err)
+		return
+	}
+	if token == "" {
+		// 其他实例正在执行
+		r.redis.DiscardClaim(ctx, jobType, id)
+		return
+	}
+	defer func() {
+		if err := r.redis.ReleaseJob(ctx, jobType, id, token); err != nil {
+			slog.Warn("Failed to release job lock", "job_id", id, "error", err)
+		}
+	}()
+
+	job, err := r.redis.GetJob(ctx, id)
+	if err != nil {
+		slog.Error("Failed to load job", "job_id", id, "error", err)
+		return
+	}
+	if job == nil || job.Status == model.JobDone {
+		return
+	}
+
+	job.Status = model.JobRunning
+	job.Error = ""
+	if err := r.redis.SaveJob(ctx, job); err != nil {
+		slog.Error("Failed to save job", "job_id", id, "error", err)
+		return
+	}
+
+	switch job.Type {
+	case model.JobDeleteUser:
+		err = r.deleteUser(ctx, job, token)
+	case model.JobExport:
+		err = r.export(ctx, job, token)
+	default:
+		err = fmt.Errorf("unknown job type %q", job.Type)
+	}
+	if err != nil {
+		job.Status = model.JobFailed
+		job.Error = err.Error()
+		slog.Error("Job failed", "job_id", id, "type", job.Type, "error", err)
+	} else {
+		job.Status = model.JobDone
+		slog.Info("Job finished", "job_id", id, "type", job.Type, "processed", job.Processed)
+	}
+	if err := r.redis.SaveJob(ctx, job); err != nil {
+		slog.Error("Failed to save job", "job_id", id, "error", err)
+	}
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestRunnerProcessesEachJobType(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := newTestRunner(t)
+	for _, u := range []*model.User{{ID: "u1", Username: "alice"}, {ID: "u2", Username: "bob"}} {
+		u.CreatedAt = time.Now()
+		if err := r.redis.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jobs := []*model.Job{
+		{ID: "export1", Type: model.JobExport, UserID: "u1", Status: model.JobPending},
+		{ID: "delete1", Type: model.JobDeleteUser, UserID: "u2", Images: model.ImagesDelete, Status: model.JobPending},
+	}
+	for _, job := range jobs {
+		if err := r.redis.EnqueueJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	go r.Start(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for _, want := range jobs {
+		for {
+			job, err := r.redis.GetJob(ctx, want.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status == model.JobDone {
+				break
+			}
+			if job.Status == model.JobFailed || time.Now().After(deadline) {
+				t.Fatalf("job %s status %s: %s", want.ID, job.Status, job.Error)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/config"
+)
+
+// fakeSMTP 最小的 SMTP 服务器，不支持 STARTTLS；rcptReply 为 RCPT 命令的响应，收到的邮件内容（换行为 \n）写入 data
+type fakeSMTP struct {
+	ln        net.Listener
+	rcptReply string
+	data      chan string
+}
+
+func newFakeSMTP(t *testing.T, rcptReply string) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, rcptReply: rcptReply, data: make(chan string, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTP) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 fake")
+		case "MAIL":
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			tp.PrintfLine(s.rcptReply)
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			body, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data <- string(body)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	tests := []struct {
+		name      string
+		tls       string
+		rcptReply string
+		wantErr   bool
+	}{
+		{"delivered", config.SMTPTLSNone, "250 OK", false},
+		{"recipient rejected", config.SMTPTLSNone, "550 no such user", true},
+		{"starttls not offered", config.SMTPTLSStartTLS, "250 OK", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeSMTP(t, tt.rcptReply)
+			addr := srv.ln.Addr().(*net.TCPAddr)
+			m := New(config.SMTPConfig{Host: addr.IP.String(), Port: addr.Port, From: "ibed <noreply@example.com>", TLS: tt.tls})
+			err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "验证邮箱", Body: "line 1\nline 2"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			data := <-srv.data
+			for _, want := range []string{"To: alice@example.com\n", "Subject: =?utf-8?q?", "\n\nline 1\nline 2"} {
+				if !strings.Contains(data, want) {
+					t.Errorf("message missing %q:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestLogMailerOmitsBody(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(prev)
+
+	LogMailer{}.Send(context.Background(), Message{To: "alice@example.com", Subject: "Reset", Body: "token=secret-token"})
+	out := buf.String()
+	if strings.Contains(out, "secret-token") {
+		t.Errorf("log contains mail body: %s", out)
+	}
+	if !strings.Contains(out, "alice@example.com") || !strings.Contains(out, "Reset") {
+		t.Errorf("log missing recipient or subject: %s", out)
+	}
+}
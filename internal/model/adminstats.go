@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// AdminStats 管理后台的全站统计，由计数器增量维护
+type AdminStats struct {
+	Users         int64          `json:"users"`
+	Images        int64          `json:"images"`
+	Bytes         int64          `json:"bytes"`
+	UploadsPerDay []DailyCount   `json:"uploads_per_day"`
+	ViewsPerDay   []DailyCount   `json:"views_per_day"`
+	TopUploaders  []UploaderStat `json:"top_uploaders"`
+	StorageByMime []MimeStat     `json:"storage_by_mime"`
+	RebuiltAt     *time.Time     `json:"rebuilt_at,omitempty"` // 最近一次按实际数据重建计数器的时间
+}
+
+// DailyCount 按天（UTC）统计的数量
+type DailyCount struct {
+	Date  string `json:"date"` // 2006-01-02
+	Count int64  `json:"count"`
+}
+
+// UploaderStat 上传者的图片数量和占用空间，包括上传到组织的图片
+type UploaderStat struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	Images   int64  `json:"images"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// MimeStat 按 MIME 类型统计的图片数量和占用空间
+type MimeStat struct {
+	MimeType string `json:"mime_type"`
+	Images   int64  `json:"images"`
+	Bytes    int64  `json:"bytes"`
+}
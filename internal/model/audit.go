@@ -0,0 +1,86 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// 审计事件的动作
+const (
+	AuditLogin          = "login"           // 登录，details.method 为 password、2fa 或 oidc
+	AuditLoginLockout   = "login.lockout"   // 失败次数过多被锁定
+	AuditLoginUnlock    = "login.unlock"    // 管理员解除锁定
+	AuditRegister       = "user.register"   // 注册
+	AuditAdminBootstrap = "admin.bootstrap" // 初始化管理员
+	AuditPasswordChange = "password.change" // 修改自己的密码
+	AuditPasswordReset  = "password.reset"  // 管理员重置密码，或通过邮件链接重置（details.via=email）
+	AuditUsernameChange = "user.rename"     // 修改用户名
+	AuditUserDelete     = "user.delete"     // 删除账户
+	AuditUserApprove    = "user.approve"    // 通过注册审核
+	AuditUserReject     = "user.reject"     // 拒绝注册申请
+	AuditRoleChange     = "user.role"       // 修改角色
+	AuditStatusChange   = "user.status"     // 修改账户状态
+	AuditTwoFactorOff   = "2fa.disable"     // 关闭两步验证
+	AuditImageDelete    = "image.delete"    // 删除图片
+	AuditImageUpdate    = "image.update"    // 管理员修改图片的私有状态或标签
+	AuditImageTransfer  = "image.transfer"  // 管理员将图片转给其他用户
+	AuditImageAutoHide  = "image.auto_hide" // 举报达到阈值自动隐藏
+	AuditImageModerate  = "image.moderate"  // 审核人员处理图片
+	AuditOrgDelete      = "org.delete"      // 删除组织
+	AuditOrgMember      = "org.member"      // 添加、移除组织成员或修改成员角色
+	AuditAccessDenied   = "access.denied"   // 访问需要权限的接口被拒绝
+)
+
+// 审计事件的结果
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied"
+)
+
+// AuditEvent 一条审计记录，写入后不可修改或删除
+type AuditEvent struct {
+	ID        string            `json:"id"` // Redis stream 条目 ID，按时间递增
+	Time      time.Time         `json:"time"`
+	ActorID   string            `json:"actor_id,omitempty"` // 操作者用户 ID，未登录时为空
+	Actor     string            `json:"actor,omitempty"`    // 操作者用户名，登录失败时为请求中的用户名
+	Action    string            `json:"action"`
+	Target    string            `json:"target,omitempty"` // 操作对象的 ID，如用户 ID、图片 ID
+	IP        string            `json:"ip,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Outcome   string            `json:"outcome"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// AuditFilter 审计记录的查询条件，空字段不过滤
+type AuditFilter struct {
+	ActorID   string
+	Actor     string
+	Action    string // 精确匹配，或按前缀匹配同一类动作，如 user 匹配 user.role
+	Target    string
+	Outcome   string
+	IP        string
+	RequestID string
+	Since     time.Time
+	Until     time.Time
+}
+
+// Match 判断记录是否满足查询条件（时间范围由调用方按 stream ID 过滤）
+func (f *AuditFilter) Match(e *AuditEvent) bool {
+	if f.Action != "" && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+".") {
+		return false
+	}
+	for _, c := range [][2]string{
+		{f.ActorID, e.ActorID},
+		{f.Actor, e.Actor},
+		{f.Target, e.Target},
+		{f.Outcome, e.Outcome},
+		{f.IP, e.IP},
+		{f.RequestID, e.RequestID},
+	} {
+		if c[0] != "" && c[0] != c[1] {
+			return false
+		}
+	}
+	return true
+}
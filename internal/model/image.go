@@ -2,13 +2,81 @@ package model
 
 import "time"
 
+// ReviewStatus 发布前审核状态
+type ReviewStatus string
+
+const (
+	ReviewPending  ReviewStatus = "pending"  // 等待人工审核，只有上传者和审核人员可见
+	ReviewApproved ReviewStatus = "approved" // 审核通过
+	ReviewRejected ReviewStatus = "rejected" // 审核未通过，只有上传者和审核人员可见
+)
+
+// ScanStatus 病毒扫描状态
+type ScanStatus string
+
+const (
+	ScanClean     ScanStatus = "clean"     // 扫描未发现病毒
+	ScanUnscanned ScanStatus = "unscanned" // clamd 不可用，按 fail_open 放行，未经扫描
+)
+
 type Image struct {
-	ID          string    `json:"id"`          // MD5 值
-	UserID      string    `json:"user_id"`     // 上传用户 ID
-	Filename    string    `json:"filename"`    // 文件名
-	Description string    `json:"description"` // 描述
-	Tags        []string  `json:"tags"`        // 标签
-	IsPrivate   bool      `json:"is_private"`  // 是否私有
-	Views       int64     `json:"views"`       // 访问次数
-	CreatedAt   time.Time `json:"created_at"`  // 上传时间
+	ID           string       `json:"id"`                      // MD5 值
+	UserID       string       `json:"user_id"`                 // 上传用户 ID
+	OrgID        string       `json:"org_id,omitempty"`        // 所属组织，为空时属于上传用户个人
+	Filename     string       `json:"filename"`                // 文件名
+	Description  string       `json:"description"`             // 描述
+	Tags         []string     `json:"tags"`                    // 标签
+	IsPrivate    bool         `json:"is_private"`              // 是否私有
+	Hidden       bool         `json:"hidden,omitempty"`        // 被举报或审核隐藏，只有上传者和审核人员可见
+	Review       ReviewStatus `json:"review,omitempty"`        // 发布前审核状态，为空表示未经审核直接发布
+	ReviewReason string       `json:"review_reason,omitempty"` // 分类器或审核人员给出的原因
+	Scan         ScanStatus   `json:"scan,omitempty"`          // 病毒扫描状态，为空表示上传时未开启扫描
+	Size         int64        `json:"size"`                    // 文件大小（字节）
+	MimeType     string       `json:"mime_type"`               // MIME 类型
+	Views        int64        `json:"views"`                   // 访问次数
+	CreatedAt    time.Time    `json:"created_at"`              // 上传时间
+}
+
+// Published 判断图片是否已发布：未经审核或审核通过
+func (img *Image) Published() bool {
+	return img.Review == "" || img.Review == ReviewApproved
+}
+
+// ImageFilter 管理后台图片列表的查询条件，空字段不过滤
+type ImageFilter struct {
+	UserID   string
+	OrgID    string
+	Since    time.Time
+	Until    time.Time
+	MinSize  int64
+	MaxSize  int64 // 0 表示不限制
+	Private  *bool
+	Reported *bool // 是否有待处理的举报，由调用方查询举报后判断
+}
+
+// Match 判断图片是否满足除举报以外的查询条件
+func (f *ImageFilter) Match(img *Image) bool {
+	switch {
+	case f.UserID != "" && img.UserID != f.UserID:
+		return false
+	case f.OrgID != "" && img.OrgID != f.OrgID:
+		return false
+	case !f.Since.IsZero() && img.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && img.CreatedAt.After(f.Until):
+		return false
+	case img.Size < f.MinSize:
+		return false
+	case f.MaxSize > 0 && img.Size > f.MaxSize:
+		return false
+	case f.Private != nil && img.IsPrivate != *f.Private:
+		return false
+	}
+	return true
+}
+
+// AdminImage 管理后台图片列表中的一项，附带待处理的举报数
+type AdminImage struct {
+	*Image
+	Reports int64 `json:"reports"`
 }
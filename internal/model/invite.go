@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Invite 邀请码
+type Invite struct {
+	Code      string    `json:"code"`
+	MaxUses   int64     `json:"max_uses"`             // 最大使用次数，0 表示不限
+	Uses      int64     `json:"uses"`                 // 已使用次数
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // 过期时间，零值表示不过期
+	Role      Role      `json:"role,omitempty"`       // 注册后的角色，为空时使用默认角色
+	Quota     *Quota    `json:"quota,omitempty"`      // 注册后的配额，为空时使用默认配额
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
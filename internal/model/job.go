@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// JobStatus 后台任务状态
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending" // 排队中
+	JobRunning JobStatus = "running" // 执行中
+	JobDone    JobStatus = "done"    // 已完成
+	JobFailed  JobStatus = "failed"  // 失败，可重新排队
+)
+
+// 后台任务类型
+const (
+	JobDeleteUser = "delete_user" // 删除用户及其数据
+	JobExport     = "export"      // 导出用户数据
+)
+
+// 删除用户时图片的处理方式
+const (
+	ImagesDelete   = "delete"   // 删除图片和文件
+	ImagesTransfer = "transfer" // 转给其他用户
+)
+
+// Job 后台任务，进度保存在 Redis 中，中断后从剩余部分继续执行
+type Job struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Status     JobStatus `json:"status"`
+	UserID     string    `json:"user_id"`               // 任务处理的用户
+	Images     string    `json:"images,omitempty"`      // delete 或 transfer
+	TransferTo string    `json:"transfer_to,omitempty"` // 接收图片的用户
+	Total      int64     `json:"total"`                 // 需要处理的图片数
+	Processed  int64     `json:"processed"`             // 已处理的图片数
+	Error      string    `json:"error,omitempty"`
+	Result     string    `json:"result,omitempty"`     // 任务结果，导出任务为下载令牌
+	ExpiresAt  time.Time `json:"expires_at,omitempty"` // 结果的过期时间
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// OrgRole 组织成员角色
+type OrgRole string
+
+const (
+	OrgOwner  OrgRole = "owner"  // 管理成员、配额和组织本身
+	OrgEditor OrgRole = "editor" // 上传、删除组织图片，管理组织相册
+	OrgViewer OrgRole = "viewer" // 查看组织的私有图片和相册
+)
+
+// orgRoleRank 组织角色由低到高的等级
+var orgRoleRank = map[OrgRole]int{OrgViewer: 1, OrgEditor: 2, OrgOwner: 3}
+
+// Valid 判断是否为已定义的组织角色
+func (r OrgRole) Valid() bool {
+	_, ok := orgRoleRank[r]
+	return ok
+}
+
+// AtLeast 判断角色是否不低于 min，非成员（空角色）始终为 false
+func (r OrgRole) AtLeast(min OrgRole) bool {
+	return r.Valid() && orgRoleRank[r] >= orgRoleRank[min]
+}
+
+// Org 组织，成员共享组织名下的图片、相册和配额
+type Org struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgMember 组织成员
+type OrgMember struct {
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	Role     OrgRole `json:"role"`
+}
+
+// Album 相册，属于个人或组织
+type Album struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UserID      string    `json:"user_id"`          // 创建者
+	OrgID       string    `json:"org_id,omitempty"` // 所属组织，为空时属于创建者个人
+	IsPrivate   bool      `json:"is_private"`       // 是否私有
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package model
+
+// Quota 存储配额，0 表示不限制
+type Quota struct {
+	MaxBytes  int64 `json:"max_bytes"`  // 总字节数上限
+	MaxImages int64 `json:"max_images"` // 图片数量上限
+}
+
+// Usage 已用存储及生效的配额
+type Usage struct {
+	Bytes  int64 `json:"bytes"`  // 已用字节数
+	Images int64 `json:"images"` // 图片数量
+	Quota  Quota `json:"quota"`  // 生效的配额
+	Custom bool  `json:"custom"` // 是否为单独设置的配额
+}
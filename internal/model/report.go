@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// ReportReason 举报类别
+type ReportReason string
+
+const (
+	ReasonSpam       ReportReason = "spam"       // 垃圾广告
+	ReasonNudity     ReportReason = "nudity"     // 色情内容
+	ReasonViolence   ReportReason = "violence"   // 暴力血腥
+	ReasonHarassment ReportReason = "harassment" // 骚扰或仇恨
+	ReasonCopyright  ReportReason = "copyright"  // 侵犯版权
+	ReasonIllegal    ReportReason = "illegal"    // 违法内容
+	ReasonOther      ReportReason = "other"      // 其他
+)
+
+// Valid 判断是否为已定义的举报类别
+func (r ReportReason) Valid() bool {
+	switch r {
+	case ReasonSpam, ReasonNudity, ReasonViolence, ReasonHarassment, ReasonCopyright, ReasonIllegal, ReasonOther:
+		return true
+	}
+	return false
+}
+
+// Report 一条举报
+type Report struct {
+	ID         string       `json:"id"`
+	ImageID    string       `json:"image_id"`
+	Reason     ReportReason `json:"reason"`
+	Comment    string       `json:"comment,omitempty"`
+	ReporterID string       `json:"reporter_id,omitempty"` // 匿名举报时为空
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// ModerationCase 审核队列中的一张图片及其举报汇总
+type ModerationCase struct {
+	ImageID         string               `json:"image_id"`
+	Image           *Image               `json:"image,omitempty"`
+	Reports         int64                `json:"reports"`           // 举报次数
+	Reasons         map[ReportReason]int `json:"reasons"`           // 各类别的举报次数
+	FirstReportedAt time.Time            `json:"first_reported_at"` // 首次举报时间
+}
+
+// 审核操作
+const (
+	ModerationApprove = "approve" // 驳回举报或通过发布前审核，已隐藏的图片恢复显示
+	ModerationReject  = "reject"  // 发布前审核不通过
+	ModerationHide    = "hide"    // 隐藏图片
+	ModerationDelete  = "delete"  // 删除图片
+)
@@ -0,0 +1,56 @@
+package model
+
+// Role 用户角色
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"    // 只能浏览和搜索
+	RoleUploader  Role = "uploader"  // 可上传和管理自己的图片
+	RoleModerator Role = "moderator" // 可查看私有图片、删除任意图片
+	RoleAdmin     Role = "admin"     // 全部权限
+)
+
+// Permission 权限
+type Permission string
+
+const (
+	PermUpload       Permission = "upload"        // 上传图片
+	PermDeleteAny    Permission = "delete_any"    // 删除他人图片
+	PermViewPrivate  Permission = "view_private"  // 查看他人私有图片及统计
+	PermManageUsers  Permission = "manage_users"  // 管理用户、角色和配额
+	PermManageSystem Permission = "manage_system" // 查看系统状态
+)
+
+// rolePermissions 角色权限矩阵
+var rolePermissions = map[Role][]Permission{
+	RoleViewer:    {},
+	RoleUploader:  {PermUpload},
+	RoleModerator: {PermUpload, PermDeleteAny, PermViewPrivate},
+	RoleAdmin:     {PermUpload, PermDeleteAny, PermViewPrivate, PermManageUsers, PermManageSystem},
+}
+
+// Valid 判断是否为已定义的角色
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can 判断角色是否拥有指定权限
+func (r Role) Can(p Permission) bool {
+	for _, perm := range rolePermissions[r] {
+		if perm == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions 返回角色拥有的全部权限
+func (r Role) Permissions() []Permission {
+	return append([]Permission{}, rolePermissions[r]...)
+}
+
+// Roles 返回全部角色，按权限从低到高排列
+func Roles() []Role {
+	return []Role{RoleViewer, RoleUploader, RoleModerator, RoleAdmin}
+}
@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Session 一次登录会话，令牌通过 sid 声明关联会话，会话删除后令牌立即失效
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	UserAgent string    `json:"user_agent"` // 登录时的设备/浏览器
+	IP        string    `json:"ip"`         // 最近一次访问的 IP
+	MFA       bool      `json:"mfa"`        // 是否通过了两步验证
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
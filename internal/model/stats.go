@@ -0,0 +1,28 @@
+package model
+
+// DailyImageStats 单日访问统计
+type DailyImageStats struct {
+	Date           string `json:"date"`            // 日期（YYYY-MM-DD）
+	Views          int64  `json:"views"`           // 访问次数
+	UniqueVisitors int64  `json:"unique_visitors"` // 独立访客（HyperLogLog 估算）
+	BytesServed    int64  `json:"bytes_served"`    // 流量（字节）
+}
+
+// ReferrerCount 来源站点访问次数
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Views    int64  `json:"views"`
+}
+
+// ImageStats 图片在某个时间段内的访问统计
+type ImageStats struct {
+	ImageID        string            `json:"image_id"`
+	TotalViews     int64             `json:"total_views"`     // 历史总访问量
+	From           string            `json:"from"`            // 起始日期
+	To             string            `json:"to"`              // 结束日期
+	Views          int64             `json:"views"`           // 时间段内访问量
+	UniqueVisitors int64             `json:"unique_visitors"` // 时间段内独立访客
+	BytesServed    int64             `json:"bytes_served"`    // 时间段内流量
+	Daily          []DailyImageStats `json:"daily"`
+	TopReferrers   []ReferrerCount   `json:"top_referrers"`
+}
@@ -1,11 +1,96 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// UserStatus 账户状态
+type UserStatus string
+
+const (
+	StatusActive   UserStatus = "active"   // 正常
+	StatusPending  UserStatus = "pending"  // 等待管理员审核
+	StatusDeleting UserStatus = "deleting" // 正在删除，不能登录
+
+	StatusSuspended UserStatus = "suspended" // 暂停，不能登录，可设置到期时间
+	StatusReadOnly  UserStatus = "read_only" // 只读，可以登录浏览，不能上传、删除图片或使用管理权限
+	StatusBanned    UserStatus = "banned"    // 封禁，不能登录
+)
+
+// Moderated 判断是否为管理员可以设置的状态
+func (s UserStatus) Moderated() bool {
+	switch s {
+	case StatusActive, StatusSuspended, StatusReadOnly, StatusBanned:
+		return true
+	}
+	return false
+}
+
+// Blocked 判断该状态是否禁止登录和访问接口
+func (s UserStatus) Blocked() bool {
+	return s == StatusSuspended || s == StatusBanned
+}
 
 type User struct {
-	ID        string    `json:"id"`         // 用户 ID
-	Username  string    `json:"username"`   // 用户名
-	Password  string    `json:"password"`   // 加密密码
-	IsAdmin   bool      `json:"is_admin"`   // 是否管理员
-	CreatedAt time.Time `json:"created_at"` // 创建时间
+	ID        string     `json:"id"`         // 用户 ID
+	Username  string     `json:"username"`   // 用户名
+	Password  string     `json:"password"`   // 加密密码
+	Role      Role       `json:"role"`       // 角色
+	Status    UserStatus `json:"status"`     // 账户状态
+	CreatedAt time.Time  `json:"created_at"` // 创建时间
+
+	StatusReason    string     `json:"status_reason,omitempty"`     // 暂停、只读或封禁的原因
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"` // 状态到期时间，为空表示不过期
+	HideImages      bool       `json:"hide_images,omitempty"`       // 暂停或封禁期间是否隐藏公开图片
+
+	Email         string `json:"email,omitempty"` // 邮箱
+	EmailVerified bool   `json:"email_verified"`  // 邮箱是否已验证
+
+	TOTPSecret    string   `json:"totp_secret,omitempty"`    // 两步验证密钥
+	TOTPEnabled   bool     `json:"totp_enabled"`             // 是否开启两步验证
+	RecoveryCodes []string `json:"recovery_codes,omitempty"` // 恢复码哈希
+}
+
+// EffectiveStatus 返回当前生效的状态，暂停、只读和封禁到期后视为正常
+func (u *User) EffectiveStatus(now time.Time) UserStatus {
+	if u.Status != StatusActive && u.Status.Moderated() && u.StatusExpiresAt != nil && !now.Before(*u.StatusExpiresAt) {
+		return StatusActive
+	}
+	return u.Status
+}
+
+// Sanitized 返回去掉密码和两步验证密钥等敏感字段的副本，用于接口返回
+func (u User) Sanitized() User {
+	u.Password = ""
+	u.TOTPSecret = ""
+	u.RecoveryCodes = nil
+	return u
+}
+
+// UnmarshalJSON 兼容旧数据：未设置状态时视为正常；状态到期时间为零值时视为不过期；未设置角色时 is_admin 转为 admin，其余转为 uploader
+func (u *User) UnmarshalJSON(data []byte) error {
+	type alias User
+	aux := struct {
+		*alias
+		IsAdmin bool `json:"is_admin"`
+	}{alias: (*alias)(u)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if u.Status == "" {
+		u.Status = StatusActive
+	}
+	// 旧数据以零值时间表示不过期
+	if u.StatusExpiresAt != nil && u.StatusExpiresAt.IsZero() {
+		u.StatusExpiresAt = nil
+	}
+	if u.Role == "" {
+		if aux.IsAdmin {
+			u.Role = RoleAdmin
+		} else {
+			u.Role = RoleUploader
+		}
+	}
+	return nil
 }
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserStatusExpiry(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		data       string
+		wantStatus UserStatus
+		wantExpiry bool
+	}{
+		{"legacy zero time", `{"status":"suspended","status_expires_at":"0001-01-01T00:00:00Z"}`, StatusSuspended, false},
+		{"no expiry", `{"status":"banned"}`, StatusBanned, false},
+		{"expired", `{"status":"read_only","status_expires_at":"` + now.Add(-time.Minute).Format(time.RFC3339) + `"}`, StatusActive, true},
+		{"not yet expired", `{"status":"suspended","status_expires_at":"` + now.Add(time.Hour).Format(time.RFC3339) + `"}`, StatusSuspended, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u User
+			if err := json.Unmarshal([]byte(tt.data), &u); err != nil {
+				t.Fatal(err)
+			}
+			if got := u.EffectiveStatus(now); got != tt.wantStatus {
+				t.Errorf("EffectiveStatus() = %s, want %s", got, tt.wantStatus)
+			}
+			data, err := json.Marshal(&u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if has := strings.Contains(string(data), "status_expires_at"); has != tt.wantExpiry {
+				t.Errorf("marshalled %s, want status_expires_at present %v", data, tt.wantExpiry)
+			}
+		})
+	}
+}
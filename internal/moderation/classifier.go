@@ -0,0 +1,100 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// Webhook 将图片原始内容 POST 到 HTTP 接口，Content-Type 为图片 MIME 类型，
+// 并通过 X-Image-ID、X-Image-Size、X-Uploader-ID 请求头附带元数据；接口返回 2xx 和 Verdict JSON
+type Webhook struct {
+	name    string
+	url     string
+	headers map[string]string
+}
+
+func (c *Webhook) Name() string {
+	return c.name
+}
+
+func (c *Webhook) Classify(ctx context.Context, path string, img *model.Image) (*Verdict, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, file)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", img.MimeType)
+	req.Header.Set("X-Image-ID", img.ID)
+	req.Header.Set("X-Image-Size", strconv.FormatInt(img.Size, 10))
+	req.Header.Set("X-Uploader-ID", img.UserID)
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return decodeVerdict(io.LimitReader(resp.Body, 64<<10))
+}
+
+// commandWaitDelay 命令超时被终止后等待输出关闭的时间，避免脚本的子进程继续占用输出导致超时失效
+const commandWaitDelay = time.Second
+
+// Command 执行本地命令，图片路径作为最后一个参数，并通过 IBED_IMAGE_ID、IBED_MIME_TYPE、IBED_USER_ID
+// 环境变量附带元数据；命令以 0 退出并在标准输出打印 Verdict JSON
+type Command struct {
+	name string
+	args []string
+}
+
+func (c *Command) Name() string {
+	return c.name
+}
+
+func (c *Command) Classify(ctx context.Context, path string, img *model.Image) (*Verdict, error) {
+	cmd := exec.CommandContext(ctx, c.args[0], append(c.args[1:], path)...)
+	cmd.Env = append(os.Environ(),
+		"IBED_IMAGE_ID="+img.ID,
+		"IBED_MIME_TYPE="+img.MimeType,
+		"IBED_USER_ID="+img.UserID,
+	)
+	cmd.WaitDelay = commandWaitDelay
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return decodeVerdict(bytes.NewReader(out))
+}
+
+func decodeVerdict(r io.Reader) (*Verdict, error) {
+	var verdict Verdict
+	if err := json.NewDecoder(r).Decode(&verdict); err != nil {
+		return nil, fmt.Errorf("invalid verdict: %w", err)
+	}
+	switch verdict.Decision {
+	case DecisionApprove, DecisionReview, DecisionReject:
+		return &verdict, nil
+	}
+	return nil, fmt.Errorf("invalid decision %q", verdict.Decision)
+}
@@ -0,0 +1,115 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+// 分类器的判定结果
+const (
+	DecisionApprove = "approve" // 直接发布
+	DecisionReview  = "review"  // 需要人工审核
+	DecisionReject  = "reject"  // 拒绝发布
+)
+
+// Verdict 分类器返回的判定，webhook 响应和命令输出均为该 JSON 格式
+type Verdict struct {
+	Decision string   `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+	Labels   []string `json:"labels,omitempty"`
+}
+
+// Classifier 发布前审核分类器，path 为上传的临时文件
+type Classifier interface {
+	Name() string
+	Classify(ctx context.Context, path string, img *model.Image) (*Verdict, error)
+}
+
+// Pipeline 依次调用全部分类器，按最严格的结果决定审核状态
+type Pipeline struct {
+	classifiers []Classifier
+	timeouts    []time.Duration
+	onError     model.ReviewStatus
+}
+
+// New 根据配置创建审核流程
+func New(cfg config.ModerationConfig) (*Pipeline, error) {
+	p := &Pipeline{onError: model.ReviewStatus(cfg.OnError)}
+	switch p.onError {
+	case model.ReviewPending, model.ReviewRejected, model.ReviewApproved:
+	default:
+		return nil, fmt.Errorf("invalid moderation.on_error %q", cfg.OnError)
+	}
+	for _, c := range cfg.Classifiers {
+		var classifier Classifier
+		switch c.Type {
+		case config.ClassifierWebhook:
+			if c.URL == "" {
+				return nil, fmt.Errorf("classifier %q: url is required", c.Name)
+			}
+			classifier = &Webhook{name: c.Name, url: c.URL, headers: c.Headers}
+		case config.ClassifierCommand:
+			if len(c.Command) == 0 {
+				return nil, fmt.Errorf("classifier %q: command is required", c.Name)
+			}
+			classifier = &Command{name: c.Name, args: c.Command}
+		default:
+			return nil, fmt.Errorf("classifier %q: unknown type %q", c.Name, c.Type)
+		}
+		p.classifiers = append(p.classifiers, classifier)
+		p.timeouts = append(p.timeouts, time.Duration(c.Timeout)*time.Second)
+	}
+	return p, nil
+}
+
+// Enabled 是否配置了分类器
+func (p *Pipeline) Enabled() bool {
+	return len(p.classifiers) > 0
+}
+
+// Screen 审核上传的图片，返回审核状态和原因；
+// 任一分类器拒绝即为 rejected，要求人工审核即为 pending，出错时按 on_error 处理
+func (p *Pipeline) Screen(ctx context.Context, path string, img *model.Image) (model.ReviewStatus, string) {
+	status, reason := model.ReviewApproved, ""
+	for i, classifier := range p.classifiers {
+		cctx, cancel := context.WithTimeout(ctx, p.timeouts[i])
+		verdict, err := classifier.Classify(cctx, path, img)
+		cancel()
+
+		var result model.ReviewStatus
+		var why string
+		switch {
+		case err != nil:
+			slog.Error("Classifier failed", "classifier", classifier.Name(), "image_id", img.ID, "error", err)
+			result, why = p.onError, classifier.Name()+": classifier unavailable"
+		case verdict.Decision == DecisionApprove:
+			result = model.ReviewApproved
+		case verdict.Decision == DecisionReject:
+			result, why = model.ReviewRejected, classifier.Name()+": "+verdict.Reason
+		default:
+			result, why = model.ReviewPending, classifier.Name()+": "+verdict.Reason
+		}
+		if severity(result) > severity(status) {
+			status, reason = result, why
+		}
+		if status == model.ReviewRejected {
+			break
+		}
+	}
+	return status, reason
+}
+
+func severity(s model.ReviewStatus) int {
+	switch s {
+	case model.ReviewRejected:
+		return 2
+	case model.ReviewPending:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,184 @@
+package moderation
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+var testImage = &model.Image{ID: "img1", UserID: "u1", MimeType: "image/png", Size: 4}
+
+// writeTestImage 写入待审核的临时文件
+func writeTestImage(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "upload.png")
+	if err := os.WriteFile(path, []byte("\x89PNG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClassifierServer 模拟 webhook 分类器，路径决定返回内容
+func newClassifierServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	verdicts := map[string]string{
+		"/approve":      `{"decision":"approve"}`,
+		"/review":       `{"decision":"review","reason":"maybe nsfw"}`,
+		"/reject":       `{"decision":"reject","reason":"nsfw","labels":["nsfw"]}`,
+		"/malformed":    `{"decision":`,
+		"/bad-decision": `{"decision":"allow"}`,
+	}
+	for path, body := range verdicts {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			data, _ := io.ReadAll(r.Body)
+			if string(data) != "\x89PNG" || r.Header.Get("Content-Type") != "image/png" ||
+				r.Header.Get("X-Image-ID") != "img1" || r.Header.Get("X-Image-Size") != "4" ||
+				r.Header.Get("X-Uploader-ID") != "u1" || r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, "unexpected request", http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, body)
+		})
+	}
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// 读完请求体后服务器才能感知客户端断开
+		io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestScreenWebhook(t *testing.T) {
+	srv, calls := newClassifierServer(t)
+	path := writeTestImage(t)
+	tests := []struct {
+		name       string
+		endpoints  []string
+		onError    string
+		wantStatus model.ReviewStatus
+		wantReason string
+		wantCalls  int32
+	}{
+		{"no classifiers", nil, "pending", model.ReviewApproved, "", 0},
+		{"approve", []string{"/approve"}, "pending", model.ReviewApproved, "", 1},
+		{"review", []string{"/approve", "/review"}, "pending", model.ReviewPending, "c2: maybe nsfw", 2},
+		{"reject wins over review", []string{"/review", "/reject"}, "pending", model.ReviewRejected, "c2: nsfw", 2},
+		{"reject stops the pipeline", []string{"/reject", "/review"}, "pending", model.ReviewRejected, "c1: nsfw", 1},
+		{"first review reason kept", []string{"/review", "/review"}, "approved", model.ReviewPending, "c1: maybe nsfw", 2},
+		{"error falls back to on_error", []string{"/error"}, "pending", model.ReviewPending, "c1: classifier unavailable", 1},
+		{"error rejected by on_error", []string{"/approve", "/error"}, "rejected", model.ReviewRejected, "c2: classifier unavailable", 2},
+		{"error approved by on_error", []string{"/error"}, "approved", model.ReviewApproved, "", 1},
+		{"timeout falls back to on_error", []string{"/slow"}, "rejected", model.ReviewRejected, "c1: classifier unavailable", 1},
+		{"malformed verdict", []string{"/malformed"}, "pending", model.ReviewPending, "c1: classifier unavailable", 1},
+		{"unknown decision", []string{"/bad-decision"}, "rejected", model.ReviewRejected, "c1: classifier unavailable", 1},
+		{"stricter on_error beats approve", []string{"/bad-decision", "/approve"}, "pending", model.ReviewPending, "c1: classifier unavailable", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.ModerationConfig{OnError: tt.onError}
+			for i, endpoint := range tt.endpoints {
+				cfg.Classifiers = append(cfg.Classifiers, config.ClassifierConfig{
+					Name:    "c" + string(rune('1'+i)),
+					Type:    config.ClassifierWebhook,
+					URL:     srv.URL + endpoint,
+					Headers: map[string]string{"Authorization": "Bearer secret"},
+					Timeout: 1,
+				})
+			}
+			p, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls.Store(0)
+			status, reason := p.Screen(context.Background(), path, testImage)
+			if status != tt.wantStatus || reason != tt.wantReason {
+				t.Errorf("Screen() = %s %q, want %s %q", status, reason, tt.wantStatus, tt.wantReason)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("classifier called %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestScreenCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	path := writeTestImage(t)
+	// 脚本检查图片路径（最后一个参数）和环境变量后输出判定
+	script := func(body string) []string {
+		return []string{"sh", "-c", `test -f "$1" && test "$IBED_IMAGE_ID" = img1 && test "$IBED_MIME_TYPE" = image/png && test "$IBED_USER_ID" = u1 || exit 3; ` + body, "sh"}
+	}
+	tests := []struct {
+		name       string
+		command    []string
+		wantStatus model.ReviewStatus
+		wantReason string
+	}{
+		{"approve", script(`echo '{"decision":"approve"}'`), model.ReviewApproved, ""},
+		{"review", script(`echo '{"decision":"review","reason":"blurry"}'`), model.ReviewPending, "script: blurry"},
+		{"reject", script(`echo '{"decision":"reject","reason":"nsfw"}'`), model.ReviewRejected, "script: nsfw"},
+		{"non-zero exit", script(`echo '{"decision":"approve"}'; exit 1`), model.ReviewRejected, "script: classifier unavailable"},
+		{"malformed output", script(`echo 'not json'`), model.ReviewRejected, "script: classifier unavailable"},
+		{"timeout", script(`sleep 5`), model.ReviewRejected, "script: classifier unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(config.ModerationConfig{OnError: "rejected", Classifiers: []config.ClassifierConfig{
+				{Name: "script", Type: config.ClassifierCommand, Command: tt.command, Timeout: 1},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, reason := p.Screen(context.Background(), path, testImage)
+			if status != tt.wantStatus || reason != tt.wantReason {
+				t.Errorf("Screen() = %s %q, want %s %q", status, reason, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ModerationConfig
+		want string
+	}{
+		{"on_error", config.ModerationConfig{OnError: "ignore"}, "on_error"},
+		{"webhook without url", config.ModerationConfig{OnError: "pending", Classifiers: []config.ClassifierConfig{{Name: "w", Type: config.ClassifierWebhook}}}, "url is required"},
+		{"command without args", config.ModerationConfig{OnError: "pending", Classifiers: []config.ClassifierConfig{{Name: "c", Type: config.ClassifierCommand}}}, "command is required"},
+		{"unknown type", config.ModerationConfig{OnError: "pending", Classifiers: []config.ClassifierConfig{{Name: "x", Type: "grpc"}}}, "unknown type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("New() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
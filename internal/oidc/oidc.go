@@ -0,0 +1,299 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	discoveryTTL     = time.Hour
+	jwksMinRefresh   = time.Minute
+	maxResponseBytes = 1 << 20
+)
+
+// 允许的 ID Token 签名算法，不接受 none 和对称算法
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+type discoveryDoc struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity 从 ID Token 中提取的用户身份
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Username      string
+	Email         string
+	EmailVerified bool // email_verified 声明为 true
+	Groups        []string
+	MFA           bool // amr 中包含多因素认证方式
+}
+
+// Provider OIDC 身份提供方客户端，支持自动发现、JWKS 缓存和授权码 + PKCE 流程
+type Provider struct {
+	config config.OIDCConfig
+	client *http.Client
+
+	mu           sync.Mutex
+	discovery    *discoveryDoc
+	discoveredAt time.Time
+	keys         map[string]crypto.PublicKey
+	keysAt       time.Time
+}
+
+func NewProvider(cfg config.OIDCConfig) *Provider {
+	return &Provider{config: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// NewPKCE 生成 PKCE 的 code_verifier 和 S256 code_challenge
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString 生成 URL 安全的随机字符串，用于 state 和 nonce
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// AuthCodeURL 返回跳转到身份提供方的授权地址
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(p.config.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", codeChallenge)
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return doc.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange 用授权码换取 ID Token 并完成校验
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	doc, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.doJSON(req, &tokens); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token exchange: missing id_token")
+	}
+	return p.verifyIDToken(ctx, doc, tokens.IDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, doc *discoveryDoc, raw, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, doc, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(doc.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	id := &Identity{Issuer: doc.Issuer}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	id.Username, _ = claims[p.config.UsernameClaim].(string)
+	id.Email, _ = claims["email"].(string)
+	// 部分身份提供方以字符串形式返回 email_verified
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	id.Groups = stringList(claims[p.config.GroupsClaim])
+	for _, amr := range stringList(claims["amr"]) {
+		if amr == "mfa" || amr == "otp" || amr == "hwk" || amr == "swk" {
+			id.MFA = true
+		}
+	}
+	return id, nil
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discoveryDoc, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil && time.Since(p.discoveredAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	var doc discoveryDoc
+	if err := p.doJSON(req, &doc); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(p.config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery: issuer mismatch %q", doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery: incomplete document")
+	}
+	p.discovery = &doc
+	p.discoveredAt = time.Now()
+	p.keys = nil
+	return p.discovery, nil
+}
+
+// getKey 按 kid 查找公钥，遇到未知 kid 时重新拉取 JWKS（限制刷新频率）
+func (p *Provider) getKey(ctx context.Context, doc *discoveryDoc, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysAt) < jwksMinRefresh {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, doc.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jsonWebKeySet
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// lookupKey 没有 kid 且只有一个公钥时直接使用该公钥
+func (p *Provider) lookupKey(kid string) crypto.PublicKey {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (p *Provider) doJSON(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// stringList 兼容字符串数组和空格分隔字符串两种声明格式
+func stringList(v any) []string {
+	switch val := v.(type) {
+	case []any:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		return strings.Fields(val)
+	}
+	return nil
+}
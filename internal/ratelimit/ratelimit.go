@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Rate 时间窗口内允许的请求数
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Result 一次限流判断的结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration // 配额完全恢复所需时间
+	RetryAfter time.Duration // 被拒绝时需要等待的时间
+}
+
+// gcraScript 使用 GCRA 算法实现令牌桶，时间取 Redis 服务器时间以保证多副本一致
+// KEYS[1] 限流键；ARGV: 突发量、发射间隔（微秒）
+var gcraScript = goredis.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tolerance = interval * burst
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or '0')
+if tat < now then tat = now end
+local newTat = tat + interval
+local diff = now - (newTat - tolerance)
+if diff < 0 then
+	return {0, 0, tat - now, -diff}
+end
+redis.call('SET', KEYS[1], newTat, 'PX', math.ceil((newTat - now) / 1000))
+return {1, math.floor(diff / interval), newTat - now, 0}
+`)
+
+// Limiter 基于 Redis 的分布式限流器
+type Limiter struct {
+	redis  *redis.Client
+	prefix string
+}
+
+func NewLimiter(redis *redis.Client) *Limiter {
+	return &Limiter{redis: redis, prefix: "ratelimit:"}
+}
+
+// Allow 消耗 key 的一个配额
+func (l *Limiter) Allow(ctx context.Context, key string, rate Rate) (*Result, error) {
+	interval := rate.Period.Microseconds() / int64(rate.Limit)
+	values, err := gcraScript.Run(ctx, l.redis, []string{l.prefix + key}, rate.Limit, interval).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Allowed:    values[0].(int64) == 1,
+		Limit:      rate.Limit,
+		Remaining:  int(values[1].(int64)),
+		ResetAfter: time.Duration(values[2].(int64)) * time.Microsecond,
+		RetryAfter: time.Duration(values[3].(int64)) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/redis"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1700000000, 0))
+	rc, err := redis.NewClient(mr.Addr(), "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return NewLimiter(rc), mr
+}
+
+func TestAllowBurstThenReject(t *testing.T) {
+	tests := []struct {
+		name string
+		rate Rate
+	}{
+		{"one per second", Rate{Limit: 1, Period: time.Second}},
+		{"five per minute", Rate{Limit: 5, Period: time.Minute}},
+		{"hundred per hour", Rate{Limit: 100, Period: time.Hour}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestLimiter(t)
+			ctx := context.Background()
+			for i := 0; i < tt.rate.Limit; i++ {
+				res, err := l.Allow(ctx, "k", tt.rate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !res.Allowed {
+					t.Fatalf("request %d rejected within burst", i+1)
+				}
+				if res.Remaining != tt.rate.Limit-i-1 {
+					t.Errorf("request %d: remaining = %d, want %d", i+1, res.Remaining, tt.rate.Limit-i-1)
+				}
+			}
+			res, err := l.Allow(ctx, "k", tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Allowed {
+				t.Fatal("request over burst allowed")
+			}
+			interval := tt.rate.Period / time.Duration(tt.rate.Limit)
+			if res.RetryAfter <= 0 || res.RetryAfter > interval {
+				t.Errorf("retry after = %v, want (0, %v]", res.RetryAfter, interval)
+			}
+		})
+	}
+}
+
+func TestAllowRecoversOverTime(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	ctx := context.Background()
+	rate := Rate{Limit: 2, Period: 10 * time.Second}
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 2; i++ {
+		l.Allow(ctx, "k", rate)
+	}
+	if res, _ := l.Allow(ctx, "k", rate); res.Allowed {
+		t.Fatal("expected rejection after burst")
+	}
+	// 一个发射间隔后恢复一个配额
+	mr.SetTime(now.Add(5 * time.Second))
+	if res, _ := l.Allow(ctx, "k", rate); !res.Allowed {
+		t.Fatal("expected one request after one interval")
+	}
+	if res, _ := l.Allow(ctx, "k", rate); res.Allowed {
+		t.Fatal("expected rejection right after recovered request")
+	}
+}
+
+func TestAllowKeysAreIndependent(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	ctx := context.Background()
+	rate := Rate{Limit: 1, Period: time.Minute}
+
+	for _, key := range []string{"login:ip:1.2.3.4", "login:ip:5.6.7.8", "image:ip:1.2.3.4"} {
+		if res, _ := l.Allow(ctx, key, rate); !res.Allowed {
+			t.Errorf("%s: first request rejected", key)
+		}
+	}
+	if res, _ := l.Allow(ctx, "login:ip:1.2.3.4", rate); res.Allowed {
+		t.Error("second request on the same key allowed")
+	}
+}
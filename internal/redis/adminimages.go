@@ -0,0 +1,266 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// imagesIndexKey 全部图片按上传时间排序的索引，分数为上传时间（毫秒）
+	imagesIndexKey = "images:index"
+	// imagesBatch 每次从索引读取的条目数
+	imagesBatch = 200
+	// imagesMaxScan 单次查询最多检查的图片数，条件过于稀疏时提前返回游标
+	imagesMaxScan = 10000
+)
+
+// ErrInvalidImageCursor 图片列表游标格式错误
+var ErrInvalidImageCursor = errors.New("invalid cursor")
+
+// imageCursor 图片列表游标：上一页最后一张图片的上传时间（毫秒）和 ID
+func imageCursor(score float64, id string) string {
+	return fmt.Sprintf("%d:%s", int64(score), id)
+}
+
+// ListImages 按上传时间从新到旧分页列出满足条件的图片，cursor 为上一页返回的游标；
+// 返回的游标为空表示没有更多图片。指定 org_id 时只读取组织图片列表，只指定上传者时只读取其个人图片列表，
+// 否则遍历全部图片的索引。元数据已过期的图片在遍历结束后统一从索引中移除并扣减统计计数器
+func (c *Client) ListImages(ctx context.Context, f model.ImageFilter, cursor string, limit int) ([]*model.AdminImage, string, error) {
+	// 同一毫秒内的图片按 ID 从大到小排列，游标之前（含游标）的图片需要跳过
+	var after *imagePosition
+	if cursor != "" {
+		scorePart, id, ok := strings.Cut(cursor, ":")
+		score, err := strconv.ParseInt(scorePart, 10, 64)
+		if !ok || err != nil || id == "" {
+			return nil, "", ErrInvalidImageCursor
+		}
+		after = &imagePosition{score: score, id: id}
+	}
+
+	var images []*model.AdminImage
+	var next string
+	var expired []string
+	var err error
+	switch {
+	case f.OrgID != "":
+		images, next, expired, err = c.listOwnerImages(ctx, orgImagesKey(f.OrgID), f, after, limit)
+	case f.UserID != "":
+		images, next, expired, err = c.listOwnerImages(ctx, userImagesKey(f.UserID), f, after, limit)
+	default:
+		images, next, expired, err = c.listIndexImages(ctx, f, after, limit)
+	}
+	if len(expired) > 0 {
+		if _, err := c.expireImages(ctx, expired); err != nil {
+			slog.Warn("Failed to remove expired images from index", "error", err)
+		}
+	}
+	return images, next, err
+}
+
+// imagePosition 图片在列表中的位置：上传时间（毫秒）和 ID
+type imagePosition struct {
+	score int64
+	id    string
+}
+
+// before 判断位置为 (score, id) 的图片是否排在 p 之后（即下一页应包含）
+func (p *imagePosition) before(score int64, id string) bool {
+	return p == nil || score < p.score || score == p.score && id < p.id
+}
+
+// listIndexImages 按全部图片的索引分批读取，返回的 expired 为元数据已过期的图片 ID
+func (c *Client) listIndexImages(ctx context.Context, f model.ImageFilter, after *imagePosition, limit int) ([]*model.AdminImage, string, []string, error) {
+	min, max := "-inf", "+inf"
+	if !f.Since.IsZero() {
+		min = strconv.FormatInt(f.Since.UnixMilli(), 10)
+	}
+	if !f.Until.IsZero() {
+		max = strconv.FormatInt(f.Until.UnixMilli(), 10)
+	}
+	if after != nil && (f.Until.IsZero() || after.score < f.Until.UnixMilli()) {
+		max = strconv.FormatInt(after.score, 10)
+	}
+
+	images := []*model.AdminImage{}
+	var expired []string
+	var offset int64
+	cursor := ""
+	for scanned := 0; scanned < imagesMaxScan; {
+		entries, err := c.ZRevRangeByScoreWithScores(ctx, imagesIndexKey, &redis.ZRangeBy{
+			Min: min, Max: max, Offset: offset, Count: imagesBatch,
+		}).Result()
+		if err != nil {
+			return nil, "", expired, err
+		}
+		scanned += len(entries)
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			if id := entry.Member.(string); after.before(int64(entry.Score), id) {
+				ids = append(ids, id)
+			}
+		}
+		loaded, err := c.loadAdminImages(ctx, ids)
+		if err != nil {
+			return nil, "", expired, err
+		}
+		for i, img := range loaded {
+			if img == nil {
+				expired = append(expired, ids[i])
+				continue
+			}
+			if !f.Match(img.Image) || f.Reported != nil && (img.Reports > 0) != *f.Reported {
+				continue
+			}
+			images = append(images, img)
+			if len(images) == limit {
+				return images, imageCursor(float64(img.CreatedAt.UnixMilli()), img.ID), expired, nil
+			}
+		}
+		if len(entries) < imagesBatch {
+			return images, "", expired, nil
+		}
+		// 下一批从本批最后一个分数继续，跳过该分数下已读取的条目
+		last := entries[len(entries)-1]
+		lastMax := strconv.FormatInt(int64(last.Score), 10)
+		if lastMax == max {
+			offset += int64(len(entries))
+		} else {
+			max, offset = lastMax, 0
+			for _, entry := range entries {
+				if entry.Score == last.Score {
+					offset++
+				}
+			}
+		}
+		cursor = imageCursor(last.Score, last.Member.(string))
+	}
+	return images, cursor, expired, nil
+}
+
+// listOwnerImages 读取用户或组织图片列表中的全部图片，排序后返回游标之后的一页
+func (c *Client) listOwnerImages(ctx context.Context, key string, f model.ImageFilter, after *imagePosition, limit int) ([]*model.AdminImage, string, []string, error) {
+	ids, err := c.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	matched := []*model.AdminImage{}
+	var expired []string
+	for start := 0; start < len(ids); start += imagesBatch {
+		batch := ids[start:min(start+imagesBatch, len(ids))]
+		loaded, err := c.loadAdminImages(ctx, batch)
+		if err != nil {
+			return nil, "", expired, err
+		}
+		for i, img := range loaded {
+			if img == nil {
+				expired = append(expired, batch[i])
+				continue
+			}
+			if !after.before(img.CreatedAt.UnixMilli(), img.ID) || !f.Match(img.Image) ||
+				f.Reported != nil && (img.Reports > 0) != *f.Reported {
+				continue
+			}
+			matched = append(matched, img)
+		}
+	}
+	if len(expired) > 0 {
+		if err := c.SRem(ctx, key, expired).Err(); err != nil {
+			return nil, "", expired, err
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if sa, sb := a.CreatedAt.UnixMilli(), b.CreatedAt.UnixMilli(); sa != sb {
+			return sa > sb
+		}
+		return a.ID > b.ID
+	})
+	if len(matched) <= limit {
+		return matched, "", expired, nil
+	}
+	last := matched[limit-1]
+	return matched[:limit], imageCursor(float64(last.CreatedAt.UnixMilli()), last.ID), expired, nil
+}
+
+// loadAdminImages 用一次流水线读取一批图片的元数据、标签、访问次数和待处理举报数，元数据不存在的图片对应 nil
+func (c *Client) loadAdminImages(ctx context.Context, ids []string) ([]*model.AdminImage, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	type cmds struct {
+		data    *redis.StringCmd
+		tags    *redis.StringSliceCmd
+		views   *redis.FloatCmd
+		reports *redis.IntCmd
+	}
+	batch := make([]cmds, len(ids))
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			batch[i] = cmds{
+				data:    pipe.Get(ctx, fmt.Sprintf("image:%s", id)),
+				tags:    pipe.SMembers(ctx, fmt.Sprintf("image:%s:tags", id)),
+				views:   pipe.ZScore(ctx, viewsAllKey, id),
+				reports: pipe.LLen(ctx, reportsKey(id)),
+			}
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	images := make([]*model.AdminImage, len(ids))
+	for i, cmd := range batch {
+		data, err := cmd.data.Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var img model.Image
+		if err := json.Unmarshal(data, &img); err != nil {
+			return nil, err
+		}
+		img.Tags = cmd.tags.Val()
+		img.Views = int64(cmd.views.Val())
+		images[i] = &model.AdminImage{Image: &img, Reports: cmd.reports.Val()}
+	}
+	return images, nil
+}
+
+// SetImageTags 替换图片的标签，保留原有过期时间；图片已不存在时返回 redis.Nil
+func (c *Client) SetImageTags(ctx context.Context, img *model.Image, tags []string) error {
+	key := fmt.Sprintf("image:%s", img.ID)
+	tagsKey := fmt.Sprintf("image:%s:tags", img.ID)
+	ttl, err := c.PTTL(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	img.Tags = tags
+	if err := c.UpdateImage(ctx, img); err != nil {
+		return err
+	}
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, tagsKey)
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tagsKey, tag)
+		}
+		if ttl > 0 {
+			pipe.PExpire(ctx, tagsKey, ttl)
+		}
+		return nil
+	})
+	return err
+}
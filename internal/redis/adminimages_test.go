@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestListImages(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	// img0 最早，img9 最新；img3 和 img4 同一毫秒上传；偶数编号属于 alice，img7、img8 属于组织
+	for i := 0; i < 10; i++ {
+		img := &model.Image{ID: fmt.Sprintf("img%d", i), UserID: "bob", Size: int64(i), CreatedAt: base.Add(time.Duration(i) * time.Second)}
+		if i%2 == 0 {
+			img.UserID = "alice"
+		}
+		if i == 4 {
+			img.CreatedAt = base.Add(3 * time.Second)
+		}
+		if i == 7 || i == 8 {
+			img.OrgID = "org1"
+		}
+		if err := c.SaveImage(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"img5", "img6"} {
+		mr.Del("image:" + id)
+	}
+
+	tests := []struct {
+		name   string
+		filter model.ImageFilter
+		limit  int
+		want   []string
+	}{
+		{"all images", model.ImageFilter{}, 3, []string{"img9", "img8", "img7", "img4", "img3", "img2", "img1", "img0"}},
+		{"owner", model.ImageFilter{UserID: "alice"}, 2, []string{"img4", "img2", "img0"}},
+		{"org", model.ImageFilter{OrgID: "org1"}, 1, []string{"img8", "img7"}},
+		{"org and owner", model.ImageFilter{OrgID: "org1", UserID: "alice"}, 5, []string{"img8"}},
+		{"min size", model.ImageFilter{MinSize: 3}, 2, []string{"img9", "img8", "img7", "img4", "img3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			cursor := ""
+			for page := 0; page < 20; page++ {
+				images, next, err := c.ListImages(ctx, tt.filter, cursor, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(images) > tt.limit {
+					t.Fatalf("page has %d images, limit %d", len(images), tt.limit)
+				}
+				for _, img := range images {
+					got = append(got, img.ID)
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 过期的图片在遍历后从索引中移除，并扣减统计计数器
+	if index, _ := mr.ZMembers(imagesIndexKey); len(index) != 8 {
+		t.Errorf("images index %v, want expired images removed", index)
+	}
+	if got := mr.HGet(statsTotalsKey, "images"); got != "8" {
+		t.Errorf("total images = %s, want 8", got)
+	}
+}
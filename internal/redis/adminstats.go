@@ -0,0 +1,496 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// statsTotalsKey 全站总数，字段 users、images、bytes
+	statsTotalsKey = "stats:totals"
+	// statsMimeImagesKey 和 statsMimeBytesKey 按 MIME 类型统计的图片数量和字节数
+	statsMimeImagesKey = "stats:mime:images"
+	statsMimeBytesKey  = "stats:mime:bytes"
+	// statsUploadsKey 和 statsViewsKey 每天（UTC）的上传数和访问数，字段为 20060102
+	statsUploadsKey = "stats:uploads:daily"
+	statsViewsKey   = "stats:views:daily"
+	// statsUploadersKey 和 statsUploaderBytesKey 每个上传者的图片数量和字节数
+	statsUploadersKey     = "stats:uploaders"
+	statsUploaderBytesKey = "stats:uploaders:bytes"
+	// statsRebuiltKey 最近一次重建计数器的时间戳
+	statsRebuiltKey = "stats:rebuilt_at"
+	// statsVersionKey 计数器和索引的版本，低于 statsVersion 时启动时重建
+	statsVersionKey = "stats:version"
+	// statsImagesKey 每张已计入统计的图片的大小、类型和归属，字段为图片 ID，元数据过期后据此扣减计数器
+	statsImagesKey = "stats:images"
+	// statsVersion 当前版本：1 统计计数器和用户索引；2 增加图片列表索引；3 增加图片统计信息；
+	// 4 按图片数据重新计算配额用量（补齐配额功能之前上传的图片）
+	statsVersion = 4
+	// usersIndexKey 按用户名排序的用户索引，分数均为 0，成员为 usersIndexMember
+	usersIndexKey = "users:index"
+)
+
+// usersIndexMember 用户索引成员：小写用户名 + \x00 + 用户 ID，用于按用户名前缀搜索
+func usersIndexMember(username, id string) string {
+	return strings.ToLower(username) + "\x00" + id
+}
+
+// MaxStatsDays 按天统计最多查询和保留的天数
+const MaxStatsDays = 365
+
+// imageStat 图片计入统计时的大小、类型和归属
+type imageStat struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type"`
+	UserID   string `json:"user_id"`
+	OrgID    string `json:"org_id,omitempty"`
+}
+
+func newImageStat(img *model.Image) string {
+	data, _ := json.Marshal(imageStat{Size: img.Size, MimeType: img.MimeType, UserID: img.UserID, OrgID: img.OrgID})
+	return string(data)
+}
+
+// countImage 在事务中增加图片相关的计数器并记录图片统计信息
+func countImage(ctx context.Context, pipe redis.Pipeliner, img *model.Image) {
+	pipe.HIncrBy(ctx, statsTotalsKey, "images", 1)
+	pipe.HIncrBy(ctx, statsTotalsKey, "bytes", img.Size)
+	pipe.HIncrBy(ctx, statsMimeImagesKey, img.MimeType, 1)
+	pipe.HIncrBy(ctx, statsMimeBytesKey, img.MimeType, img.Size)
+	pipe.ZIncrBy(ctx, statsUploadersKey, 1, img.UserID)
+	pipe.ZIncrBy(ctx, statsUploaderBytesKey, float64(img.Size), img.UserID)
+	pipe.HIncrBy(ctx, statsUploadsKey, img.CreatedAt.UTC().Format(dayLayout), 1)
+	pipe.HSet(ctx, statsImagesKey, img.ID, newImageStat(img))
+}
+
+// uncountImageLua 按记录的统计信息扣减计数器并删除记录，没有记录（已扣减过）时返回空字符串，否则返回记录
+// KEYS[1] 图片统计信息；KEYS[2] 全站总数；KEYS[3] MIME 图片数；KEYS[4] MIME 字节数；KEYS[5] 上传者图片数；KEYS[6] 上传者字节数；
+// ARGV[1] 图片 ID
+const uncountImageLua = `
+local data = redis.call('HGET', KEYS[1], ARGV[1])
+if not data then return '' end
+local s = cjson.decode(data)
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('HINCRBY', KEYS[2], 'images', -1)
+redis.call('HINCRBY', KEYS[2], 'bytes', -s.size)
+redis.call('HINCRBY', KEYS[3], s.mime_type, -1)
+redis.call('HINCRBY', KEYS[4], s.mime_type, -s.size)
+redis.call('ZINCRBY', KEYS[5], -1, s.user_id)
+redis.call('ZINCRBY', KEYS[6], -s.size, s.user_id)
+return data
+`
+
+var uncountImageScript = redis.NewScript(uncountImageLua)
+
+// expireImageScript 图片元数据已不存在时从图片列表索引移除并扣减计数器，元数据仍存在时返回 nil
+// KEYS[1..6] 同 uncountImageLua；KEYS[7] 图片元数据；KEYS[8] 图片列表索引；ARGV[1] 图片 ID
+var expireImageScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[7]) == 1 then return false end
+redis.call('ZREM', KEYS[8], ARGV[1])
+` + uncountImageLua)
+
+func uncountImageKeys() []string {
+	return []string{statsImagesKey, statsTotalsKey, statsMimeImagesKey, statsMimeBytesKey, statsUploadersKey, statsUploaderBytesKey}
+}
+
+// uncountImage 在事务中扣减图片相关的计数器；同一图片只扣减一次，图片已被过期清理扣减时不再重复扣减。
+// 事务中不能在 NOSCRIPT 后重试 EVALSHA，因此直接发送脚本
+func uncountImage(ctx context.Context, pipe redis.Pipeliner, imageID string) {
+	uncountImageScript.Eval(ctx, pipe, uncountImageKeys(), imageID)
+}
+
+// SweepExpiredImages 清理元数据已随过期时间删除的图片：扣减统计计数器，并从图片列表索引、用户或组织图片列表、
+// 举报、审核队列和排行榜中移除。只检查上传时间早于 now 减去图片有效期的图片，返回清理数量
+func (c *Client) SweepExpiredImages(ctx context.Context, now time.Time) (int, error) {
+	max := strconv.FormatInt(now.Add(-imageTTL).UnixMilli(), 10)
+	swept := 0
+	var offset int64
+	for {
+		ids, err := c.ZRangeByScore(ctx, imagesIndexKey, &redis.ZRangeBy{Min: "-inf", Max: max, Offset: offset, Count: 200}).Result()
+		if err != nil {
+			return swept, err
+		}
+		n, err := c.expireImages(ctx, ids)
+		swept += n
+		if err != nil {
+			return swept, err
+		}
+		// 仍然存在的图片留在索引中，下一批跳过它们
+		offset += int64(len(ids) - n)
+		if len(ids) < 200 {
+			return swept, nil
+		}
+	}
+}
+
+// expireImages 对元数据已不存在的图片扣减计数器并清理索引，返回从图片列表索引移除的数量
+func (c *Client) expireImages(ctx context.Context, ids []string) (int, error) {
+	cmds := make([]*redis.Cmd, len(ids))
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			keys := append(uncountImageKeys(), fmt.Sprintf("image:%s", id), imagesIndexKey)
+			cmds[i] = expireImageScript.Eval(ctx, pipe, keys, id)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	removed := 0
+	for i, cmd := range cmds {
+		data, err := cmd.Text()
+		if err == redis.Nil {
+			continue // 元数据仍然存在
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed++
+		if data == "" {
+			continue // 已由删除图片扣减过
+		}
+		var stat imageStat
+		if err := json.Unmarshal([]byte(data), &stat); err != nil {
+			return removed, err
+		}
+		if err := c.removeExpiredImage(ctx, ids[i], &stat); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// removeExpiredImage 清理过期图片留下的索引和审核数据，并归还所属用户或组织的配额用量。
+// 统计信息记录只会被取出一次，因此同一图片的用量只归还一次
+func (c *Client) removeExpiredImage(ctx context.Context, id string, stat *imageStat) error {
+	owner := &model.Image{ID: id, UserID: stat.UserID, OrgID: stat.OrgID}
+	usage := usageKey(stat.UserID)
+	if stat.OrgID != "" {
+		usage = orgUsageKey(stat.OrgID)
+	}
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		releaseScript.Eval(ctx, pipe, []string{usage}, stat.Size)
+		pipe.SRem(ctx, imageOwnerKey(owner), id)
+		pipe.Del(ctx, reportsKey(id), fmt.Sprintf("image:%s:tags", id))
+		pipe.ZRem(ctx, moderationQueueKey, id)
+		pipe.ZRem(ctx, pendingImagesKey, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.RemoveFromLeaderboards(ctx, id)
+}
+
+// TrimDailyStats 删除超过 MaxStatsDays 天的每日上传数和访问数，返回删除的字段数
+func (c *Client) TrimDailyStats(ctx context.Context, now time.Time) (int, error) {
+	cutoff := now.UTC().AddDate(0, 0, -MaxStatsDays).Format(dayLayout)
+	removed := 0
+	for _, key := range []string{statsUploadsKey, statsViewsKey} {
+		days, err := c.HKeys(ctx, key).Result()
+		if err != nil {
+			return removed, err
+		}
+		var old []string
+		for _, day := range days {
+			if day < cutoff {
+				old = append(old, day)
+			}
+		}
+		if len(old) == 0 {
+			continue
+		}
+		if err := c.HDel(ctx, key, old...).Err(); err != nil {
+			return removed, err
+		}
+		removed += len(old)
+	}
+	return removed, nil
+}
+
+// AdminStats 读取全站统计，days 为按天统计的天数（含今天），top 为上传者排行的数量
+func (c *Client) AdminStats(ctx context.Context, days, top int) (*model.AdminStats, error) {
+	now := time.Now().UTC()
+	fields := make([]string, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		fields = append(fields, now.AddDate(0, 0, -i).Format(dayLayout))
+	}
+
+	pipe := c.Pipeline()
+	totals := pipe.HGetAll(ctx, statsTotalsKey)
+	uploads := pipe.HMGet(ctx, statsUploadsKey, fields...)
+	views := pipe.HMGet(ctx, statsViewsKey, fields...)
+	mimeImages := pipe.HGetAll(ctx, statsMimeImagesKey)
+	mimeBytes := pipe.HGetAll(ctx, statsMimeBytesKey)
+	uploaders := pipe.ZRevRangeWithScores(ctx, statsUploadersKey, 0, int64(top-1))
+	rebuilt := pipe.Get(ctx, statsRebuiltKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	stats := &model.AdminStats{
+		UploadsPerDay: dailyCounts(fields, uploads.Val()),
+		ViewsPerDay:   dailyCounts(fields, views.Val()),
+		TopUploaders:  []model.UploaderStat{},
+		StorageByMime: []model.MimeStat{},
+	}
+	stats.Users, _ = strconv.ParseInt(totals.Val()["users"], 10, 64)
+	stats.Images, _ = strconv.ParseInt(totals.Val()["images"], 10, 64)
+	stats.Bytes, _ = strconv.ParseInt(totals.Val()["bytes"], 10, 64)
+	if ts, err := rebuilt.Int64(); err == nil {
+		t := time.Unix(ts, 0)
+		stats.RebuiltAt = &t
+	}
+
+	for mime, n := range mimeImages.Val() {
+		images, _ := strconv.ParseInt(n, 10, 64)
+		bytes, _ := strconv.ParseInt(mimeBytes.Val()[mime], 10, 64)
+		if images > 0 {
+			stats.StorageByMime = append(stats.StorageByMime, model.MimeStat{MimeType: mime, Images: images, Bytes: bytes})
+		}
+	}
+	sort.Slice(stats.StorageByMime, func(i, j int) bool {
+		return stats.StorageByMime[i].Bytes > stats.StorageByMime[j].Bytes
+	})
+
+	for _, z := range uploaders.Val() {
+		if z.Score <= 0 {
+			break
+		}
+		userID := z.Member.(string)
+		stat := model.UploaderStat{UserID: userID, Images: int64(z.Score)}
+		if bytes, err := c.ZScore(ctx, statsUploaderBytesKey, userID).Result(); err == nil {
+			stat.Bytes = int64(bytes)
+		}
+		if user, err := c.GetUser(ctx, userID); err == nil && user != nil {
+			stat.Username = user.Username
+		}
+		stats.TopUploaders = append(stats.TopUploaders, stat)
+	}
+	return stats, nil
+}
+
+func dailyCounts(days []string, values []interface{}) []model.DailyCount {
+	counts := make([]model.DailyCount, len(days))
+	for i, day := range days {
+		t, _ := time.Parse(dayLayout, day)
+		counts[i].Date = t.Format("2006-01-02")
+		if s, ok := values[i].(string); ok {
+			counts[i].Count, _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return counts
+}
+
+// SearchUsers 按用户名顺序分页列出用户，prefix 为不区分大小写的用户名前缀，cursor 为上一页返回的游标；
+// match 不为空时只返回满足条件的用户，返回的游标为空表示没有更多用户
+func (c *Client) SearchUsers(ctx context.Context, prefix, cursor string, limit int, match func(*model.User) bool) ([]*model.User, string, error) {
+	prefix = strings.ToLower(prefix)
+	min, max := "-", "+"
+	if prefix != "" {
+		min, max = "["+prefix, "("+prefix+"\xff"
+	}
+	if cursor != "" {
+		min = "(" + cursor
+	}
+
+	users := []*model.User{}
+	for scanned := 0; scanned < 10000; {
+		members, err := c.ZRangeByLex(ctx, usersIndexKey, &redis.ZRangeBy{Min: min, Max: max, Count: 200}).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		for _, member := range members {
+			scanned++
+			_, id, _ := strings.Cut(member, "\x00")
+			user, err := c.GetUser(ctx, id)
+			if err != nil {
+				return nil, "", err
+			}
+			if user == nil || (match != nil && !match(user)) {
+				continue
+			}
+			users = append(users, user)
+			if len(users) == limit {
+				return users, member, nil
+			}
+		}
+		if len(members) < 200 {
+			return users, "", nil
+		}
+		cursor = members[len(members)-1]
+		min = "(" + cursor
+	}
+	return users, cursor, nil
+}
+
+// EnsureAdminStats 计数器和索引不存在或版本较旧时（升级后首次启动）按实际数据建立，返回是否执行了重建
+func (c *Client) EnsureAdminStats(ctx context.Context) (bool, error) {
+	version, err := c.Get(ctx, statsVersionKey).Int()
+	if err != nil && err != redis.Nil {
+		return false, err
+	}
+	if version >= statsVersion {
+		return false, nil
+	}
+	return true, c.RebuildAdminStats(ctx)
+}
+
+// ErrStatsBusy 重建统计期间数据持续变化，多次重试后仍未能写入结果
+var ErrStatsBusy = errors.New("data changed during stats rebuild")
+
+// RebuildAdminStats 遍历用户和图片重新计算总数、MIME 统计、上传者排行、图片统计信息、用户和组织的配额用量、
+// 用户索引和图片列表索引，修正偏差。
+// 每日上传数只在不存在时按图片上传时间补齐，每日访问数无法从现有数据恢复，均保持不变。
+// 遍历前 WATCH 所有要覆盖的计数器、索引和已有的用量记录，遍历期间的注册、上传、删除和转移都会修改其中的键，
+// 此时放弃本次结果重新遍历，不会覆盖并发写入；重试 maxTxRetries 次仍有冲突时返回 ErrStatsBusy。
+// 重建开始前已占用配额、重建完成后才保存的上传不计入用量，由下次重建修正
+func (c *Client) RebuildAdminStats(ctx context.Context) error {
+	for i := 0; i < maxTxRetries; i++ {
+		err := c.rebuildAdminStats(ctx)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return err
+	}
+	return ErrStatsBusy
+}
+
+// rebuildAdminStats 在 WATCH 下执行一次重建，遍历期间被监视的键发生变化时返回 redis.TxFailedErr
+func (c *Client) rebuildAdminStats(ctx context.Context) error {
+	// 不存在的用量记录只会被上传前的配额占用创建，随后保存图片会修改总数，因此只需监视已有的记录
+	watched := []string{statsTotalsKey, statsMimeImagesKey, statsMimeBytesKey, statsUploadersKey, statsUploaderBytesKey,
+		statsUploadsKey, statsImagesKey, usersIndexKey, imagesIndexKey}
+	for _, pattern := range []string{"user:*:usage", "org:*:usage"} {
+		iter := c.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			watched = append(watched, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	return c.Watch(ctx, func(tx *redis.Tx) error {
+		return c.saveRebuiltStats(ctx, tx)
+	}, watched...)
+}
+
+// saveRebuiltStats 按实际数据计算统计并在 tx 的事务中写入
+func (c *Client) saveRebuiltStats(ctx context.Context, tx *redis.Tx) error {
+	var users int64
+	index := []redis.Z{}
+	// 配额用量：所有用户先置为 0，组织只覆盖已有用量记录或仍有图片的
+	usage := map[string]*model.Usage{}
+	err := c.ScanUsers(ctx, func(user *model.User) bool {
+		users++
+		index = append(index, redis.Z{Member: usersIndexMember(user.Username, user.ID)})
+		usage[usageKey(user.ID)] = &model.Usage{}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	var images, bytes int64
+	mimeImages := map[string]int64{}
+	mimeBytes := map[string]int64{}
+	uploaders := map[string]int64{}
+	uploaderBytes := map[string]int64{}
+	uploads := map[string]int64{}
+	imageIndex := []redis.Z{}
+	imageStats := map[string]interface{}{}
+	iter := c.Scan(ctx, 0, "image:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.Contains(key[len("image:"):], ":") {
+			continue
+		}
+		data, err := c.Get(ctx, key).Bytes()
+		if err != nil {
+			continue // 已过期或不是图片元数据，如 image:views
+		}
+		var img model.Image
+		if err := json.Unmarshal(data, &img); err != nil || img.ID == "" {
+			continue
+		}
+		images++
+		bytes += img.Size
+		mimeImages[img.MimeType]++
+		mimeBytes[img.MimeType] += img.Size
+		uploaders[img.UserID]++
+		uploaderBytes[img.UserID] += img.Size
+		uploads[img.CreatedAt.UTC().Format(dayLayout)]++
+		imageIndex = append(imageIndex, redis.Z{Score: float64(img.CreatedAt.UnixMilli()), Member: img.ID})
+		imageStats[img.ID] = newImageStat(&img)
+		owner := usageKey(img.UserID)
+		if img.OrgID != "" {
+			owner = orgUsageKey(img.OrgID)
+		}
+		if usage[owner] == nil {
+			usage[owner] = &model.Usage{}
+		}
+		usage[owner].Bytes += img.Size
+		usage[owner].Images++
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	orgUsage := c.Scan(ctx, 0, "org:*:usage", 100).Iterator()
+	for orgUsage.Next(ctx) {
+		if usage[orgUsage.Val()] == nil {
+			usage[orgUsage.Val()] = &model.Usage{}
+		}
+	}
+	if err := orgUsage.Err(); err != nil {
+		return err
+	}
+
+	hasUploads, err := c.Exists(ctx, statsUploadsKey).Result()
+	if err != nil {
+		return err
+	}
+	_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, statsMimeImagesKey, statsMimeBytesKey, statsUploadersKey, statsUploaderBytesKey, usersIndexKey, imagesIndexKey, statsImagesKey)
+		pipe.HSet(ctx, statsTotalsKey, "users", users, "images", images, "bytes", bytes)
+		for mime, n := range mimeImages {
+			pipe.HSet(ctx, statsMimeImagesKey, mime, n)
+			pipe.HSet(ctx, statsMimeBytesKey, mime, mimeBytes[mime])
+		}
+		for userID, n := range uploaders {
+			pipe.ZAdd(ctx, statsUploadersKey, redis.Z{Score: float64(n), Member: userID})
+			pipe.ZAdd(ctx, statsUploaderBytesKey, redis.Z{Score: float64(uploaderBytes[userID]), Member: userID})
+		}
+		if hasUploads == 0 {
+			for day, n := range uploads {
+				pipe.HSet(ctx, statsUploadsKey, day, n)
+			}
+		}
+		for key, u := range usage {
+			pipe.HSet(ctx, key, "bytes", u.Bytes, "images", u.Images)
+		}
+		if len(index) > 0 {
+			pipe.ZAdd(ctx, usersIndexKey, index...)
+		}
+		if len(imageIndex) > 0 {
+			pipe.ZAdd(ctx, imagesIndexKey, imageIndex...)
+			pipe.HSet(ctx, statsImagesKey, imageStats)
+		}
+		pipe.Set(ctx, statsRebuiltKey, time.Now().Unix(), 0)
+		pipe.Set(ctx, statsVersionKey, statsVersion, 0)
+		return nil
+	})
+	if err != nil && err != redis.TxFailedErr {
+		return fmt.Errorf("save admin stats: %w", err)
+	}
+	return err
+}
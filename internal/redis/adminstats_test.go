@@ -0,0 +1,268 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestSweepExpiredImages(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	now := time.Now()
+	old := now.Add(-imageTTL - time.Hour)
+	images := []*model.Image{
+		{ID: "expired", UserID: "alice", Size: 100, MimeType: "image/png", CreatedAt: old},
+		{ID: "transferred", UserID: "alice", Size: 40, MimeType: "image/png", CreatedAt: old},
+		{ID: "live", UserID: "alice", Size: 10, MimeType: "image/jpeg", CreatedAt: old},
+		{ID: "recent", UserID: "alice", Size: 1, MimeType: "image/jpeg", CreatedAt: now},
+		{ID: "team", UserID: "alice", OrgID: "org1", Size: 7, MimeType: "image/png", CreatedAt: old},
+	}
+	for _, img := range images {
+		var err error
+		if img.OrgID != "" {
+			err = c.ReserveOrgQuota(ctx, img.OrgID, img.Size, model.Quota{})
+		} else {
+			err = c.ReserveQuota(ctx, img.UserID, img.Size, model.Quota{})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SaveImage(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.TransferImage(ctx, images[1], "bob"); err != nil {
+		t.Fatal(err)
+	}
+	mr.Del("image:expired")
+	mr.Del("image:transferred")
+	mr.Del("image:team")
+
+	swept, err := c.SweepExpiredImages(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swept != 3 {
+		t.Errorf("swept %d, want 3", swept)
+	}
+	// 删除使用过期前读取的图片时不会重复扣减
+	if err := c.DeleteImage(ctx, images[0]); err != nil {
+		t.Fatal(err)
+	}
+	if swept, _ := c.SweepExpiredImages(ctx, now); swept != 0 {
+		t.Errorf("second sweep removed %d, want 0", swept)
+	}
+
+	tests := []struct {
+		name string
+		got  func() string
+		want string
+	}{
+		{"total images", func() string { return mr.HGet(statsTotalsKey, "images") }, "2"},
+		{"total bytes", func() string { return mr.HGet(statsTotalsKey, "bytes") }, "11"},
+		{"png images", func() string { return mr.HGet(statsMimeImagesKey, "image/png") }, "0"},
+		{"png bytes", func() string { return mr.HGet(statsMimeBytesKey, "image/png") }, "0"},
+		{"alice usage bytes", func() string { return mr.HGet(usageKey("alice"), "bytes") }, "11"},
+		{"alice usage images", func() string { return mr.HGet(usageKey("alice"), "images") }, "2"},
+		{"bob usage bytes", func() string { return mr.HGet(usageKey("bob"), "bytes") }, "0"},
+		{"org usage bytes", func() string { return mr.HGet(orgUsageKey("org1"), "bytes") }, "0"},
+		{"org usage images", func() string { return mr.HGet(orgUsageKey("org1"), "images") }, "0"},
+	}
+	for _, tt := range tests {
+		if got := tt.got(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	for user, want := range map[string]float64{"alice": 2, "bob": 0} {
+		if got, _ := mr.ZScore(statsUploadersKey, user); got != want {
+			t.Errorf("uploader %s images = %v, want %v", user, got, want)
+		}
+	}
+	index, _ := mr.ZMembers(imagesIndexKey)
+	if len(index) != 2 {
+		t.Errorf("images index %v, want live and recent", index)
+	}
+	if ok, _ := mr.SIsMember(userImagesKey("bob"), "transferred"); ok {
+		t.Error("expired image still in the new owner's image list")
+	}
+}
+
+func TestTrimDailyStats(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	days := []struct {
+		day      time.Time
+		wantKept bool
+	}{
+		{now, true},
+		{now.AddDate(0, 0, -MaxStatsDays), true},
+		{now.AddDate(0, 0, -MaxStatsDays-1), false},
+		{now.AddDate(-3, 0, 0), false},
+	}
+	for _, d := range days {
+		mr.HSet(statsUploadsKey, d.day.Format(dayLayout), "1")
+		mr.HSet(statsViewsKey, d.day.Format(dayLayout), "1")
+	}
+
+	removed, err := c.TrimDailyStats(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 4 {
+		t.Errorf("removed %d fields, want 4", removed)
+	}
+	for _, d := range days {
+		for _, key := range []string{statsUploadsKey, statsViewsKey} {
+			if kept := mr.HGet(key, d.day.Format(dayLayout)) != ""; kept != d.wantKept {
+				t.Errorf("%s %s kept %v, want %v", key, d.day.Format(dayLayout), kept, d.wantKept)
+			}
+		}
+	}
+}
+
+func TestRebuildAdminStatsRecordsImageStats(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	now := time.Now()
+	img := &model.Image{ID: "img1", UserID: "alice", Size: 100, MimeType: "image/png", CreatedAt: now.Add(-imageTTL - time.Hour)}
+	if err := c.SaveImage(ctx, img); err != nil {
+		t.Fatal(err)
+	}
+	// 升级前的图片没有统计信息
+	mr.Del(statsImagesKey)
+	if err := c.RebuildAdminStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mr.Del("image:img1")
+
+	if swept, err := c.SweepExpiredImages(ctx, now); err != nil || swept != 1 {
+		t.Fatalf("swept %d, %v; want 1", swept, err)
+	}
+	if got := mr.HGet(statsTotalsKey, "images"); got != "0" {
+		t.Errorf("total images = %s, want 0", got)
+	}
+}
+
+func TestRebuildAdminStatsRecomputesUsage(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	for _, u := range []*model.User{{ID: "alice", Username: "alice"}, {ID: "bob", Username: "bob"}} {
+		if err := c.SaveUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	images := []*model.Image{
+		{ID: "a1", UserID: "alice", Size: 100, MimeType: "image/png", CreatedAt: time.Now()},
+		{ID: "a2", UserID: "alice", Size: 20, MimeType: "image/png", CreatedAt: time.Now()},
+		{ID: "o1", UserID: "alice", OrgID: "org1", Size: 5, MimeType: "image/png", CreatedAt: time.Now()},
+	}
+	for _, img := range images {
+		if err := c.SaveImage(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 配额功能之前上传的图片没有用量；bob 和已清空的组织残留了偏差
+	mr.HSet(usageKey("bob"), "bytes", "999", "images", "9")
+	mr.HSet(orgUsageKey("org2"), "bytes", "50", "images", "1")
+
+	if err := c.RebuildAdminStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key    string
+		bytes  string
+		images string
+	}{
+		{usageKey("alice"), "120", "2"},
+		{usageKey("bob"), "0", "0"},
+		{orgUsageKey("org1"), "5", "1"},
+		{orgUsageKey("org2"), "0", "0"},
+	}
+	for _, tt := range tests {
+		if got := mr.HGet(tt.key, "bytes"); got != tt.bytes {
+			t.Errorf("%s bytes = %s, want %s", tt.key, got, tt.bytes)
+		}
+		if got := mr.HGet(tt.key, "images"); got != tt.images {
+			t.Errorf("%s images = %s, want %s", tt.key, got, tt.images)
+		}
+	}
+}
+
+func TestRebuildAdminStatsConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	if err := c.SaveUser(ctx, &model.User{ID: "alice", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重建期间持续上传和删除，重建结果不能覆盖这些写入
+	const n = 150
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			img := &model.Image{ID: fmt.Sprintf("img%d", i), UserID: "alice", Size: 10, MimeType: "image/png", CreatedAt: time.Now()}
+			if err := c.ReserveQuota(ctx, img.UserID, img.Size, model.Quota{}); err != nil {
+				done <- err
+				return
+			}
+			if err := c.SaveImage(ctx, img); err != nil {
+				done <- err
+				return
+			}
+			if i%3 == 0 {
+				if err := c.DeleteImage(ctx, img); err != nil {
+					done <- err
+					return
+				}
+				if err := c.ReleaseQuota(ctx, img.UserID, img.Size); err != nil {
+					done <- err
+					return
+				}
+			}
+		}
+		done <- nil
+	}()
+	for running := true; running; {
+		if err := c.RebuildAdminStats(ctx); err != nil && !errors.Is(err, ErrStatsBusy) {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			running = false
+		default:
+		}
+	}
+
+	live := n - (n+2)/3
+	tests := []struct {
+		name string
+		got  func() string
+		want string
+	}{
+		{"total images", func() string { return mr.HGet(statsTotalsKey, "images") }, fmt.Sprint(live)},
+		{"total bytes", func() string { return mr.HGet(statsTotalsKey, "bytes") }, fmt.Sprint(live * 10)},
+		{"png images", func() string { return mr.HGet(statsMimeImagesKey, "image/png") }, fmt.Sprint(live)},
+		{"usage images", func() string { return mr.HGet(usageKey("alice"), "images") }, fmt.Sprint(live)},
+		{"usage bytes", func() string { return mr.HGet(usageKey("alice"), "bytes") }, fmt.Sprint(live * 10)},
+		{"image stats", func() string { keys, _ := mr.HKeys(statsImagesKey); return fmt.Sprint(len(keys)) }, fmt.Sprint(live)},
+		{"images index", func() string { members, _ := mr.ZMembers(imagesIndexKey); return fmt.Sprint(len(members)) }, fmt.Sprint(live)},
+	}
+	for _, tt := range tests {
+		if got := tt.got(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got, _ := mr.ZScore(statsUploadersKey, "alice"); got != float64(live) {
+		t.Errorf("uploader images = %v, want %d", got, live)
+	}
+}
@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func albumKey(id string) string {
+	return fmt.Sprintf("album:%s", id)
+}
+
+// albumImagesKey 相册中的图片，分数为加入时间
+func albumImagesKey(id string) string {
+	return fmt.Sprintf("album:%s:images", id)
+}
+
+func userAlbumsKey(userID string) string {
+	return fmt.Sprintf("user:%s:albums", userID)
+}
+
+func orgAlbumsKey(orgID string) string {
+	return fmt.Sprintf("org:%s:albums", orgID)
+}
+
+// ownerAlbumsKey 相册所属的个人或组织相册列表
+func ownerAlbumsKey(album *model.Album) string {
+	if album.OrgID != "" {
+		return orgAlbumsKey(album.OrgID)
+	}
+	return userAlbumsKey(album.UserID)
+}
+
+func (c *Client) SaveAlbum(ctx context.Context, album *model.Album) error {
+	data, err := json.Marshal(album)
+	if err != nil {
+		return err
+	}
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, albumKey(album.ID), data, 0)
+		pipe.SAdd(ctx, ownerAlbumsKey(album), album.ID)
+		return nil
+	})
+	return err
+}
+
+func (c *Client) GetAlbum(ctx context.Context, id string) (*model.Album, error) {
+	data, err := c.Get(ctx, albumKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var album model.Album
+	if err := json.Unmarshal(data, &album); err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+// DeleteAlbum 删除相册，相册中的图片保留
+func (c *Client) DeleteAlbum(ctx context.Context, album *model.Album) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, albumKey(album.ID), albumImagesKey(album.ID))
+		pipe.SRem(ctx, ownerAlbumsKey(album), album.ID)
+		return nil
+	})
+	return err
+}
+
+// UserAlbums 返回用户的个人相册
+func (c *Client) UserAlbums(ctx context.Context, userID string) ([]*model.Album, error) {
+	return c.listAlbums(ctx, userAlbumsKey(userID))
+}
+
+// OrgAlbums 返回组织的相册
+func (c *Client) OrgAlbums(ctx context.Context, orgID string) ([]*model.Album, error) {
+	return c.listAlbums(ctx, orgAlbumsKey(orgID))
+}
+
+func (c *Client) listAlbums(ctx context.Context, key string) ([]*model.Album, error) {
+	ids, err := c.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	albums := []*model.Album{}
+	for _, id := range ids {
+		album, err := c.GetAlbum(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if album != nil {
+			albums = append(albums, album)
+		}
+	}
+	return albums, nil
+}
+
+// AddAlbumImages 将图片加入相册，已在相册中的图片保持原有顺序
+func (c *Client) AddAlbumImages(ctx context.Context, albumID string, imageIDs []string) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	now := float64(time.Now().UnixMicro())
+	members := make([]redis.Z, len(imageIDs))
+	for i, id := range imageIDs {
+		members[i] = redis.Z{Score: now + float64(i), Member: id}
+	}
+	return c.ZAddNX(ctx, albumImagesKey(albumID), members...).Err()
+}
+
+// RemoveAlbumImages 将图片移出相册
+func (c *Client) RemoveAlbumImages(ctx context.Context, albumID string, imageIDs ...string) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(imageIDs))
+	for i, id := range imageIDs {
+		members[i] = id
+	}
+	return c.ZRem(ctx, albumImagesKey(albumID), members...).Err()
+}
+
+// AlbumImageIDs 按加入顺序返回相册中的图片 ID
+func (c *Client) AlbumImageIDs(ctx context.Context, albumID string) ([]string, error) {
+	return c.ZRange(ctx, albumImagesKey(albumID), 0, -1).Result()
+}
@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// auditLogKey 审计日志 stream，每个条目的 event 字段为记录的 JSON，只追加不修改
+const auditLogKey = "audit:log"
+
+// AppendAudit 追加一条审计记录并返回条目 ID；retention 大于 0 时近似裁剪早于保留期的条目
+func (c *Client) AppendAudit(ctx context.Context, e *model.AuditEvent, retention time.Duration) (string, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	args := &redis.XAddArgs{
+		Stream: auditLogKey,
+		Values: map[string]interface{}{"event": data},
+	}
+	if retention > 0 {
+		args.MinID = AuditStreamID(e.Time.Add(-retention), false)
+		args.Approx = true
+	}
+	return c.XAdd(ctx, args).Result()
+}
+
+// AuditRange 按条目 ID 范围读取审计记录，start 和 end 均包含在内；reverse 为 true 时从新到旧
+func (c *Client) AuditRange(ctx context.Context, start, end string, count int64, reverse bool) ([]*model.AuditEvent, error) {
+	var msgs []redis.XMessage
+	var err error
+	if reverse {
+		msgs, err = c.XRevRangeN(ctx, auditLogKey, end, start, count).Result()
+	} else {
+		msgs, err = c.XRangeN(ctx, auditLogKey, start, end, count).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*model.AuditEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		var e model.AuditEvent
+		data, _ := msg.Values["event"].(string)
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			continue
+		}
+		e.ID = msg.ID
+		events = append(events, &e)
+	}
+	return events, nil
+}
+
+// AuditStreamID 返回时间对应的 stream ID 边界，end 为 true 时取该毫秒内的最大 ID
+func AuditStreamID(t time.Time, end bool) string {
+	if end {
+		return fmt.Sprintf("%d-%d", t.UnixMilli(), uint64(math.MaxUint64))
+	}
+	return fmt.Sprintf("%d-0", t.UnixMilli())
+}
+
+// AuditNextID 返回紧邻给定条目 ID 之前或之后的 ID，用于分页时排除已读取的条目
+func AuditNextID(id string, before bool) (string, error) {
+	msPart, seqPart, _ := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid stream id %q", id)
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid stream id %q", id)
+	}
+	switch {
+	case !before && seq < math.MaxUint64:
+		seq++
+	case !before:
+		ms, seq = ms+1, 0
+	case seq > 0:
+		seq--
+	case ms > 0:
+		ms, seq = ms-1, math.MaxUint64
+	default:
+		return "", fmt.Errorf("no stream id before %q", id)
+	}
+	return fmt.Sprintf("%d-%d", ms, seq), nil
+}
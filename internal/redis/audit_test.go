@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestAuditStreamID(t *testing.T) {
+	ts := time.UnixMilli(1700000000123).Add(456 * time.Microsecond)
+	if got := AuditStreamID(ts, false); got != "1700000000123-0" {
+		t.Errorf("start id = %s", got)
+	}
+	if got := AuditStreamID(ts, true); got != "1700000000123-18446744073709551615" {
+		t.Errorf("end id = %s", got)
+	}
+}
+
+func TestAuditNextID(t *testing.T) {
+	tests := []struct {
+		id      string
+		before  bool
+		want    string
+		wantErr bool
+	}{
+		{id: "5-3", before: false, want: "5-4"},
+		{id: "5-3", before: true, want: "5-2"},
+		{id: "5-0", before: false, want: "5-1"},
+		{id: "5-0", before: true, want: "4-18446744073709551615"},
+		{id: "5-18446744073709551615", before: false, want: "6-0"},
+		{id: "5-18446744073709551615", before: true, want: "5-18446744073709551614"},
+		{id: "0-1", before: true, want: "0-0"},
+		{id: "0-0", before: true, wantErr: true},
+		{id: "0-0", before: false, want: "0-1"},
+		{id: "abc-1", wantErr: true},
+		{id: "5", wantErr: true},
+		{id: "5-x", wantErr: true},
+		{id: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := AuditNextID(tt.id, tt.before)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("AuditNextID(%q, %v) error = %v, wantErr %v", tt.id, tt.before, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("AuditNextID(%q, %v) = %q, want %q", tt.id, tt.before, got, tt.want)
+		}
+	}
+}
+
+func TestAuditRange(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+	var ids []string
+	for _, action := range []string{"login", "user.role", "image.delete"} {
+		id, err := c.AppendAudit(ctx, &model.AuditEvent{Time: time.Now(), Action: action, Outcome: model.AuditSuccess}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	// 非 JSON 条目被跳过
+	if err := c.XAdd(ctx, &redis.XAddArgs{Stream: auditLogKey, Values: map[string]interface{}{"event": "{"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := c.AuditRange(ctx, "-", "+", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	for i, e := range events {
+		if e.ID != ids[i] || e.Outcome != model.AuditSuccess {
+			t.Errorf("event %d = %+v, want id %s", i, e, ids[i])
+		}
+	}
+	if events[1].Action != "user.role" {
+		t.Errorf("event 1 action = %s", events[1].Action)
+	}
+
+	events, err = c.AuditRange(ctx, ids[1], "+", 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ID != ids[2] || events[1].ID != ids[1] {
+		t.Errorf("reverse range = %v", events)
+	}
+}
@@ -0,0 +1,262 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// 旧版本所有类型共用的队列，其中的任务由 MigrateJobQueues 移到按类型的队列
+	legacyJobQueueKey      = "jobs:queue"
+	legacyJobProcessingKey = "jobs:processing"
+
+	// 完成的任务保留一段时间供查询进度
+	finishedJobTTL = 7 * 24 * time.Hour
+)
+
+// jobQueueKey 某类任务等待执行的队列，每类任务单独排队，耗时的导出不会阻塞删除用户
+func jobQueueKey(jobType string) string {
+	return fmt.Sprintf("jobs:queue:%s", jobType)
+}
+
+// jobProcessingKey 某类任务已被领取的列表
+func jobProcessingKey(jobType string) string {
+	return fmt.Sprintf("jobs:processing:%s", jobType)
+}
+
+func jobKey(id string) string {
+	return fmt.Sprintf("job:%s", id)
+}
+
+func jobLockKey(id string) string {
+	return fmt.Sprintf("job:%s:lock", id)
+}
+
+func (c *Client) SaveJob(ctx context.Context, job *model.Job) error {
+	job.UpdatedAt = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	var ttl time.Duration
+	if job.Status == model.JobDone {
+		ttl = finishedJobTTL
+	}
+	return c.Set(ctx, jobKey(job.ID), data, ttl).Err()
+}
+
+func (c *Client) GetJob(ctx context.Context, id string) (*model.Job, error) {
+	data, err := c.Get(ctx, jobKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job model.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// EnqueueJob 保存任务并加入其类型的队列
+func (c *Client) EnqueueJob(ctx context.Context, job *model.Job) error {
+	if err := c.SaveJob(ctx, job); err != nil {
+		return err
+	}
+	return c.LPush(ctx, jobQueueKey(job.Type), job.ID).Err()
+}
+
+// ClaimJob 从 jobType 类任务的队列中领取一个任务，超时没有任务时返回空字符串
+func (c *Client) ClaimJob(ctx context.Context, jobType string, timeout time.Duration) (string, error) {
+	id, err := c.BLMove(ctx, jobQueueKey(jobType), jobProcessingKey(jobType), "RIGHT", "LEFT", timeout).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return id, err
+}
+
+// ErrJobLockLost 任务锁已过期或被其他实例持有
+var ErrJobLockLost = errors.New("job lock lost")
+
+// extendJobLockScript 锁仍由 ARGV[1] 持有时续期
+// KEYS[1] 任务锁；ARGV[1] 锁令牌；ARGV[2] 有效期（毫秒）
+var extendJobLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseJobScript 锁仍由 ARGV[1] 持有时释放锁并移出处理中列表；
+// 锁已过期时任务可能已被其他实例重新领取，不能移除其处理中记录
+// KEYS[1] 任务锁；KEYS[2] 处理中列表；ARGV[1] 锁令牌；ARGV[2] 任务 ID
+var releaseJobScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('DEL', KEYS[1])
+  redis.call('LREM', KEYS[2], 1, ARGV[2])
+  return 1
+end
+return 0
+`)
+
+// LockJob 加锁后才能执行任务，锁需要在执行期间定期续期。返回的随机令牌用于续期和释放，
+// 其他实例持有锁时返回空字符串
+func (c *Client) LockJob(ctx context.Context, id string, ttl time.Duration) (string, error) {
+	token := uuid.NewString()
+	ok, err := c.SetNX(ctx, jobLockKey(id), token, ttl).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+// ExtendJobLock 续期任务锁，锁已不属于 token 时返回 ErrJobLockLost
+func (c *Client) ExtendJobLock(ctx context.Context, id, token string, ttl time.Duration) error {
+	ok, err := extendJobLockScript.Run(ctx, c, []string{jobLockKey(id)}, token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if ok != 1 {
+		return ErrJobLockLost
+	}
+	return nil
+}
+
+// ReleaseJob 任务结束后释放锁并移出处理中列表，锁已不属于 token 时返回 ErrJobLockLost
+func (c *Client) ReleaseJob(ctx context.Context, jobType, id, token string) error {
+	ok, err := releaseJobScript.Run(ctx, c, []string{jobLockKey(id), jobProcessingKey(jobType)}, token, id).Int()
+	if err != nil {
+		return err
+	}
+	if ok != 1 {
+		return ErrJobLockLost
+	}
+	return nil
+}
+
+// RequeueStaleJobs 将 jobType 类任务中已领取但没有持有锁的任务（执行实例已退出）重新放回队列。
+// 同一任务被重复领取时只有拿到锁的实例会执行，所以这里不需要与领取互斥。
+func (c *Client) RequeueStaleJobs(ctx context.Context, jobType string) (int, error) {
+	ids, err := c.LRange(ctx, jobProcessingKey(jobType), 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	requeued := 0
+	for _, id := range ids {
+		locked, err := c.Exists(ctx, jobLockKey(id)).Result()
+		if err != nil {
+			return requeued, err
+		}
+		if locked == 1 {
+			continue
+		}
+		_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LRem(ctx, jobProcessingKey(jobType), 1, id)
+			pipe.RPush(ctx, jobQueueKey(jobType), id)
+			return nil
+		})
+		if err != nil {
+			return requeued, err
+		}
+		requeued++
+	}
+	return requeued, nil
+}
+
+// MigrateJobQueues 把旧版本共用队列中等待的任务和已领取但没有持有锁的任务按类型移到各自的队列，
+// 保持原有的先后顺序；仍被旧版本实例执行的任务留在原处，释放后由下一次迁移处理。返回移动的任务数
+func (c *Client) MigrateJobQueues(ctx context.Context) (int, error) {
+	moved := 0
+	// 队列从右端领取，从左到右依次放到新队列右端后，最早的任务仍最先被领取；已领取的任务比等待中的更早，最后放入
+	for _, key := range []string{legacyJobQueueKey, legacyJobProcessingKey} {
+		ids, err := c.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return moved, err
+		}
+		for _, id := range ids {
+			if key == legacyJobProcessingKey {
+				locked, err := c.Exists(ctx, jobLockKey(id)).Result()
+				if err != nil {
+					return moved, err
+				}
+				if locked == 1 {
+					continue
+				}
+			}
+			job, err := c.GetJob(ctx, id)
+			if err != nil {
+				return moved, err
+			}
+			_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.LRem(ctx, key, 1, id)
+				if job != nil {
+					pipe.RPush(ctx, jobQueueKey(job.Type), id)
+				}
+				return nil
+			})
+			if err != nil {
+				return moved, err
+			}
+			if job != nil {
+				moved++
+			}
+		}
+	}
+	return moved, nil
+}
+
+// DiscardClaim 放弃重复领取的任务（其他实例正在执行），不影响其持有的锁
+func (c *Client) DiscardClaim(ctx context.Context, jobType, id string) error {
+	return c.LRem(ctx, jobProcessingKey(jobType), 1, id).Err()
+}
+
+func exportTokenKey(token string) string {
+	return fmt.Sprintf("export:download:%s", token)
+}
+
+func activeExportKey(userID string) string {
+	return fmt.Sprintf("user:%s:export", userID)
+}
+
+// SaveExportToken 保存导出压缩包的下载令牌
+func (c *Client) SaveExportToken(ctx context.Context, token, jobID string, ttl time.Duration) error {
+	return c.Set(ctx, exportTokenKey(token), jobID, ttl).Err()
+}
+
+// GetExportJobID 返回下载令牌对应的导出任务，令牌无效或过期时返回空字符串
+func (c *Client) GetExportJobID(ctx context.Context, token string) (string, error) {
+	id, err := c.Get(ctx, exportTokenKey(token)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return id, err
+}
+
+// StartExport 记录用户正在进行的导出任务，已有任务时返回其 ID 和 false
+func (c *Client) StartExport(ctx context.Context, userID, jobID string, ttl time.Duration) (string, bool, error) {
+	ok, err := c.SetNX(ctx, activeExportKey(userID), jobID, ttl).Result()
+	if err != nil || ok {
+		return jobID, ok, err
+	}
+	current, err := c.Get(ctx, activeExportKey(userID)).Result()
+	if err == redis.Nil {
+		// 刚好结束，允许调用方重试
+		return "", false, nil
+	}
+	return current, false, err
+}
+
+// FinishExport 导出结束后允许用户发起新的导出
+func (c *Client) FinishExport(ctx context.Context, userID, jobID string) error {
+	return deleteIfOwnerScript.Run(ctx, c, []string{activeExportKey(userID)}, jobID).Err()
+}
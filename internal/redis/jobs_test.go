@@ -0,0 +1,159 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestJobLock(t *testing.T) {
+	tests := []struct {
+		name string
+		// takenOver 锁过期后任务被其他实例重新领取并加锁
+		takenOver   bool
+		wantErr     error
+		wantHeldBy  string // 释放后锁的持有者，"other" 表示其他实例，空表示已释放
+		wantClaimed bool   // 释放后处理中列表是否仍有该任务
+	}{
+		{"owner extends and releases", false, nil, "", false},
+		{"expired lock taken by another instance", true, ErrJobLockLost, "other", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, mr := newTestClient(t)
+			mr.Lpush(jobProcessingKey(model.JobExport), "job1")
+			token, err := c.LockJob(ctx, "job1", time.Minute)
+			if err != nil || token == "" {
+				t.Fatalf("LockJob() = %q, %v", token, err)
+			}
+			if again, _ := c.LockJob(ctx, "job1", time.Minute); again != "" {
+				t.Fatal("second lock succeeded while held")
+			}
+
+			var other string
+			if tt.takenOver {
+				mr.FastForward(2 * time.Minute)
+				if other, err = c.LockJob(ctx, "job1", time.Minute); err != nil || other == "" {
+					t.Fatalf("other instance lock: %q, %v", other, err)
+				}
+			}
+
+			if err := c.ExtendJobLock(ctx, "job1", token, time.Minute); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExtendJobLock() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := c.ReleaseJob(ctx, model.JobExport, "job1", token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReleaseJob() error = %v, want %v", err, tt.wantErr)
+			}
+
+			holder, _ := mr.Get(jobLockKey("job1"))
+			if want := map[string]string{"": "", "other": other}[tt.wantHeldBy]; holder != want {
+				t.Errorf("lock holder = %q, want %q", holder, want)
+			}
+			claimed, _ := mr.List(jobProcessingKey(model.JobExport))
+			if (len(claimed) == 1) != tt.wantClaimed {
+				t.Errorf("processing list = %v, want claimed %v", claimed, tt.wantClaimed)
+			}
+		})
+	}
+}
+
+func TestClaimJobByType(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestClient(t)
+	jobs := []*model.Job{
+		{ID: "export1", Type: model.JobExport},
+		{ID: "delete1", Type: model.JobDeleteUser},
+		{ID: "export2", Type: model.JobExport},
+	}
+	for _, job := range jobs {
+		if err := c.EnqueueJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 排队中的导出不影响删除用户任务的领取
+	tests := []struct {
+		jobType string
+		want    string
+	}{
+		{model.JobDeleteUser, "delete1"},
+		{model.JobDeleteUser, ""},
+		{model.JobExport, "export1"},
+		{model.JobExport, "export2"},
+		{model.JobExport, ""},
+	}
+	for _, tt := range tests {
+		id, err := c.ClaimJob(ctx, tt.jobType, 10*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != tt.want {
+			t.Errorf("ClaimJob(%s) = %q, want %q", tt.jobType, id, tt.want)
+		}
+	}
+}
+
+func TestMigrateJobQueues(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	jobs := []*model.Job{
+		{ID: "claimed", Type: model.JobExport},
+		{ID: "running", Type: model.JobDeleteUser},
+		{ID: "old", Type: model.JobExport},
+		{ID: "newer", Type: model.JobDeleteUser},
+		{ID: "newest", Type: model.JobExport},
+	}
+	for _, job := range jobs {
+		if err := c.SaveJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 旧版本的共用队列：左端为最新；running 仍被旧版本实例执行
+	mr.Lpush(legacyJobProcessingKey, "running")
+	mr.Lpush(legacyJobProcessingKey, "claimed")
+	mr.Lpush(legacyJobQueueKey, "old")
+	mr.Lpush(legacyJobQueueKey, "newer")
+	mr.Lpush(legacyJobQueueKey, "missing")
+	mr.Lpush(legacyJobQueueKey, "newest")
+	if _, err := c.LockJob(ctx, "running", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// 升级后新排队的任务排在迁移的任务之后
+	if err := c.EnqueueJob(ctx, &model.Job{ID: "upgraded", Type: model.JobExport}); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := c.MigrateJobQueues(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 4 {
+		t.Errorf("moved %d jobs, want 4", moved)
+	}
+	if queue, _ := mr.List(legacyJobQueueKey); len(queue) != 0 {
+		t.Errorf("legacy queue = %v, want empty", queue)
+	}
+	if processing, _ := mr.List(legacyJobProcessingKey); len(processing) != 1 || processing[0] != "running" {
+		t.Errorf("legacy processing = %v, want [running]", processing)
+	}
+
+	claimOrder := map[string][]string{
+		model.JobExport:     {"claimed", "old", "newest", "upgraded"},
+		model.JobDeleteUser: {"newer"},
+	}
+	for jobType, want := range claimOrder {
+		for _, id := range want {
+			got, err := c.ClaimJob(ctx, jobType, 10*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != id {
+				t.Errorf("ClaimJob(%s) = %q, want %q", jobType, got, id)
+			}
+		}
+	}
+}
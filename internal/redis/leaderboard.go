@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 排行榜时间窗口
+const (
+	WindowDay      = "day"
+	WindowWeek     = "week"
+	WindowAll      = "all"
+	WindowTrending = "trending"
+)
+
+const (
+	viewsAllKey      = "image:views"
+	viewsWeekKey     = "image:views:week"
+	viewsTrendingKey = "image:trending"
+	viewsDayPrefix   = "image:views:day:"
+	dayLayout        = "20060102"
+	// viewsDaysKey 现有访问天桶键的集合，删除图片时据此从每个天桶移除
+	viewsDaysKey = "image:views:days"
+)
+
+func dayKey(t time.Time) string {
+	return viewsDayPrefix + t.UTC().Format(dayLayout)
+}
+
+// LeaderboardKey 返回时间窗口对应的有序集合键
+func LeaderboardKey(window string, now time.Time) (string, error) {
+	switch window {
+	case WindowDay:
+		return dayKey(now), nil
+	case WindowWeek:
+		return viewsWeekKey, nil
+	case WindowAll, "":
+		return viewsAllKey, nil
+	case WindowTrending:
+		return viewsTrendingKey, nil
+	}
+	return "", fmt.Errorf("unknown window: %s", window)
+}
+
+// RollupLeaderboards 按天桶重新计算周榜和带时间衰减的热度榜
+func (c *Client) RollupLeaderboards(ctx context.Context, now time.Time, retentionDays int, halfLife time.Duration) error {
+	week := make([]string, 0, 7)
+	for i := 0; i < 7; i++ {
+		week = append(week, dayKey(now.AddDate(0, 0, -i)))
+	}
+
+	// 热度 = Σ 当天访问量 × 0.5^(天数 / 半衰期)
+	trendKeys := make([]string, 0, retentionDays)
+	weights := make([]float64, 0, retentionDays)
+	for i := 0; i < retentionDays; i++ {
+		age := time.Duration(i) * 24 * time.Hour
+		trendKeys = append(trendKeys, dayKey(now.AddDate(0, 0, -i)))
+		weights = append(weights, math.Pow(0.5, float64(age)/float64(halfLife)))
+	}
+
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(ctx, viewsWeekKey, &redis.ZStore{Keys: week, Aggregate: "SUM"})
+		pipe.ZUnionStore(ctx, viewsTrendingKey, &redis.ZStore{Keys: trendKeys, Weights: weights, Aggregate: "SUM"})
+		return nil
+	})
+	return err
+}
+
+// CleanupViewBuckets 删除超过保留期的天桶，返回删除数量；同时校正天桶键集合，
+// 补上升级前已有的天桶并移除已过期的天桶
+func (c *Client) CleanupViewBuckets(ctx context.Context, now time.Time, retentionDays int) (int, error) {
+	cutoff := now.UTC().AddDate(0, 0, -retentionDays).Format(dayLayout)
+	removed := 0
+	live := map[string]bool{}
+	iter := c.Scan(ctx, 0, viewsDayPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		day := strings.TrimPrefix(key, viewsDayPrefix)
+		if len(day) != len(dayLayout) {
+			continue
+		}
+		if day >= cutoff {
+			live[key] = true
+			continue
+		}
+		if err := c.Del(ctx, key).Err(); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	if err := iter.Err(); err != nil {
+		return removed, err
+	}
+
+	known, err := c.SMembers(ctx, viewsDaysKey).Result()
+	if err != nil {
+		return removed, err
+	}
+	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range known {
+			if !live[key] {
+				pipe.SRem(ctx, viewsDaysKey, key)
+			}
+		}
+		for key := range live {
+			pipe.SAdd(ctx, viewsDaysKey, key)
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// RemoveFromLeaderboards 图片删除后从汇总榜单和全部访问天桶中移除，避免汇总时重新计入周榜和热度榜
+func (c *Client) RemoveFromLeaderboards(ctx context.Context, imageID string) error {
+	days, err := c.SMembers(ctx, viewsDaysKey).Result()
+	if err != nil {
+		return err
+	}
+	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range append([]string{viewsAllKey, viewsWeekKey, viewsTrendingKey, dayKey(time.Now())}, days...) {
+			pipe.ZRem(ctx, key, imageID)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRemoveFromLeaderboardsClearsDayBuckets(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	// 模拟过去几天的访问，包括升级前未登记的天桶
+	for i := 0; i < 3; i++ {
+		day := dayKey(now.AddDate(0, 0, -i))
+		c.ZIncrBy(ctx, day, 5, "gone")
+		c.ZIncrBy(ctx, day, 1, "kept")
+		if i < 2 {
+			c.SAdd(ctx, viewsDaysKey, day)
+		}
+	}
+	if _, err := c.CleanupViewBuckets(ctx, now, 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveFromLeaderboards(ctx, "gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RollupLeaderboards(ctx, now, 30, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{viewsWeekKey, viewsTrendingKey} {
+		if _, err := c.ZScore(ctx, key, "gone").Result(); err != redis.Nil {
+			t.Errorf("%s: deleted image still ranked (err=%v)", key, err)
+		}
+		if _, err := c.ZScore(ctx, key, "kept").Result(); err != nil {
+			t.Errorf("%s: live image missing: %v", key, err)
+		}
+	}
+}
+
+func TestCleanupViewBuckets(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := []struct {
+		age     int
+		removed bool
+	}{
+		{0, false},
+		{6, false},
+		{7, false},
+		{8, true},
+		{40, true},
+	}
+	for _, tt := range tests {
+		day := dayKey(now.AddDate(0, 0, -tt.age))
+		c.ZIncrBy(ctx, day, 1, "img")
+		c.SAdd(ctx, viewsDaysKey, day)
+	}
+	removed, err := c.CleanupViewBuckets(ctx, now, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	for _, tt := range tests {
+		day := dayKey(now.AddDate(0, 0, -tt.age))
+		exists := c.Exists(ctx, day).Val() == 1
+		registered := c.SIsMember(ctx, viewsDaysKey, day).Val()
+		if exists == tt.removed || registered == tt.removed {
+			t.Errorf("age %d: exists=%v registered=%v, want removed=%v", tt.age, exists, registered, tt.removed)
+		}
+	}
+}
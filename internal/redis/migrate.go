@@ -0,0 +1,225 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	userIDsMigratedKey  = "migrate:user_ids:done"
+	userIDsMigrationTTL = 10 * time.Minute
+	// migrationWaitInterval 其他实例正在迁移时检查是否完成的间隔
+	migrationWaitInterval = time.Second
+)
+
+// migratedIDKey 记录旧 ID 对应的新 ID，迁移中断后重新执行时复用
+func migratedIDKey(oldID string) string {
+	return fmt.Sprintf("migrate:user_id:%s", oldID)
+}
+
+// MigrateUserIDs 将以用户名为 ID 的旧用户迁移为 UUID，并建立用户名索引。
+// 同时迁移配额、用量、图片归属、待审核队列、邮箱索引和 OIDC 关联；旧会话直接删除。
+// 迁移完成后写入标记，之后启动时直接跳过，可以重复执行。其他实例正在迁移时等待其完成，
+// 避免在迁移完成前使用旧数据提供服务
+func (c *Client) MigrateUserIDs(ctx context.Context) (int, error) {
+	for {
+		done, err := c.Exists(ctx, userIDsMigratedKey).Result()
+		if err != nil || done == 1 {
+			return 0, err
+		}
+		locked, err := c.SetNX(ctx, userIDsMigratedKey+":lock", 1, userIDsMigrationTTL).Result()
+		if err != nil {
+			return 0, err
+		}
+		if locked {
+			break
+		}
+		slog.Warn("User ID migration is running on another instance, waiting")
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(migrationWaitInterval):
+		}
+	}
+	defer c.Del(ctx, userIDsMigratedKey+":lock")
+
+	var legacy []*model.User
+	err := c.ScanUsers(ctx, func(user *model.User) bool {
+		if _, err := uuid.Parse(user.ID); err != nil {
+			legacy = append(legacy, user)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, user := range legacy {
+		oldID := user.ID
+		if err := c.migrateUser(ctx, user); err != nil {
+			return 0, fmt.Errorf("migrate user %s: %w", oldID, err)
+		}
+	}
+
+	// 包括上次中断前已迁移、但图片归属和 OIDC 关联尚未更新的用户
+	ids, err := c.migratedIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) > 0 {
+		if err := c.migrateImageOwners(ctx, ids); err != nil {
+			return 0, err
+		}
+		if err := c.migrateExternalLinks(ctx, ids); err != nil {
+			return 0, err
+		}
+		// 全部引用更新后才删除旧 ID 到新 ID 的映射
+		keys := make([]string, 0, len(ids))
+		for oldID := range ids {
+			keys = append(keys, migratedIDKey(oldID))
+		}
+		if err := c.Del(ctx, keys...).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), c.Set(ctx, userIDsMigratedKey, time.Now().Unix(), 0).Err()
+}
+
+// migratedIDs 读取全部旧 ID 到新 ID 的映射
+func (c *Client) migratedIDs(ctx context.Context) (map[string]string, error) {
+	ids := map[string]string{}
+	iter := c.Scan(ctx, 0, migratedIDKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		newID, err := c.Get(ctx, iter.Val()).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids[strings.TrimPrefix(iter.Val(), migratedIDKey(""))] = newID
+	}
+	return ids, iter.Err()
+}
+
+// migrateUser 把用户和附属数据移到新 ID 下
+func (c *Client) migrateUser(ctx context.Context, user *model.User) error {
+	oldID := user.ID
+	newID, err := c.Get(ctx, migratedIDKey(oldID)).Result()
+	if err == redis.Nil {
+		newID = uuid.NewString()
+		err = c.Set(ctx, migratedIDKey(oldID), newID, 0).Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	user.ID = newID
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	if err := c.Set(ctx, userKey(newID), data, 0).Err(); err != nil {
+		return err
+	}
+	if err := c.Set(ctx, usernameKey(user.Username), newID, 0).Err(); err != nil {
+		return err
+	}
+
+	// 用户附属数据改名，保留原有过期时间
+	for _, key := range []func(string) string{usageKey, quotaKey, userImagesKey} {
+		if n, err := c.Exists(ctx, key(oldID)).Result(); err != nil {
+			return err
+		} else if n == 1 {
+			if err := c.Rename(ctx, key(oldID), key(newID)).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if user.Email != "" {
+		if owner, _ := c.Get(ctx, EmailKey(user.Email)).Result(); owner == oldID {
+			if err := c.Set(ctx, EmailKey(user.Email), newID, 0).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	score, err := c.ZScore(ctx, pendingUsersKey, oldID).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err == nil {
+		if err := c.ZAdd(ctx, pendingUsersKey, redis.Z{Score: score, Member: newID}).Err(); err != nil {
+			return err
+		}
+		if err := c.ZRem(ctx, pendingUsersKey, oldID).Err(); err != nil {
+			return err
+		}
+	}
+	if _, err := c.DeleteUserSessions(ctx, oldID); err != nil {
+		return err
+	}
+
+	// 保留 migratedIDKey，图片归属和 OIDC 关联更新完成后再删除
+	if err := c.Del(ctx, userKey(oldID)).Err(); err != nil {
+		return err
+	}
+	slog.Info("Migrated user ID", "username", user.Username, "old_id", oldID, "new_id", newID)
+	return nil
+}
+
+// migrateImageOwners 更新图片元数据中的上传用户 ID
+func (c *Client) migrateImageOwners(ctx context.Context, ids map[string]string) error {
+	iter := c.Scan(ctx, 0, "image:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		if strings.Contains(key[len("image:"):], ":") {
+			continue
+		}
+		data, err := c.Get(ctx, key).Bytes()
+		if err != nil {
+			continue
+		}
+		var img model.Image
+		if err := json.Unmarshal(data, &img); err != nil {
+			continue
+		}
+		newID, ok := ids[img.UserID]
+		if !ok {
+			continue
+		}
+		img.UserID = newID
+		if data, err = json.Marshal(img); err != nil {
+			return err
+		}
+		if err := c.SetArgs(ctx, key, data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err(); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// migrateExternalLinks 更新 OIDC 身份关联
+func (c *Client) migrateExternalLinks(ctx context.Context, ids map[string]string) error {
+	iter := c.Scan(ctx, 0, "oidc:link:*", 100).Iterator()
+	for iter.Next(ctx) {
+		oldID, err := c.Get(ctx, iter.Val()).Result()
+		if err != nil {
+			continue
+		}
+		if newID, ok := ids[oldID]; ok {
+			if err := c.Set(ctx, iter.Val(), newID, 0).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Err()
+}
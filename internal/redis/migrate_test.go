@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// testExternalLink 旧用户的 OIDC 关联
+const testExternalLink = "oidc:link:https://idp.example.com|sub-1"
+
+// seedLegacyUser 写入旧版本以用户名为 ID 的用户 alice 及其附属数据
+func seedLegacyUser(t *testing.T, mr *miniredis.Miniredis) {
+	t.Helper()
+	user, _ := json.Marshal(model.User{ID: "alice", Username: "alice", Email: "alice@example.com", EmailVerified: true})
+	img, _ := json.Marshal(model.Image{ID: "img1", UserID: "alice"})
+	mr.Set(userKey("alice"), string(user))
+	mr.Set(usernameKey("alice"), "alice")
+	mr.Set(EmailKey("alice@example.com"), "alice")
+	mr.Set(usageKey("alice"), "1")
+	mr.SAdd(userImagesKey("alice"), "img1")
+	mr.Set("image:img1", string(img))
+	mr.ZAdd(pendingUsersKey, 1, "alice")
+	mr.Set(testExternalLink, "alice")
+}
+
+// imageOwner 读取图片元数据中的上传用户 ID
+func imageOwner(t *testing.T, mr *miniredis.Miniredis) string {
+	t.Helper()
+	data, err := mr.Get("image:img1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var img model.Image
+	json.Unmarshal([]byte(data), &img)
+	return img.UserID
+}
+
+func TestMigrateUserIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		// interrupted 模拟上次迁移在用户迁移后、更新图片归属前中断
+		interrupted bool
+	}{
+		{"fresh migration", false},
+		{"resume after interruption", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, mr := newTestClient(t)
+			seedLegacyUser(t, mr)
+			if tt.interrupted {
+				user, _ := c.GetUser(ctx, "alice")
+				if err := c.migrateUser(ctx, user); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := c.MigrateUserIDs(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			newID, _ := mr.Get(usernameKey("alice"))
+			if _, err := uuid.Parse(newID); err != nil {
+				t.Fatalf("username index = %q, want a UUID", newID)
+			}
+			if mr.Exists(userKey("alice")) || !mr.Exists(userKey(newID)) {
+				t.Error("user record not moved")
+			}
+			if owner := imageOwner(t, mr); owner != newID {
+				t.Errorf("image owner = %q, want %q", owner, newID)
+			}
+			if ok, _ := mr.SIsMember(userImagesKey(newID), "img1"); !ok {
+				t.Error("image list not moved")
+			}
+			if v, _ := mr.Get(usageKey(newID)); v != "1" {
+				t.Error("usage not moved")
+			}
+			if v, _ := mr.Get(EmailKey("alice@example.com")); v != newID {
+				t.Errorf("email index = %q", v)
+			}
+			if v, _ := mr.Get(testExternalLink); v != newID {
+				t.Errorf("external link = %q", v)
+			}
+			if members, _ := mr.ZMembers(pendingUsersKey); len(members) != 1 || members[0] != newID {
+				t.Errorf("pending users = %v", members)
+			}
+			if mr.Exists(migratedIDKey("alice")) {
+				t.Error("ID mapping kept after migration")
+			}
+			if !mr.Exists(userIDsMigratedKey) {
+				t.Error("done flag not set")
+			}
+		})
+	}
+}
+
+func TestMigrateUserIDsWaitsForOtherInstance(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	seedLegacyUser(t, mr)
+	// 其他实例持有迁移锁，稍后完成迁移
+	mr.Set(userIDsMigratedKey+":lock", "1")
+	go func() {
+		time.Sleep(migrationWaitInterval / 2)
+		mr.Set(userIDsMigratedKey, "1")
+		mr.Del(userIDsMigratedKey + ":lock")
+	}()
+
+	start := time.Now()
+	if _, err := c.MigrateUserIDs(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < migrationWaitInterval/2 {
+		t.Error("returned before the other instance finished")
+	}
+	// 迁移由其他实例完成，本实例不再重复执行
+	if v, _ := mr.Get(usernameKey("alice")); v != "alice" {
+		t.Errorf("migrated again: username index = %q", v)
+	}
+}
+
+func TestMigrateUserIDsCanceledWhileWaiting(t *testing.T) {
+	c, mr := newTestClient(t)
+	mr.Set(userIDsMigratedKey+":lock", "1")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.MigrateUserIDs(ctx); err == nil {
+		t.Fatal("want an error while the migration lock is held")
+	}
+}
@@ -0,0 +1,191 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func orgKey(id string) string {
+	return fmt.Sprintf("org:%s", id)
+}
+
+// orgMembersKey 组织成员哈希，字段为用户 ID，值为角色
+func orgMembersKey(id string) string {
+	return fmt.Sprintf("org:%s:members", id)
+}
+
+func orgImagesKey(id string) string {
+	return fmt.Sprintf("org:%s:images", id)
+}
+
+// userOrgsKey 用户加入的组织集合
+func userOrgsKey(userID string) string {
+	return fmt.Sprintf("user:%s:orgs", userID)
+}
+
+// CreateOrg 保存组织并将创建者设为所有者
+func (c *Client) CreateOrg(ctx context.Context, org *model.Org) error {
+	data, err := json.Marshal(org)
+	if err != nil {
+		return err
+	}
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, orgKey(org.ID), data, 0)
+		pipe.HSet(ctx, orgMembersKey(org.ID), org.CreatedBy, string(model.OrgOwner))
+		pipe.SAdd(ctx, userOrgsKey(org.CreatedBy), org.ID)
+		return nil
+	})
+	return err
+}
+
+func (c *Client) GetOrg(ctx context.Context, id string) (*model.Org, error) {
+	data, err := c.Get(ctx, orgKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var org model.Org
+	if err := json.Unmarshal(data, &org); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// DeleteOrg 删除组织、成员关系、相册和配额，调用方需先确认组织名下没有图片
+func (c *Client) DeleteOrg(ctx context.Context, id string) error {
+	members, err := c.OrgMembers(ctx, id)
+	if err != nil {
+		return err
+	}
+	albums, err := c.SMembers(ctx, orgAlbumsKey(id)).Result()
+	if err != nil {
+		return err
+	}
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for userID := range members {
+			pipe.SRem(ctx, userOrgsKey(userID), id)
+		}
+		for _, albumID := range albums {
+			pipe.Del(ctx, albumKey(albumID), albumImagesKey(albumID))
+		}
+		pipe.Del(ctx, orgKey(id), orgMembersKey(id), orgImagesKey(id), orgAlbumsKey(id), orgUsageKey(id), orgQuotaKey(id))
+		return nil
+	})
+	return err
+}
+
+// SetOrgMember 添加成员或修改成员角色
+func (c *Client) SetOrgMember(ctx context.Context, orgID, userID string, role model.OrgRole) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, orgMembersKey(orgID), userID, string(role))
+		pipe.SAdd(ctx, userOrgsKey(userID), orgID)
+		return nil
+	})
+	return err
+}
+
+// RemoveOrgMember 移除成员，成员不存在时返回 false
+func (c *Client) RemoveOrgMember(ctx context.Context, orgID, userID string) (bool, error) {
+	var removed *redis.IntCmd
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.HDel(ctx, orgMembersKey(orgID), userID)
+		pipe.SRem(ctx, userOrgsKey(userID), orgID)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return removed.Val() == 1, nil
+}
+
+// OrgMembers 返回组织成员 ID 及其角色
+func (c *Client) OrgMembers(ctx context.Context, orgID string) (map[string]model.OrgRole, error) {
+	fields, err := c.HGetAll(ctx, orgMembersKey(orgID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]model.OrgRole, len(fields))
+	for userID, role := range fields {
+		members[userID] = model.OrgRole(role)
+	}
+	return members, nil
+}
+
+// OrgRole 返回用户在组织中的角色，不是成员时返回空
+func (c *Client) OrgRole(ctx context.Context, orgID, userID string) (model.OrgRole, error) {
+	role, err := c.HGet(ctx, orgMembersKey(orgID), userID).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return model.OrgRole(role), err
+}
+
+// UserOrgs 返回用户加入的组织 ID 及其角色
+func (c *Client) UserOrgs(ctx context.Context, userID string) (map[string]model.OrgRole, error) {
+	ids, err := c.SMembers(ctx, userOrgsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.StringCmd, len(ids))
+	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGet(ctx, orgMembersKey(id), userID)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	orgs := make(map[string]model.OrgRole, len(ids))
+	for i, id := range ids {
+		if role, err := cmds[i].Result(); err == nil {
+			orgs[id] = model.OrgRole(role)
+		}
+	}
+	return orgs, nil
+}
+
+// OrgImageIDs 返回组织名下的图片 ID
+func (c *Client) OrgImageIDs(ctx context.Context, orgID string) ([]string, error) {
+	return c.SMembers(ctx, orgImagesKey(orgID)).Result()
+}
+
+// CountOrgImages 返回组织名下仍然存在的图片数量，同时移除元数据已过期的图片 ID
+func (c *Client) CountOrgImages(ctx context.Context, orgID string) (int64, error) {
+	ids, err := c.OrgImageIDs(ctx, orgID)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	exists := make([]*redis.IntCmd, len(ids))
+	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			exists[i] = pipe.Exists(ctx, fmt.Sprintf("image:%s", id))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	var live int64
+	var dead []interface{}
+	for i, cmd := range exists {
+		if cmd.Val() == 1 {
+			live++
+		} else {
+			dead = append(dead, ids[i])
+		}
+	}
+	if len(dead) > 0 {
+		if err := c.SRem(ctx, orgImagesKey(orgID), dead...).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return live, nil
+}
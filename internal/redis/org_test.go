@@ -0,0 +1,86 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestCountOrgImagesPrunesExpired(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestClient(t)
+	for _, id := range []string{"img1", "img2"} {
+		img := &model.Image{ID: id, UserID: "alice", OrgID: "org1", Size: 10, CreatedAt: time.Now()}
+		if err := c.SaveImage(ctx, img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mr.Del("image:img2")
+
+	n, err := c.CountOrgImages(ctx, "org1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("count %d, want 1", n)
+	}
+	if ok, _ := mr.SIsMember(orgImagesKey("org1"), "img2"); ok {
+		t.Error("expired image still in org index")
+	}
+}
+
+func TestPurgeUserKeepsOrgOwner(t *testing.T) {
+	tests := []struct {
+		name       string
+		members    map[string]model.OrgRole
+		images     bool
+		wantOwner  string // 为空表示组织被删除
+		wantExists bool
+	}{
+		{"promotes highest role", map[string]model.OrgRole{"alice": model.OrgOwner, "bob": model.OrgViewer, "carol": model.OrgEditor}, false, "carol", true},
+		{"ties broken by id", map[string]model.OrgRole{"alice": model.OrgOwner, "dave": model.OrgEditor, "bob": model.OrgEditor}, false, "bob", true},
+		{"keeps other owner", map[string]model.OrgRole{"alice": model.OrgOwner, "bob": model.OrgOwner, "carol": model.OrgEditor}, false, "bob", true},
+		{"deletes empty org", map[string]model.OrgRole{"alice": model.OrgOwner}, false, "", false},
+		{"keeps empty org with images", map[string]model.OrgRole{"alice": model.OrgOwner}, true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, _ := newTestClient(t)
+			if err := c.CreateOrg(ctx, &model.Org{ID: "org1", Name: "team", CreatedBy: "alice", CreatedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			for id, role := range tt.members {
+				if err := c.SetOrgMember(ctx, "org1", id, role); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.images {
+				img := &model.Image{ID: "img1", UserID: "alice", OrgID: "org1", Size: 10, CreatedAt: time.Now()}
+				if err := c.SaveImage(ctx, img); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := c.purgeUserOrgs(ctx, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			org, err := c.GetOrg(ctx, "org1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists := org != nil; exists != tt.wantExists {
+				t.Fatalf("org exists %v, want %v", exists, tt.wantExists)
+			}
+			members, _ := c.OrgMembers(ctx, "org1")
+			if _, ok := members["alice"]; ok {
+				t.Error("departed user still a member")
+			}
+			if tt.wantOwner != "" && members[tt.wantOwner] != model.OrgOwner {
+				t.Errorf("members %v, want %s as owner", members, tt.wantOwner)
+			}
+		})
+	}
+}
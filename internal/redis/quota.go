@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrQuotaExceeded 上传超出存储配额
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// reserveScript 原子地检查并占用配额
+// KEYS[1] 用量哈希；ARGV: 字节数、字节上限、数量上限（0 表示不限制）
+var reserveScript = redis.NewScript(`
+local bytes = tonumber(redis.call('HGET', KEYS[1], 'bytes') or '0')
+local images = tonumber(redis.call('HGET', KEYS[1], 'images') or '0')
+local size = tonumber(ARGV[1])
+local maxBytes = tonumber(ARGV[2])
+local maxImages = tonumber(ARGV[3])
+if maxBytes > 0 and bytes + size > maxBytes then
+	return 0
+end
+if maxImages > 0 and images + 1 > maxImages then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], 'bytes', size)
+redis.call('HINCRBY', KEYS[1], 'images', 1)
+return 1
+`)
+
+// releaseScript 释放配额，用量不会低于 0
+var releaseScript = redis.NewScript(`
+local bytes = tonumber(redis.call('HGET', KEYS[1], 'bytes') or '0') - tonumber(ARGV[1])
+local images = tonumber(redis.call('HGET', KEYS[1], 'images') or '0') - 1
+if bytes < 0 then bytes = 0 end
+if images < 0 then images = 0 end
+redis.call('HSET', KEYS[1], 'bytes', bytes, 'images', images)
+return 1
+`)
+
+func usageKey(userID string) string {
+	return fmt.Sprintf("user:%s:usage", userID)
+}
+
+func quotaKey(userID string) string {
+	return fmt.Sprintf("user:%s:quota", userID)
+}
+
+func orgUsageKey(orgID string) string {
+	return fmt.Sprintf("org:%s:usage", orgID)
+}
+
+func orgQuotaKey(orgID string) string {
+	return fmt.Sprintf("org:%s:quota", orgID)
+}
+
+// GetQuota 返回用户单独设置的配额，未设置时返回 nil
+func (c *Client) GetQuota(ctx context.Context, userID string) (*model.Quota, error) {
+	return c.getQuota(ctx, quotaKey(userID))
+}
+
+func (c *Client) SetQuota(ctx context.Context, userID string, quota model.Quota) error {
+	return c.HSet(ctx, quotaKey(userID), "max_bytes", quota.MaxBytes, "max_images", quota.MaxImages).Err()
+}
+
+// ResetQuota 删除单独设置的配额，恢复为默认配额
+func (c *Client) ResetQuota(ctx context.Context, userID string) error {
+	return c.Del(ctx, quotaKey(userID)).Err()
+}
+
+// GetUsage 返回用户用量，defaultQuota 用于未单独设置配额的用户
+func (c *Client) GetUsage(ctx context.Context, userID string, defaultQuota model.Quota) (*model.Usage, error) {
+	return c.getUsage(ctx, usageKey(userID), quotaKey(userID), defaultQuota)
+}
+
+// ReserveQuota 为一张图片占用配额，超出时返回 ErrQuotaExceeded
+func (c *Client) ReserveQuota(ctx context.Context, userID string, size int64, quota model.Quota) error {
+	return c.reserveQuota(ctx, usageKey(userID), size, quota)
+}
+
+// ReleaseQuota 删除图片或上传失败时归还配额
+func (c *Client) ReleaseQuota(ctx context.Context, userID string, size int64) error {
+	return releaseScript.Run(ctx, c, []string{usageKey(userID)}, size).Err()
+}
+
+// SetOrgQuota 为组织单独设置配额
+func (c *Client) SetOrgQuota(ctx context.Context, orgID string, quota model.Quota) error {
+	return c.HSet(ctx, orgQuotaKey(orgID), "max_bytes", quota.MaxBytes, "max_images", quota.MaxImages).Err()
+}
+
+// ResetOrgQuota 恢复组织为默认配额
+func (c *Client) ResetOrgQuota(ctx context.Context, orgID string) error {
+	return c.Del(ctx, orgQuotaKey(orgID)).Err()
+}
+
+// GetOrgUsage 返回组织用量，defaultQuota 用于未单独设置配额的组织
+func (c *Client) GetOrgUsage(ctx context.Context, orgID string, defaultQuota model.Quota) (*model.Usage, error) {
+	return c.getUsage(ctx, orgUsageKey(orgID), orgQuotaKey(orgID), defaultQuota)
+}
+
+// ReserveOrgQuota 为组织图片占用配额，超出时返回 ErrQuotaExceeded
+func (c *Client) ReserveOrgQuota(ctx context.Context, orgID string, size int64, quota model.Quota) error {
+	return c.reserveQuota(ctx, orgUsageKey(orgID), size, quota)
+}
+
+// ReleaseOrgQuota 归还组织配额
+func (c *Client) ReleaseOrgQuota(ctx context.Context, orgID string, size int64) error {
+	return releaseScript.Run(ctx, c, []string{orgUsageKey(orgID)}, size).Err()
+}
+
+func (c *Client) getQuota(ctx context.Context, key string) (*model.Quota, error) {
+	fields, err := c.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	maxBytes, _ := strconv.ParseInt(fields["max_bytes"], 10, 64)
+	maxImages, _ := strconv.ParseInt(fields["max_images"], 10, 64)
+	return &model.Quota{MaxBytes: maxBytes, MaxImages: maxImages}, nil
+}
+
+func (c *Client) getUsage(ctx context.Context, usageKey, quotaKey string, defaultQuota model.Quota) (*model.Usage, error) {
+	fields, err := c.HGetAll(ctx, usageKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	usage := &model.Usage{Quota: defaultQuota}
+	usage.Bytes, _ = strconv.ParseInt(fields["bytes"], 10, 64)
+	usage.Images, _ = strconv.ParseInt(fields["images"], 10, 64)
+
+	quota, err := c.getQuota(ctx, quotaKey)
+	if err != nil {
+		return nil, err
+	}
+	if quota != nil {
+		usage.Quota = *quota
+		usage.Custom = true
+	}
+	return usage, nil
+}
+
+func (c *Client) reserveQuota(ctx context.Context, key string, size int64, quota model.Quota) error {
+	ok, err := reserveScript.Run(ctx, c, []string{key}, size, quota.MaxBytes, quota.MaxImages).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
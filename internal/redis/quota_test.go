@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/notes-bin/ibed/internal/model"
+)
+
+func TestReserveQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		used       model.Usage
+		size       int64
+		quota      model.Quota
+		wantErr    error
+		wantBytes  int64
+		wantImages int64
+	}{
+		{"unlimited", model.Usage{Bytes: 100, Images: 3}, 50, model.Quota{}, nil, 150, 4},
+		{"within limits", model.Usage{Bytes: 100, Images: 3}, 50, model.Quota{MaxBytes: 150, MaxImages: 4}, nil, 150, 4},
+		{"bytes exceeded", model.Usage{Bytes: 100, Images: 3}, 51, model.Quota{MaxBytes: 150}, ErrQuotaExceeded, 100, 3},
+		{"images exceeded", model.Usage{Bytes: 100, Images: 4}, 1, model.Quota{MaxImages: 4}, ErrQuotaExceeded, 100, 4},
+		{"empty usage", model.Usage{}, 10, model.Quota{MaxBytes: 10, MaxImages: 1}, nil, 10, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t)
+			ctx := context.Background()
+			if tt.used.Images > 0 {
+				c.HSet(ctx, usageKey("u"), "bytes", tt.used.Bytes, "images", tt.used.Images)
+			}
+			err := c.ReserveQuota(ctx, "u", tt.size, tt.quota)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			usage, err := c.GetUsage(ctx, "u", model.Quota{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if usage.Bytes != tt.wantBytes || usage.Images != tt.wantImages {
+				t.Errorf("usage = %d bytes / %d images, want %d / %d", usage.Bytes, usage.Images, tt.wantBytes, tt.wantImages)
+			}
+		})
+	}
+}
+
+func TestReserveQuotaConcurrent(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	quota := model.Quota{MaxImages: 10}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.ReserveQuota(ctx, "u", 1, quota); err == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 10 {
+		t.Errorf("reserved = %d, want 10", reserved)
+	}
+}
+
+func TestReleaseQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		bytes      int64
+		images     int64
+		size       int64
+		wantBytes  int64
+		wantImages int64
+	}{
+		{"normal", 100, 2, 40, 60, 1},
+		{"never below zero", 10, 0, 40, 0, 0},
+		{"missing usage", 0, 0, 5, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestClient(t)
+			ctx := context.Background()
+			if tt.bytes > 0 || tt.images > 0 {
+				c.HSet(ctx, orgUsageKey("o"), "bytes", tt.bytes, "images", tt.images)
+			}
+			if err := c.ReleaseOrgQuota(ctx, "o", tt.size); err != nil {
+				t.Fatal(err)
+			}
+			usage, err := c.GetOrgUsage(ctx, "o", model.Quota{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if usage.Bytes != tt.wantBytes || usage.Images != tt.wantImages {
+				t.Errorf("usage = %d bytes / %d images, want %d / %d", usage.Bytes, usage.Images, tt.wantBytes, tt.wantImages)
+			}
+		})
+	}
+}
+
+func TestGetUsageCustomQuota(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+	def := model.Quota{MaxBytes: 1000, MaxImages: 10}
+
+	usage, err := c.GetUsage(ctx, "u", def)
+	if err != nil || usage.Custom || usage.Quota != def {
+		t.Fatalf("default usage = %+v, %v", usage, err)
+	}
+	custom := model.Quota{MaxBytes: 5, MaxImages: 1}
+	c.SetQuota(ctx, "u", custom)
+	if usage, _ = c.GetUsage(ctx, "u", def); !usage.Custom || usage.Quota != custom {
+		t.Errorf("custom usage = %+v", usage)
+	}
+	c.ResetQuota(ctx, "u")
+	if usage, _ = c.GetUsage(ctx, "u", def); usage.Custom || usage.Quota != def {
+		t.Errorf("reset usage = %+v", usage)
+	}
+}
@@ -13,14 +13,16 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// imageTTL 图片元数据、标签和图片列表的有效期
+const imageTTL = 30 * 24 * time.Hour
+
+// maxTxRetries 乐观事务因并发修改失败时的最大重试次数
+const maxTxRetries = 10
+
 type Client struct {
 	*redis.Client
 }
 
-func (c *Client) GetCachedImage(context context.Context, param any) (any, any) {
-	panic("unimplemented")
-}
-
 func NewClient(addr, password string, db, poolSize int) (*Client, error) {
 	client := redis.NewClient(&redis.Options{
 		Addr:     addr,
@@ -41,11 +43,12 @@ func (c *Client) SaveUser(ctx context.Context, user *model.User) error {
 	if err != nil {
 		return err
 	}
-	return c.Set(ctx, fmt.Sprintf("user:%s", user.ID), data, 0).Err()
+	return c.Set(ctx, userKey(user.ID), data, 0).Err()
 }
 
-func (c *Client) GetUser(ctx context.Context, username string) (*model.User, error) {
-	data, err := c.Get(ctx, fmt.Sprintf("user:%s", username)).Bytes()
+// GetUser 通过用户 ID 查找用户，按用户名查找使用 GetUserByUsername
+func (c *Client) GetUser(ctx context.Context, id string) (*model.User, error) {
+	data, err := c.Get(ctx, userKey(id)).Bytes()
 	if err == redis.Nil {
 		return nil, nil
 	}
@@ -59,6 +62,26 @@ func (c *Client) GetUser(ctx context.Context, username string) (*model.User, err
 	return &user, nil
 }
 
+// ScanUsers 遍历所有用户，fn 返回 false 时停止
+func (c *Client) ScanUsers(ctx context.Context, fn func(*model.User) bool) error {
+	iter := c.Scan(ctx, 0, "user:*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		// 跳过 user:<id>:images 等附属键
+		if strings.Contains(key[len("user:"):], ":") {
+			continue
+		}
+		user, err := c.GetUser(ctx, key[len("user:"):])
+		if err != nil || user == nil {
+			continue
+		}
+		if !fn(user) {
+			return nil
+		}
+	}
+	return iter.Err()
+}
+
 func (c *Client) SaveImage(ctx context.Context, img *model.Image) error {
 	data, err := json.Marshal(img)
 	if err != nil {
@@ -76,13 +99,16 @@ func (c *Client) SaveImage(ctx context.Context, img *model.Image) error {
 			pipe.SAdd(ctx, fmt.Sprintf("image:%s:tags", img.ID), tag)
 		}
 
-		// 添加到用户图片列表
-		pipe.SAdd(ctx, fmt.Sprintf("user:%s:images", img.UserID), img.ID)
+		// 添加到用户或组织的图片列表
+		pipe.SAdd(ctx, imageOwnerKey(img), img.ID)
+		syncPendingImage(ctx, pipe, img)
+		countImage(ctx, pipe, img)
+		pipe.ZAdd(ctx, imagesIndexKey, redis.Z{Score: float64(img.CreatedAt.UnixMilli()), Member: img.ID})
 
 		// 设置过期时间
-		pipe.Expire(ctx, key, 30*24*time.Hour)
-		pipe.Expire(ctx, fmt.Sprintf("image:%s:tags", img.ID), 30*24*time.Hour)
-		pipe.Expire(ctx, fmt.Sprintf("user:%s:images", img.UserID), 30*24*time.Hour)
+		pipe.Expire(ctx, key, imageTTL)
+		pipe.Expire(ctx, fmt.Sprintf("image:%s:tags", img.ID), imageTTL)
+		pipe.Expire(ctx, imageOwnerKey(img), imageTTL)
 
 		return nil
 	})
@@ -111,15 +137,172 @@ func (c *Client) GetImage(ctx context.Context, imageID string) (*model.Image, er
 	}
 	img.Tags = tags
 
+	// 同步访问次数
+	views, err := c.ZScore(ctx, viewsAllKey, imageID).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	img.Views = int64(views)
+
 	return &img, nil
 }
 
-func (c *Client) IncrementView(ctx context.Context, imageID string) error {
-	return c.ZIncrBy(ctx, "image:views", 1, imageID).Err()
+// imageOwnerKey 图片所属的用户或组织图片列表
+func imageOwnerKey(img *model.Image) string {
+	if img.OrgID != "" {
+		return orgImagesKey(img.OrgID)
+	}
+	return userImagesKey(img.UserID)
+}
+
+// DeleteImage 删除图片元数据、标签、举报和用户或组织图片索引，从排行榜、审核队列和图片列表索引移除，并更新全站统计；
+// 按天统计的访问数据随过期时间自动清理
+func (c *Client) DeleteImage(ctx context.Context, img *model.Image) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, fmt.Sprintf("image:%s", img.ID), fmt.Sprintf("image:%s:tags", img.ID))
+		uncountImage(ctx, pipe, img.ID)
+		pipe.ZRem(ctx, imagesIndexKey, img.ID)
+		pipe.SRem(ctx, imageOwnerKey(img), img.ID)
+		pipe.Del(ctx, reportsKey(img.ID))
+		pipe.ZRem(ctx, moderationQueueKey, img.ID)
+		pipe.ZRem(ctx, pendingImagesKey, img.ID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.RemoveFromLeaderboards(ctx, img.ID)
+}
+
+// UpdateImage 更新图片元数据并同步待审核列表，保留原有过期时间；图片已不存在时返回 redis.Nil
+func (c *Client) UpdateImage(ctx context.Context, img *model.Image) error {
+	data, err := json.Marshal(img)
+	if err != nil {
+		return err
+	}
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetArgs(ctx, fmt.Sprintf("image:%s", img.ID), data, redis.SetArgs{Mode: "XX", KeepTTL: true})
+		syncPendingImage(ctx, pipe, img)
+		return nil
+	})
+	return err
+}
+
+// HideImage 在事务中重新读取图片并设为隐藏，返回隐藏后的图片；图片不存在或已隐藏时返回 nil
+func (c *Client) HideImage(ctx context.Context, id string) (*model.Image, error) {
+	key := fmt.Sprintf("image:%s", id)
+	for i := 0; i < maxTxRetries; i++ {
+		var hidden *model.Image
+		err := c.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var img model.Image
+			if err := json.Unmarshal(data, &img); err != nil {
+				return err
+			}
+			if img.Hidden {
+				return nil
+			}
+			img.Hidden = true
+			if data, err = json.Marshal(&img); err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.SetArgs(ctx, key, data, redis.SetArgs{Mode: "XX", KeepTTL: true})
+				syncPendingImage(ctx, pipe, &img)
+				return nil
+			})
+			if err == nil {
+				hidden = &img
+			}
+			return err
+		}, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return hidden, err
+	}
+	return nil, redis.TxFailedErr
+}
+
+// transferImageScript 图片元数据存在时改写归属（保留过期时间），更新用户图片列表、上传者统计和图片统计信息，
+// 并把用量从原用户移到新用户（原用户用量不低于 0）；元数据已过期时只从原用户的图片列表移除并返回 0
+// KEYS[1] 图片元数据；KEYS[2] 原用户图片列表；KEYS[3] 新用户图片列表；KEYS[4] 上传者图片数；KEYS[5] 上传者字节数；KEYS[6] 图片统计信息；
+// KEYS[7] 原用户用量；KEYS[8] 新用户用量；
+// ARGV[1] 新元数据 JSON；ARGV[2] 图片 ID；ARGV[3] 原用户 ID；ARGV[4] 新用户 ID；ARGV[5] 图片大小；ARGV[6] 图片列表有效期（秒）；ARGV[7] 新统计信息
+var transferImageScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  redis.call('SREM', KEYS[2], ARGV[2])
+  return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'KEEPTTL')
+redis.call('SREM', KEYS[2], ARGV[2])
+redis.call('SADD', KEYS[3], ARGV[2])
+redis.call('EXPIRE', KEYS[3], ARGV[6])
+redis.call('ZINCRBY', KEYS[4], -1, ARGV[3])
+redis.call('ZINCRBY', KEYS[4], 1, ARGV[4])
+redis.call('ZINCRBY', KEYS[5], -tonumber(ARGV[5]), ARGV[3])
+redis.call('ZINCRBY', KEYS[5], ARGV[5], ARGV[4])
+if redis.call('HEXISTS', KEYS[6], ARGV[2]) == 1 then
+  redis.call('HSET', KEYS[6], ARGV[2], ARGV[7])
+end
+local bytes = tonumber(redis.call('HGET', KEYS[7], 'bytes') or '0') - tonumber(ARGV[5])
+local images = tonumber(redis.call('HGET', KEYS[7], 'images') or '0') - 1
+if bytes < 0 then bytes = 0 end
+if images < 0 then images = 0 end
+redis.call('HSET', KEYS[7], 'bytes', bytes, 'images', images)
+redis.call('HINCRBY', KEYS[8], 'bytes', ARGV[5])
+redis.call('HINCRBY', KEYS[8], 'images', 1)
+return 1
+`)
+
+// TransferImage 将图片转给另一个用户，保留原有过期时间，用量随图片一起转移且不受接收方配额限制；
+// 图片元数据已过期时返回 redis.Nil，img 保持不变
+func (c *Client) TransferImage(ctx context.Context, img *model.Image, userID string) error {
+	oldUserID := img.UserID
+	img.UserID = userID
+	data, err := json.Marshal(img)
+	stat := newImageStat(img)
+	img.UserID = oldUserID
+	if err != nil {
+		return err
+	}
+	ok, err := transferImageScript.Run(ctx, c,
+		[]string{fmt.Sprintf("image:%s", img.ID), userImagesKey(oldUserID), userImagesKey(userID), statsUploadersKey, statsUploaderBytesKey, statsImagesKey,
+			usageKey(oldUserID), usageKey(userID)},
+		data, img.ID, oldUserID, userID, img.Size, int64(imageTTL.Seconds()), stat).Int()
+	if err != nil {
+		return err
+	}
+	if ok != 1 {
+		return redis.Nil
+	}
+	img.UserID = userID
+	return nil
+}
+
+// IncrementView 累加总访问量，同时写入当天的访问天桶（并登记到天桶键集合）和全站每日访问数
+func (c *Client) IncrementView(ctx context.Context, imageID string, retentionDays int) error {
+	now := time.Now()
+	day := dayKey(now)
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZIncrBy(ctx, viewsAllKey, 1, imageID)
+		pipe.ZIncrBy(ctx, day, 1, imageID)
+		pipe.Expire(ctx, day, time.Duration(retentionDays+1)*24*time.Hour)
+		pipe.SAdd(ctx, viewsDaysKey, day)
+		pipe.HIncrBy(ctx, statsViewsKey, now.UTC().Format(dayLayout), 1)
+		return nil
+	})
+	return err
 }
 
-func (c *Client) GetTop10Images(ctx context.Context) ([]string, error) {
-	return c.ZRevRange(ctx, "image:views", 0, 9).Result()
+func (c *Client) GetTopImages(ctx context.Context, n int) ([]string, error) {
+	return c.ZRevRange(ctx, viewsAllKey, 0, int64(n-1)).Result()
 }
 
 func (c *Client) SearchImages(ctx context.Context, query string, offset, limit int) ([]*model.Image, error) {
@@ -173,8 +356,8 @@ func (c *Client) CacheUser(ctx context.Context, user *model.User, ttl time.Durat
 	return c.Set(ctx, fmt.Sprintf("cache:user:%s", user.ID), data, ttl).Err()
 }
 
-func (c *Client) GetUserFromCache(ctx context.Context, username string) (*model.User, error) {
-	data, err := c.Get(ctx, fmt.Sprintf("cache:user:%s", username)).Bytes()
+func (c *Client) GetUserFromCache(ctx context.Context, id string) (*model.User, error) {
+	data, err := c.Get(ctx, fmt.Sprintf("cache:user:%s", id)).Bytes()
 	if err == redis.Nil {
 		return nil, nil
 	}
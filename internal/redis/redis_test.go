@@ -0,0 +1,115 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient 启动一个 miniredis 并返回连接到它的客户端，测试结束时自动关闭
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c, err := NewClient(mr.Addr(), "", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, mr
+}
+
+func TestTransferImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		expired bool
+		wantErr error
+	}{
+		{"live image", false, nil},
+		{"expired metadata", true, redis.Nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, mr := newTestClient(t)
+			img := &model.Image{ID: "img1", UserID: "alice", Size: 100, MimeType: "image/png", CreatedAt: time.Now()}
+			if err := c.SaveImage(ctx, img); err != nil {
+				t.Fatal(err)
+			}
+			if tt.expired {
+				mr.Del("image:img1")
+			}
+
+			err := c.TransferImage(ctx, img, "bob")
+			if err != tt.wantErr {
+				t.Fatalf("TransferImage() error = %v, want %v", err, tt.wantErr)
+			}
+			if ok, _ := mr.SIsMember(userImagesKey("alice"), "img1"); ok {
+				t.Error("image still listed for the previous owner")
+			}
+			wantOwner, wantBob := "bob", 1.0
+			if tt.expired {
+				wantOwner, wantBob = "alice", 0
+			}
+			if img.UserID != wantOwner {
+				t.Errorf("img.UserID = %q, want %q", img.UserID, wantOwner)
+			}
+			if ok, _ := mr.SIsMember(userImagesKey("bob"), "img1"); ok != !tt.expired {
+				t.Errorf("listed for bob = %v", ok)
+			}
+			if score, _ := mr.ZScore(statsUploadersKey, "bob"); score != wantBob {
+				t.Errorf("bob uploader count = %v, want %v", score, wantBob)
+			}
+			if !tt.expired && mr.TTL("image:img1") <= 0 {
+				t.Error("metadata TTL not kept")
+			}
+		})
+	}
+}
+
+func TestHideImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   *model.Image // 为 nil 表示元数据不存在
+		wantHide bool
+	}{
+		{"visible image", &model.Image{ID: "img1", UserID: "alice", Description: "edited"}, true},
+		{"already hidden", &model.Image{ID: "img1", UserID: "alice", Hidden: true}, false},
+		{"expired metadata", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c, mr := newTestClient(t)
+			if tt.stored != nil {
+				tt.stored.CreatedAt = time.Now()
+				if err := c.SaveImage(ctx, tt.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ttl := mr.TTL("image:img1")
+
+			hidden, err := c.HideImage(ctx, "img1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (hidden != nil) != tt.wantHide {
+				t.Fatalf("hidden %v, want %v", hidden != nil, tt.wantHide)
+			}
+			if !tt.wantHide {
+				return
+			}
+			img, _ := c.GetImage(ctx, "img1")
+			if !img.Hidden || img.Description != tt.stored.Description {
+				t.Errorf("stored image %+v, want hidden with other fields kept", img)
+			}
+			if got := mr.TTL("image:img1"); got != ttl {
+				t.Errorf("TTL %v, want %v", got, ttl)
+			}
+		})
+	}
+}
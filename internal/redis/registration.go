@@ -0,0 +1,150 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrInviteInvalid = errors.New("invalid or exhausted invite code")
+
+const invitesKey = "invites"
+
+func inviteKey(code string) string {
+	return fmt.Sprintf("invite:%s", code)
+}
+
+// useInviteScript 原子地校验邀请码并增加使用次数
+// KEYS[1] 邀请码哈希；ARGV[1] 当前时间（秒）
+var useInviteScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+local expires = tonumber(redis.call('HGET', KEYS[1], 'expires_at') or '0')
+if expires > 0 and tonumber(ARGV[1]) >= expires then return 0 end
+local maxUses = tonumber(redis.call('HGET', KEYS[1], 'max_uses') or '0')
+local uses = tonumber(redis.call('HGET', KEYS[1], 'uses') or '0')
+if maxUses > 0 and uses >= maxUses then return 0 end
+redis.call('HINCRBY', KEYS[1], 'uses', 1)
+return 1
+`)
+
+func (c *Client) SaveInvite(ctx context.Context, invite *model.Invite) error {
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return err
+	}
+	var expires int64
+	if !invite.ExpiresAt.IsZero() {
+		expires = invite.ExpiresAt.Unix()
+	}
+	key := inviteKey(invite.Code)
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "data", data, "max_uses", invite.MaxUses, "uses", invite.Uses, "expires_at", expires)
+		pipe.SAdd(ctx, invitesKey, invite.Code)
+		return nil
+	})
+	return err
+}
+
+func (c *Client) GetInvite(ctx context.Context, code string) (*model.Invite, error) {
+	fields, err := c.HMGet(ctx, inviteKey(code), "data", "uses").Result()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := fields[0].(string)
+	if !ok {
+		return nil, nil
+	}
+	var invite model.Invite
+	if err := json.Unmarshal([]byte(data), &invite); err != nil {
+		return nil, err
+	}
+	if uses, ok := fields[1].(string); ok {
+		invite.Uses, _ = strconv.ParseInt(uses, 10, 64)
+	}
+	return &invite, nil
+}
+
+func (c *Client) ListInvites(ctx context.Context) ([]*model.Invite, error) {
+	codes, err := c.SMembers(ctx, invitesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	invites := []*model.Invite{}
+	for _, code := range codes {
+		invite, err := c.GetInvite(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		if invite == nil {
+			c.SRem(ctx, invitesKey, code)
+			continue
+		}
+		invites = append(invites, invite)
+	}
+	return invites, nil
+}
+
+func (c *Client) DeleteInvite(ctx context.Context, code string) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, inviteKey(code))
+		pipe.SRem(ctx, invitesKey, code)
+		return nil
+	})
+	return err
+}
+
+// UseInvite 消耗一次邀请码，无效、过期或次数用尽时返回 ErrInviteInvalid
+func (c *Client) UseInvite(ctx context.Context, code string) (*model.Invite, error) {
+	ok, err := useInviteScript.Run(ctx, c, []string{inviteKey(code)}, time.Now().Unix()).Int()
+	if err != nil {
+		return nil, err
+	}
+	if ok != 1 {
+		return nil, ErrInviteInvalid
+	}
+	return c.GetInvite(ctx, code)
+}
+
+// ReleaseInvite 注册失败时归还一次使用次数
+func (c *Client) ReleaseInvite(ctx context.Context, code string) error {
+	return c.HIncrBy(ctx, inviteKey(code), "uses", -1).Err()
+}
+
+const pendingUsersKey = "users:pending"
+
+// AddPendingUser 加入待审核队列
+func (c *Client) AddPendingUser(ctx context.Context, userID string, at time.Time) error {
+	return c.ZAdd(ctx, pendingUsersKey, redis.Z{Score: float64(at.Unix()), Member: userID}).Err()
+}
+
+func (c *Client) RemovePendingUser(ctx context.Context, userID string) error {
+	return c.ZRem(ctx, pendingUsersKey, userID).Err()
+}
+
+// ListPendingUsers 按注册时间返回待审核用户
+func (c *Client) ListPendingUsers(ctx context.Context) ([]*model.User, error) {
+	ids, err := c.ZRange(ctx, pendingUsersKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	users := []*model.User{}
+	for _, id := range ids {
+		user, err := c.GetUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			c.ZRem(ctx, pendingUsersKey, id)
+			continue
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrAlreadyReported 同一举报人重复举报同一张图片
+var ErrAlreadyReported = errors.New("already reported")
+
+const (
+	// moderationQueueKey 待审核图片，分数为首次举报时间
+	moderationQueueKey = "moderation:queue"
+	// pendingImagesKey 等待发布前人工审核的图片，分数为上传时间
+	pendingImagesKey = "moderation:pending"
+	// reportDedupTTL 同一举报人对同一图片的去重时间
+	reportDedupTTL = 30 * 24 * time.Hour
+)
+
+func reportsKey(imageID string) string {
+	return fmt.Sprintf("image:%s:reports", imageID)
+}
+
+func reportDedupKey(imageID, reporter string) string {
+	return fmt.Sprintf("report:dedup:%s:%s", imageID, reporter)
+}
+
+// addReportScript 去重后记录举报并加入审核队列，返回举报总数，重复举报返回 -1
+// KEYS[1] 去重键；KEYS[2] 举报列表；KEYS[3] 审核队列；KEYS[4...] 同时写入的其他去重键；
+// ARGV: 举报 JSON、图片 ID、当前时间戳、去重秒数
+var addReportScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], 1, 'NX', 'EX', ARGV[4]) then return -1 end
+for i = 4, #KEYS do
+  redis.call('SET', KEYS[i], 1, 'EX', ARGV[4])
+end
+redis.call('RPUSH', KEYS[2], ARGV[1])
+redis.call('ZADD', KEYS[3], 'NX', ARGV[3], ARGV[2])
+return redis.call('LLEN', KEYS[2])
+`)
+
+// AddReport 记录举报，reporter 标识举报人用于去重，also 为同时标记为已举报的其他标识（不参与本次去重）；
+// 返回该图片待处理的举报数
+func (c *Client) AddReport(ctx context.Context, report *model.Report, reporter string, also ...string) (int64, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return 0, err
+	}
+	keys := []string{reportDedupKey(report.ImageID, reporter), reportsKey(report.ImageID), moderationQueueKey}
+	for _, other := range also {
+		keys = append(keys, reportDedupKey(report.ImageID, other))
+	}
+	n, err := addReportScript.Run(ctx, c, keys, data, report.ImageID, report.CreatedAt.Unix(), int(reportDedupTTL.Seconds())).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, ErrAlreadyReported
+	}
+	return n, nil
+}
+
+// ImageReports 返回图片待处理的举报
+func (c *Client) ImageReports(ctx context.Context, imageID string) ([]*model.Report, error) {
+	items, err := c.LRange(ctx, reportsKey(imageID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	reports := []*model.Report{}
+	for _, item := range items {
+		var report model.Report
+		if err := json.Unmarshal([]byte(item), &report); err == nil {
+			reports = append(reports, &report)
+		}
+	}
+	return reports, nil
+}
+
+// ModerationQueue 按首次举报时间从早到晚返回待审核图片的举报汇总
+func (c *Client) ModerationQueue(ctx context.Context, offset, limit int) ([]*model.ModerationCase, error) {
+	entries, err := c.ZRangeWithScores(ctx, moderationQueueKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	cases := []*model.ModerationCase{}
+	for _, entry := range entries {
+		imageID := entry.Member.(string)
+		reports, err := c.ImageReports(ctx, imageID)
+		if err != nil {
+			return nil, err
+		}
+		mc := &model.ModerationCase{
+			ImageID:         imageID,
+			Reports:         int64(len(reports)),
+			Reasons:         map[model.ReportReason]int{},
+			FirstReportedAt: time.Unix(int64(entry.Score), 0),
+		}
+		for _, report := range reports {
+			mc.Reasons[report.Reason]++
+		}
+		cases = append(cases, mc)
+	}
+	return cases, nil
+}
+
+// CountModerationQueue 返回待审核图片数量
+func (c *Client) CountModerationQueue(ctx context.Context) (int64, error) {
+	return c.ZCard(ctx, moderationQueueKey).Result()
+}
+
+// ResolveReports 处理完毕后清除图片的举报并移出审核队列
+func (c *Client) ResolveReports(ctx context.Context, imageID string) error {
+	_, err := c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, reportsKey(imageID))
+		pipe.ZRem(ctx, moderationQueueKey, imageID)
+		return nil
+	})
+	return err
+}
+
+// PendingImageIDs 按上传时间从早到晚返回等待发布前审核的图片
+func (c *Client) PendingImageIDs(ctx context.Context, offset, limit int) ([]string, error) {
+	return c.ZRange(ctx, pendingImagesKey, int64(offset), int64(offset+limit-1)).Result()
+}
+
+// syncPendingImage 按图片的审核状态维护待审核列表
+func syncPendingImage(ctx context.Context, pipe redis.Pipeliner, img *model.Image) {
+	if img.Review == model.ReviewPending {
+		pipe.ZAddNX(ctx, pendingImagesKey, redis.Z{Score: float64(img.CreatedAt.Unix()), Member: img.ID})
+	} else {
+		pipe.ZRem(ctx, pendingImagesKey, img.ID)
+	}
+}
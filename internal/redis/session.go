@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func sessionKey(id string) string {
+	return fmt.Sprintf("session:%s", id)
+}
+
+// userSessionsKey 用户的会话索引，分数为过期时间
+func userSessionsKey(userID string) string {
+	return fmt.Sprintf("user:%s:sessions", userID)
+}
+
+// SaveSession 保存会话，键在会话过期时自动删除
+func (c *Client) SaveSession(ctx context.Context, s *model.Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(s.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(s.ID), data, ttl)
+		pipe.ZAdd(ctx, userSessionsKey(s.UserID), redis.Z{Score: float64(s.ExpiresAt.Unix()), Member: s.ID})
+		return nil
+	})
+	return err
+}
+
+func (c *Client) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	data, err := c.Get(ctx, sessionKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s model.Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListSessions 返回用户未过期的会话，并清理索引中已过期的条目
+func (c *Client) ListSessions(ctx context.Context, userID string) ([]*model.Session, error) {
+	key := userSessionsKey(userID)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := c.ZRemRangeByScore(ctx, key, "-inf", "("+now).Err(); err != nil {
+		return nil, err
+	}
+	ids, err := c.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessions := []*model.Session{}
+	for _, id := range ids {
+		s, err := c.GetSession(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			c.ZRem(ctx, key, id)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// DeleteSession 删除用户的某个会话，会话不属于该用户时返回 false
+func (c *Client) DeleteSession(ctx context.Context, userID, id string) (bool, error) {
+	removed, err := c.ZRem(ctx, userSessionsKey(userID), id).Result()
+	if err != nil || removed == 0 {
+		return false, err
+	}
+	return true, c.Del(ctx, sessionKey(id)).Err()
+}
+
+// DeleteUserSessions 删除用户的全部会话，返回删除数量
+func (c *Client) DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	key := userSessionsKey(userID)
+	ids, err := c.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Del(ctx, sessionKey(id))
+		}
+		pipe.Del(ctx, key)
+		return nil
+	})
+	return len(ids), err
+}
+
+// TouchSession 更新会话的最近访问信息，会话已被删除时不会重新创建
+func (c *Client) TouchSession(ctx context.Context, s *model.Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	err = c.SetArgs(ctx, sessionKey(s.ID), data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
+
+// ExtendSession 延长会话有效期，会话已被删除时返回 false
+func (c *Client) ExtendSession(ctx context.Context, s *model.Session) (bool, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return false, err
+	}
+	var set *redis.StatusCmd
+	_, err = c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		set = pipe.SetArgs(ctx, sessionKey(s.ID), data, redis.SetArgs{Mode: "XX", TTL: time.Until(s.ExpiresAt)})
+		pipe.ZAddXX(ctx, userSessionsKey(s.UserID), redis.Z{Score: float64(s.ExpiresAt.Unix()), Member: s.ID})
+		return nil
+	})
+	if err == redis.Nil || set.Err() == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const maxTopReferrers = 10
+
+// ViewEvent 一次图片访问
+type ViewEvent struct {
+	Visitor  string // 访客标识（IP+UA 的哈希）
+	Referrer string // 来源站点，直接访问为 "direct"
+	Bytes    int64  // 返回的字节数
+}
+
+func imageStatsKey(imageID, day string) string {
+	return fmt.Sprintf("image:%s:stats:%s", imageID, day)
+}
+
+func imageVisitorsKey(imageID, day string) string {
+	return fmt.Sprintf("image:%s:uv:%s", imageID, day)
+}
+
+func imageReferrersKey(imageID, day string) string {
+	return fmt.Sprintf("image:%s:referrers:%s", imageID, day)
+}
+
+// RecordImageStats 记录单张图片的当日访问量、独立访客、来源和流量
+func (c *Client) RecordImageStats(ctx context.Context, imageID string, ev ViewEvent, retentionDays int) error {
+	day := time.Now().UTC().Format(dayLayout)
+	ttl := time.Duration(retentionDays+1) * 24 * time.Hour
+	statsKey := imageStatsKey(imageID, day)
+	uvKey := imageVisitorsKey(imageID, day)
+	refKey := imageReferrersKey(imageID, day)
+
+	_, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, statsKey, "views", 1)
+		pipe.HIncrBy(ctx, statsKey, "bytes", ev.Bytes)
+		pipe.PFAdd(ctx, uvKey, ev.Visitor)
+		pipe.ZIncrBy(ctx, refKey, 1, ev.Referrer)
+		for _, key := range []string{statsKey, uvKey, refKey} {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// GetImageStats 汇总 [from, to] 日期范围内的访问统计
+func (c *Client) GetImageStats(ctx context.Context, imageID string, from, to time.Time) (*model.ImageStats, error) {
+	stats := &model.ImageStats{
+		ImageID:      imageID,
+		From:         from.Format(time.DateOnly),
+		To:           to.Format(time.DateOnly),
+		Daily:        []model.DailyImageStats{},
+		TopReferrers: []model.ReferrerCount{},
+	}
+
+	total, err := c.ZScore(ctx, viewsAllKey, imageID).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	stats.TotalViews = int64(total)
+
+	type dayCmds struct {
+		date   string
+		fields *redis.MapStringStringCmd
+		uv     *redis.IntCmd
+		refs   *redis.ZSliceCmd
+	}
+	days := []dayCmds{}
+	uvKeys := []string{}
+	pipe := c.Pipeline()
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		day := d.Format(dayLayout)
+		days = append(days, dayCmds{
+			date:   d.Format(time.DateOnly),
+			fields: pipe.HGetAll(ctx, imageStatsKey(imageID, day)),
+			uv:     pipe.PFCount(ctx, imageVisitorsKey(imageID, day)),
+			refs:   pipe.ZRangeWithScores(ctx, imageReferrersKey(imageID, day), 0, -1),
+		})
+		uvKeys = append(uvKeys, imageVisitorsKey(imageID, day))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	referrers := map[string]int64{}
+	for _, day := range days {
+		fields := day.fields.Val()
+		views, _ := strconv.ParseInt(fields["views"], 10, 64)
+		bytes, _ := strconv.ParseInt(fields["bytes"], 10, 64)
+		stats.Daily = append(stats.Daily, model.DailyImageStats{
+			Date:           day.date,
+			Views:          views,
+			UniqueVisitors: day.uv.Val(),
+			BytesServed:    bytes,
+		})
+		stats.Views += views
+		stats.BytesServed += bytes
+		for _, ref := range day.refs.Val() {
+			referrers[ref.Member.(string)] += int64(ref.Score)
+		}
+	}
+
+	// 多个 HyperLogLog 合并计数，避免同一访客跨天重复计算
+	if len(uvKeys) > 0 {
+		uv, err := c.PFCount(ctx, uvKeys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		stats.UniqueVisitors = uv
+	}
+
+	for ref, views := range referrers {
+		stats.TopReferrers = append(stats.TopReferrers, model.ReferrerCount{Referrer: ref, Views: views})
+	}
+	sort.Slice(stats.TopReferrers, func(i, j int) bool {
+		if stats.TopReferrers[i].Views != stats.TopReferrers[j].Views {
+			return stats.TopReferrers[i].Views > stats.TopReferrers[j].Views
+		}
+		return stats.TopReferrers[i].Referrer < stats.TopReferrers[j].Referrer
+	})
+	if len(stats.TopReferrers) > maxTopReferrers {
+		stats.TopReferrers = stats.TopReferrers[:maxTopReferrers]
+	}
+	return stats, nil
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestImageStats(t *testing.T) {
+	c, mr := newTestClient(t)
+	ctx := context.Background()
+	today := time.Now().UTC()
+
+	events := []ViewEvent{
+		{Visitor: "a", Referrer: "direct", Bytes: 100},
+		{Visitor: "a", Referrer: "example.com", Bytes: 40},
+		{Visitor: "b", Referrer: "example.com", Bytes: 0},
+	}
+	for _, ev := range events {
+		if err := c.RecordImageStats(ctx, "img", ev, 7); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.IncrementView(ctx, "img", 7); err != nil {
+		t.Fatal(err)
+	}
+	// 其他图片的访问不应计入
+	if err := c.RecordImageStats(ctx, "other", ViewEvent{Visitor: "c", Referrer: "direct", Bytes: 999}, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := mr.TTL(imageStatsKey("img", today.Format(dayLayout))); ttl != 8*24*time.Hour {
+		t.Errorf("stats ttl = %v, want %v", ttl, 8*24*time.Hour)
+	}
+
+	tests := []struct {
+		name      string
+		from, to  time.Time
+		days      int
+		views     int64
+		visitors  int64
+		bytes     int64
+		referrers []string
+	}{
+		{"today", today, today, 1, 3, 2, 140, []string{"example.com", "direct"}},
+		{"range", today.AddDate(0, 0, -2), today, 3, 3, 2, 140, []string{"example.com", "direct"}},
+		{"past", today.AddDate(0, 0, -3), today.AddDate(0, 0, -1), 3, 0, 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := c.GetImageStats(ctx, "img", tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.TotalViews != 1 {
+				t.Errorf("total views = %d, want 1", stats.TotalViews)
+			}
+			if len(stats.Daily) != tt.days {
+				t.Fatalf("daily = %d entries, want %d", len(stats.Daily), tt.days)
+			}
+			if last := stats.Daily[len(stats.Daily)-1]; last.Date != tt.to.Format(time.DateOnly) {
+				t.Errorf("last day = %s, want %s", last.Date, tt.to.Format(time.DateOnly))
+			}
+			if stats.Views != tt.views || stats.UniqueVisitors != tt.visitors || stats.BytesServed != tt.bytes {
+				t.Errorf("views/visitors/bytes = %d/%d/%d, want %d/%d/%d",
+					stats.Views, stats.UniqueVisitors, stats.BytesServed, tt.views, tt.visitors, tt.bytes)
+			}
+			if len(stats.TopReferrers) != len(tt.referrers) {
+				t.Fatalf("referrers = %v, want %v", stats.TopReferrers, tt.referrers)
+			}
+			for i, ref := range tt.referrers {
+				if stats.TopReferrers[i].Referrer != ref {
+					t.Errorf("referrer[%d] = %s, want %s", i, stats.TopReferrers[i].Referrer, ref)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// hiddenUsersKey 公开图片被隐藏的用户，分数为隐藏的到期时间戳，+inf 表示不过期
+const hiddenUsersKey = "users:hidden"
+
+// HideUserImages 隐藏用户的公开图片直到指定时间，零值表示不过期
+func (c *Client) HideUserImages(ctx context.Context, userID string, until time.Time) error {
+	score := math.Inf(1)
+	if !until.IsZero() {
+		score = float64(until.Unix())
+	}
+	return c.ZAdd(ctx, hiddenUsersKey, redis.Z{Score: score, Member: userID}).Err()
+}
+
+// UnhideUserImages 恢复用户公开图片的访问
+func (c *Client) UnhideUserImages(ctx context.Context, userID string) error {
+	return c.ZRem(ctx, hiddenUsersKey, userID).Err()
+}
+
+// UserImagesHidden 判断用户的公开图片当前是否被隐藏
+func (c *Client) UserImagesHidden(ctx context.Context, userID string) (bool, error) {
+	score, err := c.ZScore(ctx, hiddenUsersKey, userID).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return score > float64(time.Now().Unix()), nil
+}
@@ -0,0 +1,321 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/notes-bin/ibed/internal/model"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrUsernameTaken = errors.New("username already exists")
+
+func userKey(id string) string {
+	return fmt.Sprintf("user:%s", id)
+}
+
+func userImagesKey(id string) string {
+	return fmt.Sprintf("user:%s:images", id)
+}
+
+// EmailKey 邮箱到用户 ID 的索引，不区分大小写
+func EmailKey(email string) string {
+	return fmt.Sprintf("email:%s", strings.ToLower(email))
+}
+
+// usernameKey 用户名到用户 ID 的索引
+func usernameKey(username string) string {
+	return fmt.Sprintf("username:%s", username)
+}
+
+// createUserScript 占用用户名索引并保存用户，同时更新用户总数和用户列表索引，用户名已被占用时返回 0
+// KEYS[1] 用户名索引；KEYS[2] 用户；KEYS[3] 全站总数；KEYS[4] 用户列表索引；
+// ARGV[1] 用户 ID；ARGV[2] 用户 JSON；ARGV[3] 用户列表索引成员
+var createUserScript = redis.NewScript(`
+if redis.call('SETNX', KEYS[1], ARGV[1]) == 0 then return 0 end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+  redis.call('HINCRBY', KEYS[3], 'users', 1)
+end
+redis.call('SET', KEYS[2], ARGV[2])
+redis.call('ZADD', KEYS[4], 0, ARGV[3])
+return 1
+`)
+
+// renameUserScript 占用新用户名并释放旧用户名，同时更新用户列表索引，新用户名已被他人占用时返回 0
+// KEYS[1] 新用户名索引；KEYS[2] 旧用户名索引；KEYS[3] 用户；KEYS[4] 用户列表索引；
+// ARGV[1] 用户 ID；ARGV[2] 用户 JSON；ARGV[3] 旧索引成员；ARGV[4] 新索引成员
+var renameUserScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then return 0 end
+redis.call('SET', KEYS[1], ARGV[1])
+if KEYS[1] ~= KEYS[2] and redis.call('GET', KEYS[2]) == ARGV[1] then
+  redis.call('DEL', KEYS[2])
+end
+redis.call('SET', KEYS[3], ARGV[2])
+redis.call('ZREM', KEYS[4], ARGV[3])
+redis.call('ZADD', KEYS[4], 0, ARGV[4])
+return 1
+`)
+
+// deleteUserScript 删除用户，用户名索引仍指向该用户时一并删除；用户存在时更新用户总数和用户列表索引
+// KEYS[1] 用户；KEYS[2] 用户名索引；KEYS[3] 全站总数；KEYS[4] 用户列表索引；ARGV[1] 用户 ID；ARGV[2] 用户列表索引成员
+var deleteUserScript = redis.NewScript(`
+if redis.call('DEL', KEYS[1]) == 1 then
+  redis.call('HINCRBY', KEYS[3], 'users', -1)
+  redis.call('ZREM', KEYS[4], ARGV[2])
+end
+if redis.call('GET', KEYS[2]) == ARGV[1] then
+  redis.call('DEL', KEYS[2])
+end
+return 1
+`)
+
+// CreateUser 保存新用户并原子地占用用户名
+func (c *Client) CreateUser(ctx context.Context, user *model.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	ok, err := createUserScript.Run(ctx, c, []string{usernameKey(user.Username), userKey(user.ID), statsTotalsKey, usersIndexKey},
+		user.ID, data, usersIndexMember(user.Username, user.ID)).Int()
+	if err != nil {
+		return err
+	}
+	if ok != 1 {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// GetUserByUsername 通过用户名查找用户
+func (c *Client) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	id, err := c.Get(ctx, usernameKey(username)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.GetUser(ctx, id)
+}
+
+// RenameUser 修改用户名，用户 ID 不变
+func (c *Client) RenameUser(ctx context.Context, user *model.User, newUsername string) error {
+	oldUsername := user.Username
+	user.Username = newUsername
+	data, err := json.Marshal(user)
+	if err != nil {
+		user.Username = oldUsername
+		return err
+	}
+	ok, err := renameUserScript.Run(ctx, c, []string{usernameKey(newUsername), usernameKey(oldUsername), userKey(user.ID), usersIndexKey},
+		user.ID, data, usersIndexMember(oldUsername, user.ID), usersIndexMember(newUsername, user.ID)).Int()
+	if err != nil || ok != 1 {
+		user.Username = oldUsername
+		if err == nil {
+			err = ErrUsernameTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteUser 删除用户及其用户名索引
+func (c *Client) DeleteUser(ctx context.Context, user *model.User) error {
+	return deleteUserScript.Run(ctx, c, []string{userKey(user.ID), usernameKey(user.Username), statsTotalsKey, usersIndexKey},
+		user.ID, usersIndexMember(user.Username, user.ID)).Err()
+}
+
+// deleteIfOwnerScript 键的值仍为 ARGV[1] 时删除，避免误删已被他人占用的索引
+// KEYS[1] 索引；ARGV[1] 用户 ID 等
+var deleteIfOwnerScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// claimEmailScript 占用邮箱索引，索引已指向其他用户（ARGV[2] 指定的失效占用除外）时返回 0
+// KEYS[1] 邮箱索引；ARGV[1] 用户 ID；ARGV[2] 可以覆盖的失效占用者，为空表示没有
+var claimEmailScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] and owner ~= ARGV[2] then return 0 end
+redis.call('SET', KEYS[1], ARGV[1])
+return 1
+`)
+
+// ClaimEmail 邮箱验证通过后把邮箱索引指向该用户，stale 为可以覆盖的失效占用者（没有已验证该邮箱的用户）；
+// 已被其他用户占用时返回 false
+func (c *Client) ClaimEmail(ctx context.Context, email, userID, stale string) (bool, error) {
+	ok, err := claimEmailScript.Run(ctx, c, []string{EmailKey(email)}, userID, stale).Int()
+	return ok == 1, err
+}
+
+// ReleaseEmail 邮箱索引仍指向该用户时删除
+func (c *Client) ReleaseEmail(ctx context.Context, email, userID string) error {
+	return deleteIfOwnerScript.Run(ctx, c, []string{EmailKey(email)}, userID).Err()
+}
+
+// UseRecoveryCode 在事务中重新读取用户并移除一个恢复码哈希，返回是否移除成功。
+// 并发使用同一个恢复码时只有一个请求成功，也不会覆盖期间对用户的其他修改
+func (c *Client) UseRecoveryCode(ctx context.Context, userID, hash string) (bool, error) {
+	key := userKey(userID)
+	for i := 0; i < maxTxRetries; i++ {
+		used := false
+		err := c.Watch(ctx, func(tx *redis.Tx) error {
+			data, err := tx.Get(ctx, key).Bytes()
+			if err == redis.Nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			var user model.User
+			if err := json.Unmarshal(data, &user); err != nil {
+				return err
+			}
+			idx := slices.Index(user.RecoveryCodes, hash)
+			if idx < 0 {
+				return nil
+			}
+			user.RecoveryCodes = slices.Delete(user.RecoveryCodes, idx, idx+1)
+			if data, err = json.Marshal(&user); err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.SetArgs(ctx, key, data, redis.SetArgs{Mode: "XX", KeepTTL: true})
+				return nil
+			})
+			if err == nil {
+				used = true
+			}
+			return err
+		}, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		return used, err
+	}
+	return false, redis.TxFailedErr
+}
+
+// UserImageIDs 返回用户的图片 ID
+func (c *Client) UserImageIDs(ctx context.Context, userID string) ([]string, error) {
+	return c.SMembers(ctx, userImagesKey(userID)).Result()
+}
+
+// RemoveUserImage 从用户图片索引中移除一张图片
+func (c *Client) RemoveUserImage(ctx context.Context, userID, imageID string) error {
+	return c.SRem(ctx, userImagesKey(userID), imageID).Err()
+}
+
+// PurgeUser 删除用户记录及其配额、用量、会话、待审核记录和用户名、邮箱、OIDC 索引，可以重复执行
+func (c *Client) PurgeUser(ctx context.Context, userID string) error {
+	user, err := c.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		if user.Email != "" {
+			if err := deleteIfOwnerScript.Run(ctx, c, []string{EmailKey(user.Email)}, userID).Err(); err != nil {
+				return err
+			}
+		}
+		if err := c.DeleteUser(ctx, user); err != nil {
+			return err
+		}
+	}
+	if _, err := c.DeleteUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := c.Del(ctx, usageKey(userID), quotaKey(userID), userImagesKey(userID), activeExportKey(userID)).Err(); err != nil {
+		return err
+	}
+	if err := c.ZRem(ctx, pendingUsersKey, userID).Err(); err != nil {
+		return err
+	}
+	if err := c.UnhideUserImages(ctx, userID); err != nil {
+		return err
+	}
+	if err := c.purgeUserOrgs(ctx, userID); err != nil {
+		return err
+	}
+
+	iter := c.Scan(ctx, 0, "oidc:link:*", 100).Iterator()
+	for iter.Next(ctx) {
+		if err := deleteIfOwnerScript.Run(ctx, c, []string{iter.Val()}, userID).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// purgeUserOrgs 退出用户加入的全部组织并删除个人相册，组织名下的图片不受影响。
+// 用户是组织唯一的所有者时提升其他成员为所有者，没有其他成员且没有图片的组织一并删除
+func (c *Client) purgeUserOrgs(ctx context.Context, userID string) error {
+	orgs, err := c.SMembers(ctx, userOrgsKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, orgID := range orgs {
+		if err := c.leaveOrg(ctx, orgID, userID); err != nil {
+			return fmt.Errorf("org %s: %w", orgID, err)
+		}
+	}
+	albums, err := c.UserAlbums(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, album := range albums {
+		if err := c.DeleteAlbum(ctx, album); err != nil {
+			return err
+		}
+	}
+	return c.Del(ctx, userOrgsKey(userID)).Err()
+}
+
+// leaveOrg 把用户移出组织，并保证组织仍有所有者
+func (c *Client) leaveOrg(ctx context.Context, orgID, userID string) error {
+	members, err := c.OrgMembers(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if err := c.HDel(ctx, orgMembersKey(orgID), userID).Err(); err != nil {
+		return err
+	}
+	wasOwner := members[userID] == model.OrgOwner
+	delete(members, userID)
+
+	if len(members) == 0 {
+		n, err := c.CountOrgImages(ctx, orgID)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			slog.Warn("Org left without members still has images", "org_id", orgID, "images", n)
+			return nil
+		}
+		return c.DeleteOrg(ctx, orgID)
+	}
+	if !wasOwner {
+		return nil
+	}
+	// 其余成员中角色最高的一个成为所有者，角色相同时取 ID 最小的，已有其他所有者时不变
+	var successor string
+	for id, role := range members {
+		if role == model.OrgOwner {
+			return nil
+		}
+		if successor == "" || role.AtLeast(members[successor]) && (role != members[successor] || id < successor) {
+			successor = id
+		}
+	}
+	slog.Info("Promoted org member to owner", "org_id", orgID, "user_id", successor, "previous_owner", userID)
+	return c.SetOrgMember(ctx, orgID, successor, model.OrgOwner)
+}
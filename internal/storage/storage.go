@@ -36,6 +36,10 @@ func (s *Storage) DeleteFile(path string) error {
 	return os.Remove(path)
 }
 
+func (s *Storage) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
 func (s *Storage) GetFilePath(filename string) string {
 	return filepath.Join(s.uploadDir, filename)
 }
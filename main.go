@@ -11,9 +11,16 @@ import (
 	"time"
 
 	"github.com/notes-bin/ibed/internal/api"
+	"github.com/notes-bin/ibed/internal/auth"
 	"github.com/notes-bin/ibed/internal/cache"
+	"github.com/notes-bin/ibed/internal/clamd"
 	"github.com/notes-bin/ibed/internal/config"
+	"github.com/notes-bin/ibed/internal/jobs"
+	"github.com/notes-bin/ibed/internal/mail"
+	"github.com/notes-bin/ibed/internal/model"
+	"github.com/notes-bin/ibed/internal/moderation"
 	"github.com/notes-bin/ibed/internal/redis"
+	"github.com/notes-bin/ibed/internal/storage"
 )
 
 func main() {
@@ -32,6 +39,23 @@ func main() {
 		slog.Error("Failed to parse config", "error", err)
 		os.Exit(1)
 	}
+	cfg.SetDefaults()
+	switch cfg.RegistrationMode {
+	case config.RegistrationOpen, config.RegistrationInvite, config.RegistrationClosed, config.RegistrationApproval:
+	default:
+		slog.Error("Invalid registration mode", "mode", cfg.RegistrationMode)
+		os.Exit(1)
+	}
+	if !model.Role(cfg.DefaultRole).Valid() {
+		slog.Error("Invalid default role", "role", cfg.DefaultRole)
+		os.Exit(1)
+	}
+	switch cfg.JWT.Algorithm {
+	case config.JWTAlgHS256, config.JWTAlgRS256, config.JWTAlgEdDSA:
+	default:
+		slog.Error("Invalid JWT algorithm", "algorithm", cfg.JWT.Algorithm)
+		os.Exit(1)
+	}
 
 	// 初始化 Redis
 	redisClient, err := redis.NewClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, cfg.Redis.PoolSize)
@@ -41,11 +65,98 @@ func main() {
 	}
 	defer redisClient.Close()
 
+	// 旧版本以用户名作为用户 ID，迁移为 UUID
+	if migrated, err := redisClient.MigrateUserIDs(context.Background()); err != nil {
+		slog.Error("Failed to migrate user IDs", "error", err)
+		os.Exit(1)
+	} else if migrated > 0 {
+		slog.Info("Migrated legacy user IDs", "count", migrated)
+	}
+	// 首次升级时按现有数据建立管理后台统计计数器和用户索引
+	if rebuilt, err := redisClient.EnsureAdminStats(context.Background()); err != nil {
+		slog.Error("Failed to build admin stats", "error", err)
+		os.Exit(1)
+	} else if rebuilt {
+		slog.Info("Built admin stats from existing data")
+	}
+
+	// 执行命令行子命令
+	authService := auth.NewAuth(&cfg, redisClient, mail.New(cfg.SMTP))
+	if err := authService.Keys().Rotate(context.Background(), false); err != nil {
+		slog.Error("Failed to load signing keys", "error", err)
+		os.Exit(1)
+	}
+	if handled, err := runCommand(context.Background(), authService, os.Args[1:]); handled {
+		if err != nil {
+			slog.Error("Command failed", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 还没有管理员时签发一次性初始化令牌
+	hasAdmin, err := authService.HasAdmin(context.Background())
+	if err != nil {
+		slog.Error("Failed to check administrator", "error", err)
+		os.Exit(1)
+	}
+	if !hasAdmin {
+		token, issued, err := authService.IssueSetupToken(context.Background())
+		switch {
+		case err != nil:
+			slog.Error("Failed to issue setup token", "error", err)
+		case issued:
+			slog.Warn("No administrator yet, create one with POST /setup using this one-time token (valid 24h)", "setup_token", token)
+		default:
+			slog.Warn("No administrator yet, a setup token was already issued by another instance; or run `ibed create-admin`")
+		}
+	}
+
+	// 定期轮换签名密钥
+	go authService.Keys().StartRotation(context.Background(), 10*time.Minute)
+
+	// 初始化存储
+	storageService, err := storage.NewStorage(cfg.UploadDir)
+	if err != nil {
+		slog.Error("Failed to initialize storage", "error", err)
+		os.Exit(1)
+	}
+
 	// 初始化 Top10 缓存
-	go cache.StartTop10Refresh(context.Background(), redisClient, cfg.TopRefreshInterval)
+	hotCache := cache.NewImageCache(cfg.HotCache.TopN, cfg.HotCache.MaxBytes)
+	go cache.StartTop10Refresh(context.Background(), redisClient, storageService, hotCache, cfg.HotCache.TopN, cfg.TopRefreshInterval)
+
+	// 初始化排行榜汇总
+	go cache.StartLeaderboardRollup(context.Background(), redisClient, cfg.Leaderboard.RetentionDays,
+		time.Duration(cfg.Leaderboard.HalfLifeHours)*time.Hour, cfg.Leaderboard.RollupInterval)
+
+	// 定期清理过期图片的统计计数器和过期的每日统计
+	go cache.StartAdminStatsSweep(context.Background(), redisClient, time.Hour)
+
+	// 启动后台任务
+	go jobs.NewRunner(&cfg, redisClient, storageService, hotCache).Start(context.Background())
+
+	// 初始化发布前审核
+	screener, err := moderation.New(cfg.Moderation)
+	if err != nil {
+		slog.Error("Invalid moderation config", "error", err)
+		os.Exit(1)
+	}
+
+	// 初始化病毒扫描，clamd 暂时不可用时只记录警告，上传时按 fail_open 处理
+	scanner, err := clamd.New(cfg.ClamAV)
+	if err != nil {
+		slog.Error("Invalid clamav config", "error", err)
+		os.Exit(1)
+	}
+	if scanner.Enabled() {
+		if err := scanner.Ping(context.Background()); err != nil {
+			slog.Warn("clamd is not reachable", "address", cfg.ClamAV.Address, "error", err)
+		}
+	}
 
 	// 设置路由
-	router := api.SetupRouter(&cfg, redisClient)
+	router := api.SetupRouter(&cfg, redisClient, authService, storageService, hotCache, screener, scanner)
 
 	// 启动服务器
 	server := &http.Server{